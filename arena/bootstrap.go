@@ -43,8 +43,12 @@ public class RobotPlayer {
 const Battlecode2014Readme = ``
 
 func populateBattlecode2014Player(name, sourceDir string) error {
-	sourceFile := filepath.Join(sourceDir, "RobotPlayer.java")
+	packageDir := filepath.Join(sourceDir, "src", name)
+	sourceFile := filepath.Join(packageDir, "RobotPlayer.java")
 	readmeFile := filepath.Join(sourceDir, "README")
+	if err := os.MkdirAll(packageDir, os.ModePerm); err != nil {
+		return err
+	}
 	if err := ioutil.WriteFile(sourceFile, []byte(fmt.Sprintf(Battlecode2014Template, name)), os.ModePerm); err != nil {
 		return err
 	}
@@ -67,8 +71,12 @@ public class RobotPlayer {
 const Battlecode2015Readme = ``
 
 func populateBattlecode2015Player(name, sourceDir string) error {
-	sourceFile := filepath.Join(sourceDir, "RobotPlayer.java")
+	packageDir := filepath.Join(sourceDir, "src", name)
+	sourceFile := filepath.Join(packageDir, "RobotPlayer.java")
 	readmeFile := filepath.Join(sourceDir, "README")
+	if err := os.MkdirAll(packageDir, os.ModePerm); err != nil {
+		return err
+	}
 	if err := ioutil.WriteFile(sourceFile, []byte(fmt.Sprintf(Battlecode2015Template, name)), os.ModePerm); err != nil {
 		return err
 	}
@@ -0,0 +1,203 @@
+package arena
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entries being built are kept beside the cache entries until they are complete
+const buildPrefix = ".build-"
+
+// A content addressed store of compiled players. Each (category, repository, commit) is built once,
+// and the least recently used entries are evicted when the cache grows beyond MaxBytes.
+type BuildCache struct {
+	Dir      string `json:"dir"`
+	MaxBytes int64  `json:"max_bytes"`
+	mutex    sync.Mutex
+	building map[string]chan struct{}
+	inUse    map[string]int
+}
+
+func NewBuildCache(dir string, maxBytes int64) *BuildCache {
+	return &BuildCache{Dir: dir, MaxBytes: maxBytes}
+}
+
+// The cache key of a player's compiled classes
+func BuildKey(category, repoURL, commit string) string {
+	hash := sha256.Sum256([]byte(category + "\x00" + repoURL + "\x00" + commit))
+	return hex.EncodeToString(hash[:])
+}
+
+func (c *BuildCache) Validate() error {
+	if !filepath.IsAbs(c.Dir) {
+		return fmt.Errorf("Build cache dir %v must be an absolute path", c.Dir)
+	} else if c.MaxBytes < 0 {
+		return fmt.Errorf("Build cache max_bytes %v must not be negative", c.MaxBytes)
+	}
+	return nil
+}
+
+// Copies the entry for key into dest, calling build to fill a new entry if the key is missing.
+// Concurrent requests for the same key wait for a single build.
+func (c *BuildCache) CopyTo(key, dest string, build func(dir string) error) error {
+	for {
+		c.mutex.Lock()
+		if c.building == nil {
+			c.building = map[string]chan struct{}{}
+			c.inUse = map[string]int{}
+		}
+		if wait, ok := c.building[key]; ok {
+			c.mutex.Unlock()
+			<-wait
+			continue
+		}
+		entry := filepath.Join(c.Dir, key)
+		if _, err := os.Stat(entry); err == nil {
+			c.inUse[key]++
+			c.mutex.Unlock()
+			now := time.Now()
+			os.Chtimes(entry, now, now)
+			err := copyDir(entry, dest)
+			c.mutex.Lock()
+			c.inUse[key]--
+			c.mutex.Unlock()
+			return err
+		} else if !os.IsNotExist(err) {
+			c.mutex.Unlock()
+			return err
+		}
+		done := make(chan struct{})
+		c.building[key] = done
+		c.mutex.Unlock()
+
+		err := c.fill(key, build)
+
+		c.mutex.Lock()
+		delete(c.building, key)
+		close(done)
+		c.mutex.Unlock()
+		if err != nil {
+			return err
+		}
+		c.evict(key)
+	}
+}
+
+func (c *BuildCache) fill(key string, build func(dir string) error) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	tempDir, err := ioutil.TempDir(c.Dir, buildPrefix)
+	if err != nil {
+		return err
+	}
+	if err := build(tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	} else if err := os.Rename(tempDir, filepath.Join(c.Dir, key)); err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+	return nil
+}
+
+type cacheEntry struct {
+	key   string
+	size  int64
+	atime time.Time
+}
+
+// Removes the least recently used entries until the cache fits in MaxBytes, keeping
+// the entry which was just built and any entry which is being copied.
+func (c *BuildCache) evict(keep string) {
+	if c.MaxBytes <= 0 {
+		return
+	}
+	infos, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		log.Println("Failed to read build cache:", err)
+		return
+	}
+	var entries []cacheEntry
+	var total int64
+	for _, info := range infos {
+		if !info.IsDir() || strings.HasPrefix(info.Name(), buildPrefix) {
+			continue
+		}
+		size, err := dirSize(filepath.Join(c.Dir, info.Name()))
+		if err != nil {
+			log.Println("Failed to size build cache entry:", err)
+			continue
+		}
+		entries = append(entries, cacheEntry{info.Name(), size, info.ModTime()})
+		total += size
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].atime.Before(entries[j].atime) })
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, entry := range entries {
+		if total <= c.MaxBytes {
+			break
+		} else if entry.key == keep || c.inUse[entry.key] > 0 {
+			continue
+		} else if err := os.RemoveAll(filepath.Join(c.Dir, entry.key)); err != nil {
+			log.Println("Failed to evict build cache entry:", err)
+		} else {
+			total -= entry.size
+		}
+	}
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return err
+	})
+	return size, err
+}
+
+// Copies the regular files and directories below src into dest
+func copyDir(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		} else if !info.Mode().IsRegular() {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -0,0 +1,88 @@
+package arena
+
+import (
+	"fmt"
+	"github.com/GlenKelley/battleref/testing"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeBuild(size int) func(dir string) error {
+	return func(dir string) error {
+		return ioutil.WriteFile(filepath.Join(dir, "RobotPlayer.class"), make([]byte, size), 0644)
+	}
+}
+
+func TestBuildCacheReusesBuild(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "buildCache")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	cache := NewBuildCache(filepath.Join(root, "cache"), 0)
+	var builds int32
+	build := func(dir string) error {
+		atomic.AddInt32(&builds, 1)
+		time.Sleep(10 * time.Millisecond)
+		return writeBuild(10)(dir)
+	}
+	key := BuildKey("battlecode2016", "/repos/glen.git", "abcdef")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dest := filepath.Join(root, "match", fmt.Sprint(i))
+			t.CheckError(cache.CopyTo(key, dest, build))
+			if _, err := os.Stat(filepath.Join(dest, "RobotPlayer.class")); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	t.ExpectEqual(atomic.LoadInt32(&builds), int32(1))
+	if BuildKey("battlecode2016", "/repos/glen.git", "012345") == key {
+		t.ErrorNow("expected commits to have different keys")
+	}
+}
+
+func TestBuildCacheEviction(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "buildCache")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	cache := NewBuildCache(filepath.Join(root, "cache"), 250)
+	old := time.Now().Add(-time.Hour)
+	for i, key := range []string{"first", "second"} {
+		t.CheckError(cache.CopyTo(key, filepath.Join(root, key), writeBuild(100)))
+		stamp := old.Add(time.Duration(i) * time.Minute)
+		t.CheckError(os.Chtimes(filepath.Join(cache.Dir, key), stamp, stamp))
+	}
+	// Using the first entry makes the second the least recently used
+	t.CheckError(cache.CopyTo("first", filepath.Join(root, "again"), writeBuild(100)))
+	t.CheckError(cache.CopyTo("third", filepath.Join(root, "third"), writeBuild(100)))
+	for key, exists := range map[string]bool{"first": true, "second": false, "third": true} {
+		if _, err := os.Stat(filepath.Join(cache.Dir, key)); (err == nil) != exists {
+			t.Errorf("expected %v to exist: %v", key, exists)
+		}
+	}
+}
+
+func TestBuildCacheFailedBuild(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "buildCache")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	cache := NewBuildCache(filepath.Join(root, "cache"), 0)
+	if err := cache.CopyTo("broken", filepath.Join(root, "broken"), func(dir string) error { return os.ErrInvalid }); err != os.ErrInvalid {
+		t.ErrorNow("expected build error, not", err)
+	} else if entries, err := ioutil.ReadDir(cache.Dir); err != nil {
+		t.ErrorNow(err)
+	} else if len(entries) != 0 {
+		t.ErrorNow("expected failed build to leave no entries", entries)
+	}
+}
@@ -0,0 +1,100 @@
+package arena
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The most compiler output kept for a submission
+const MaxCompileOutput = 64 * 1024
+
+// The entry point each category expects in a player's repository, where {player} is the player name
+var PlayerLayouts = map[string]string{
+	"battlecode2014": "src/{player}/RobotPlayer.java",
+	"battlecode2015": "src/{player}/RobotPlayer.java",
+	"battlecode2016": "src/{player}/RobotPlayer.java",
+}
+
+// Returned when buildPlayer.sh fails to compile a player
+type BuildError struct {
+	Name   string
+	Output string
+	Err    error
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("Failed to build player %v: %v", e.Name, e.Err)
+}
+
+// The outcome of checking a submission, rejected submissions are never played
+type CompileResult struct {
+	Accepted bool   `json:"accepted"`
+	Output   string `json:"output"`
+}
+
+// An arena which can check that a commit builds before it is played
+type Compiler interface {
+	CompilePlayer(ctx context.Context, category, repoURL, commit string) (CompileResult, error)
+}
+
+// Checks out a commit, confirms it has the layout of its category and compiles it against the engine.
+// Problems with the player are reported in the result, an error means the check itself could not run.
+func (a LocalArena) CompilePlayer(ctx context.Context, category, repoURL, commit string) (CompileResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.MatchTimeout(category))
+	defer cancel()
+	layout, ok := PlayerLayouts[category]
+	if !ok {
+		return CompileResult{}, fmt.Errorf("No player layout is known for category %v", category)
+	}
+	tempDir, err := a.tempDir()
+	if err != nil {
+		return CompileResult{}, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	name := PlayerName(repoURL)
+	sourceDir := filepath.Join(tempDir, "staged", name)
+	if err := stagePlayer(ctx, repoURL, commit, sourceDir); err != nil {
+		if ctx.Err() != nil {
+			return CompileResult{}, ctx.Err()
+		}
+		return rejected(err.Error()), nil
+	}
+	entry := strings.Replace(layout, "{player}", name, -1)
+	if _, err := os.Stat(filepath.Join(sourceDir, filepath.FromSlash(entry))); err != nil {
+		return rejected(fmt.Sprintf("Missing %v, the player must be in package %v", entry, name)), nil
+	}
+
+	var output string
+	build := func(dir string) error {
+		var err error
+		output, err = a.buildPlayer(ctx, category, tempDir, sourceDir, name, dir)
+		return err
+	}
+	builtDir := filepath.Join(tempDir, "built")
+	if a.Cache != nil {
+		err = a.Cache.CopyTo(BuildKey(category, repoURL, commit), builtDir, build)
+	} else {
+		err = build(builtDir)
+	}
+	if buildErr, ok := err.(*BuildError); ok {
+		return rejected(buildErr.Output), nil
+	} else if err != nil {
+		return CompileResult{}, err
+	}
+	return CompileResult{true, truncateOutput(output)}, nil
+}
+
+func rejected(output string) CompileResult {
+	return CompileResult{false, truncateOutput(output)}
+}
+
+func truncateOutput(output string) string {
+	if len(output) > MaxCompileOutput {
+		return output[:MaxCompileOutput] + "\n[output truncated]"
+	}
+	return output
+}
@@ -0,0 +1,97 @@
+package arena
+
+import (
+	"context"
+	"github.com/GlenKelley/battleref/testing"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A buildPlayer.sh which fails to compile any source containing "broken"
+const compileBuildPlayer = `#! /bin/sh
+while getopts "r:d:n:s:o:" opt; do
+  case $opt in
+    n) NAME="$OPTARG" ;;
+    s) SOURCE="$OPTARG" ;;
+    o) OUTPUT="$OPTARG" ;;
+  esac
+done
+if grep -q broken "$SOURCE/src/$NAME/RobotPlayer.java" ; then
+  echo "RobotPlayer.java:1: error: class, interface, or enum expected"
+  exit 1
+fi
+mkdir -p "$OUTPUT" && touch "$OUTPUT/RobotPlayer.class"
+`
+
+func commitFile(t *testutil.T, repoDir, file, content string) string {
+	t.CheckError(os.MkdirAll(filepath.Dir(filepath.Join(repoDir, file)), 0755))
+	t.CheckError(ioutil.WriteFile(filepath.Join(repoDir, file), []byte(content), 0644))
+	for _, args := range [][]string{{"add", "."}, {"commit", "-q", "-m", file}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		RunCommand(t, cmd)
+	}
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = repoDir
+	bs, err := cmd.Output()
+	t.CheckError(err)
+	return strings.TrimSpace(string(bs))
+}
+
+func TestCompilePlayer(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "compileArena")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	categoryDir := filepath.Join(root, "resources", "battlecode2014")
+	t.CheckError(os.MkdirAll(categoryDir, 0755))
+	t.CheckError(ioutil.WriteFile(filepath.Join(categoryDir, "buildPlayer.sh"), []byte(compileBuildPlayer), 0755))
+
+	repoDir := filepath.Join(root, "glen")
+	cmd := exec.Command("git", "init", "-q", repoDir)
+	RunCommand(t, cmd)
+	missing := commitFile(t, repoDir, "README", "")
+	unpackaged := commitFile(t, repoDir, "RobotPlayer.java", "package glen;")
+	valid := commitFile(t, repoDir, "src/glen/RobotPlayer.java", "package glen;")
+	broken := commitFile(t, repoDir, "src/glen/RobotPlayer.java", "broken")
+
+	arena := LocalArena{filepath.Join(root, "resources"), nil, nil, nil}
+	for commit, accepted := range map[string]bool{valid: true, missing: false, unpackaged: false, broken: false, "0123456789": false} {
+		if result, err := arena.CompilePlayer(context.Background(), "battlecode2014", repoDir, commit); err != nil {
+			t.ErrorNow(err)
+		} else if result.Accepted != accepted {
+			t.Errorf("expected %v accepted to be %v: %v", commit, accepted, result.Output)
+		} else if !accepted && result.Output == "" {
+			t.Errorf("expected output explaining why %v was rejected", commit)
+		}
+	}
+}
+
+func TestCompileBootstrapPlayer(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "compileArena")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	for _, category := range []string{"battlecode2014", "battlecode2015"} {
+		categoryDir := filepath.Join(root, "resources", category)
+		t.CheckError(os.MkdirAll(categoryDir, 0755))
+		t.CheckError(ioutil.WriteFile(filepath.Join(categoryDir, "buildPlayer.sh"), []byte(compileBuildPlayer), 0755))
+
+		repoDir := filepath.Join(root, category, "glen")
+		t.CheckError(os.MkdirAll(repoDir, 0755))
+		RunCommand(t, exec.Command("git", "init", "-q", repoDir))
+		t.CheckError(MinimalBootstrap{filepath.Join(root, "resources")}.PopulateRepository("glen", repoDir, category))
+		commit := commitFile(t, repoDir, "README", "")
+
+		arena := LocalArena{filepath.Join(root, "resources"), nil, nil, nil}
+		if result, err := arena.CompilePlayer(context.Background(), category, repoDir, commit); err != nil {
+			t.ErrorNow(err)
+		} else if !result.Accepted {
+			t.Errorf("expected the %v bootstrap player to be accepted: %v", category, result.Output)
+		}
+	}
+}
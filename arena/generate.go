@@ -0,0 +1,198 @@
+package arena
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/GlenKelley/battleref/simulator/battlecode2016"
+	"math/rand"
+	"strings"
+)
+
+// The inputs of a generated battlecode2016 map. Rubble density and parts density are the fraction of
+// cells given rubble or parts, and archons and zombie dens are placed in mirrored pairs.
+// Zombies spawn every zombie interval rounds, starting with zombie count standard zombies and adding
+// zombie growth more each wave, with ranged, fast and big zombies joining in later waves.
+type MapParameters struct {
+	Seed           int64   `json:"seed"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Rounds         int     `json:"rounds"`
+	Symmetry       string  `json:"symmetry"`
+	RubbleDensity  float64 `json:"rubble_density"`
+	PartsDensity   float64 `json:"parts_density"`
+	MaxParts       int     `json:"max_parts"`
+	Archons        int     `json:"archons"`
+	ZombieDens     int     `json:"zombie_dens"`
+	ZombieInterval int     `json:"zombie_interval"`
+	ZombieCount    int     `json:"zombie_count"`
+	ZombieGrowth   int     `json:"zombie_growth"`
+}
+
+var DefaultMapParameters = MapParameters{0, 40, 40, 3000, SymmetryRotational, 0.2, 0.05, 100, 2, 2, 300, 4, 2}
+
+func (p MapParameters) Validate() error {
+	bounds := MapBounds["battlecode2016"]
+	if p.Width < bounds[0] || p.Width > bounds[1] || p.Height < bounds[0] || p.Height > bounds[1] {
+		return fmt.Errorf("A map must be between %v and %v cells wide and high, not %vx%v", bounds[0], bounds[1], p.Width, p.Height)
+	} else if p.Rounds <= 0 {
+		return fmt.Errorf("A map must last at least one round, not %v", p.Rounds)
+	} else if s, ok := findSymmetry(p.Symmetry); !ok {
+		return fmt.Errorf("Unknown symmetry %v", p.Symmetry)
+	} else if s.square && p.Width != p.Height {
+		return fmt.Errorf("%v symmetry needs a square map", p.Symmetry)
+	} else if p.RubbleDensity < 0 || p.RubbleDensity > 1 || p.PartsDensity < 0 || p.PartsDensity > 1 {
+		return fmt.Errorf("Rubble and parts densities must be between 0 and 1")
+	} else if p.PartsDensity > 0 && p.MaxParts < 1 {
+		return fmt.Errorf("Parts cells need at least 1 part, not %v", p.MaxParts)
+	} else if p.Archons < 1 {
+		return fmt.Errorf("Each team needs at least one archon")
+	} else if p.ZombieDens < 0 || p.ZombieDens%2 != 0 {
+		return fmt.Errorf("Zombie dens are placed in mirrored pairs, %v is not an even count", p.ZombieDens)
+	} else if p.ZombieDens > 0 && (p.ZombieInterval <= 0 || p.ZombieCount <= 0 || p.ZombieGrowth < 0) {
+		return fmt.Errorf("Zombie dens need a positive spawn interval and count")
+	} else if 2*(p.Archons+p.ZombieDens/2) > p.Width*p.Height/2 {
+		return fmt.Errorf("%v archons and %v zombie dens do not fit on the map", p.Archons, p.ZombieDens)
+	}
+	return nil
+}
+
+func findSymmetry(name string) (symmetry, bool) {
+	for _, s := range symmetries {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return symmetry{}, false
+}
+
+// Generates the source of a battlecode2016 map, the same source for the same name and parameters.
+// The map is symmetric so each team's cells mirror the other's, and is checked with ValidateMap.
+func GenerateMap(name string, p MapParameters) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	s, _ := findSymmetry(p.Symmetry)
+	random := rand.New(rand.NewSource(p.Seed))
+	layout := newMapLayout(p.Width, p.Height, RubbleObstruction)
+	mirror := func(x, y int) (int, int) {
+		return s.mirror(p.Width, p.Height, x, y)
+	}
+
+	// Cells after their mirror copy it, so only the first of each pair is random
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			if mx, my := mirror(x, y); my*p.Width+mx < y*p.Width+x {
+				layout.Rubble[y][x], layout.Parts[y][x] = layout.Rubble[my][mx], layout.Parts[my][mx]
+				continue
+			}
+			if random.Float64() < p.RubbleDensity {
+				layout.Rubble[y][x] = float64(1 + random.Intn(2*RubbleObstruction))
+			}
+			if random.Float64() < p.PartsDensity {
+				layout.Parts[y][x] = float64(1 + random.Intn(p.MaxParts))
+			}
+		}
+	}
+
+	// Each robot of team A, or of the zombies, is mirrored on a cell before its mirror
+	occupied := map[[2]int]bool{}
+	place := func(robotType, team, mirrorTeam string) {
+		for {
+			x, y := random.Intn(p.Width), random.Intn(p.Height)
+			mx, my := mirror(x, y)
+			if my*p.Width+mx <= y*p.Width+x || occupied[[2]int{x, y}] || occupied[[2]int{mx, my}] {
+				continue
+			}
+			occupied[[2]int{x, y}], occupied[[2]int{mx, my}] = true, true
+			layout.Robots = append(layout.Robots, MapRobot{x, y, robotType, team}, MapRobot{mx, my, robotType, mirrorTeam})
+			return
+		}
+	}
+	for i := 0; i < p.Archons; i++ {
+		place("ARCHON", "A", "B")
+	}
+	for i := 0; i < p.ZombieDens/2; i++ {
+		place("ZOMBIEDEN", "ZOMBIE", "ZOMBIE")
+	}
+	// Archons start on clear ground so they are never walled in
+	for _, robot := range layout.Robots {
+		if robot.Type != "ARCHON" {
+			continue
+		}
+		for y := robot.Y - 1; y <= robot.Y+1; y++ {
+			for x := robot.X - 1; x <= robot.X+1; x++ {
+				if x >= 0 && x < p.Width && y >= 0 && y < p.Height {
+					layout.Rubble[y][x] = 0
+				}
+			}
+		}
+	}
+
+	source := writeObjectMap(name, p, layout)
+	if err := ValidateMap("battlecode2016", source); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// The zombies of each spawn round, every type joining a few waves after the last
+func zombieSchedule(p MapParameters) []bc2016.SpawnSchedule {
+	schedule := []bc2016.SpawnSchedule{}
+	if p.ZombieDens == 0 {
+		return schedule
+	}
+	for wave, round := 0, p.ZombieInterval; round <= p.Rounds; wave, round = wave+1, round+p.ZombieInterval {
+		count := p.ZombieCount + wave*p.ZombieGrowth
+		zombies := []bc2016.ZombieCount{{"STANDARDZOMBIE", count}}
+		if wave >= 1 {
+			zombies = append(zombies, bc2016.ZombieCount{"RANGEDZOMBIE", (count + 1) / 2})
+		}
+		if wave >= 3 {
+			zombies = append(zombies, bc2016.ZombieCount{"FASTZOMBIE", (count + 1) / 2})
+		}
+		if wave >= 5 {
+			zombies = append(zombies, bc2016.ZombieCount{"BIGZOMBIE", (count + 3) / 4})
+		}
+		schedule = append(schedule, bc2016.SpawnSchedule{round, zombies})
+	}
+	return schedule
+}
+
+// Writes a layout in the format of the 2016 engine's maps
+func writeObjectMap(name string, p MapParameters, layout MapLayout) []byte {
+	var b bytes.Buffer
+	random := rand.New(rand.NewSource(p.Seed))
+	fmt.Fprintf(&b, "<object-stream>\n")
+	fmt.Fprintf(&b, "  <game-map width=\"%v\" height=\"%v\" origin=\"%v,%v\" seed=\"%v\" rounds=\"%v\" mapName=\"%v\">\n", p.Width, p.Height, random.Intn(500), random.Intn(500), p.Seed, p.Rounds, name)
+	for _, grid := range []struct {
+		name  string
+		cells [][]float64
+	}{{"initialRubble", layout.Rubble}, {"initialParts", layout.Parts}} {
+		fmt.Fprintf(&b, "    <%v>\n", grid.name)
+		for _, row := range grid.cells {
+			values := []string{}
+			for _, value := range row {
+				values = append(values, fmt.Sprintf("%.1f", value))
+			}
+			fmt.Fprintf(&b, "      <double-array>%v</double-array>\n", strings.Join(values, ","))
+		}
+		fmt.Fprintf(&b, "    </%v>\n", grid.name)
+	}
+	fmt.Fprintf(&b, "    <zombieSpawnSchedule>\n")
+	for _, round := range zombieSchedule(p) {
+		fmt.Fprintf(&b, "        <round number=\"%v\">\n", round.Number)
+		for _, zombies := range round.ZombieCount {
+			fmt.Fprintf(&b, "            <zombie-count type=\"%v\" count=\"%v\"/>\n", zombies.Type, zombies.Count)
+		}
+		fmt.Fprintf(&b, "        </round>\n")
+	}
+	fmt.Fprintf(&b, "    </zombieSpawnSchedule>\n")
+	fmt.Fprintf(&b, "    <initialRobots>\n")
+	for _, robot := range layout.Robots {
+		fmt.Fprintf(&b, "      <initial-robot originOffsetX=\"%v\" originOffsetY=\"%v\" type=\"%v\" team=\"%v\"/>\n", robot.X, robot.Y, robot.Type, robot.Team)
+	}
+	fmt.Fprintf(&b, "    </initialRobots>\n")
+	fmt.Fprintf(&b, "  </game-map>\n")
+	fmt.Fprintf(&b, "</object-stream>\n")
+	return b.Bytes()
+}
@@ -0,0 +1,68 @@
+package arena
+
+import (
+	"bytes"
+	"github.com/GlenKelley/battleref/testing"
+	"testing"
+)
+
+func TestGenerateMap(test *testing.T) {
+	t := (*testutil.T)(test)
+	for _, s := range symmetries {
+		p := DefaultMapParameters
+		p.Symmetry, p.Seed, p.Archons, p.ZombieDens = s.name, 7, 3, 4
+		source, err := GenerateMap("MapFoo", p)
+		t.CheckError(err)
+		analysis, err := AnalyzeMap("battlecode2016", source)
+		t.CheckError(err)
+		found := false
+		for _, symmetry := range analysis.Symmetries {
+			found = found || symmetry == s.name
+		}
+		if !found {
+			t.ErrorNow("expected", s.name, "symmetry in", analysis.Symmetries, analysis.Asymmetries)
+		}
+		t.ExpectEqual(len(analysis.Teams["A"].Starts), 3)
+		t.ExpectEqual(len(analysis.Teams["B"].Starts), 3)
+		t.ExpectEqual(analysis.PartsImbalance, 0.0)
+
+		again, err := GenerateMap("MapFoo", p)
+		t.CheckError(err)
+		if !bytes.Equal(source, again) {
+			t.ErrorNow("expected the same map from the same seed")
+		}
+		p.Seed++
+		if other, err := GenerateMap("MapFoo", p); err != nil {
+			t.ErrorNow(err)
+		} else if bytes.Equal(source, other) {
+			t.ErrorNow("expected a different map from a different seed")
+		}
+	}
+}
+
+func TestGenerateMapParameters(test *testing.T) {
+	t := (*testutil.T)(test)
+	p := DefaultMapParameters
+	p.ZombieDens = 0
+	source, err := GenerateMap("MapFoo", p)
+	t.CheckError(err)
+	layout, err := ParseMapLayout("battlecode2016", source)
+	t.CheckError(err)
+	t.ExpectEqual(len(layout.Robots), 2*p.Archons)
+
+	for _, invalid := range []func(p *MapParameters){
+		func(p *MapParameters) { p.Width = 10 },
+		func(p *MapParameters) { p.Symmetry = "spiral" },
+		func(p *MapParameters) { p.Symmetry, p.Width = SymmetryDiagonal, 50 },
+		func(p *MapParameters) { p.RubbleDensity = 2 },
+		func(p *MapParameters) { p.Archons = 0 },
+		func(p *MapParameters) { p.ZombieDens = 3 },
+		func(p *MapParameters) { p.ZombieInterval = 0 },
+	} {
+		p := DefaultMapParameters
+		invalid(&p)
+		if _, err := GenerateMap("MapFoo", p); err == nil {
+			t.ErrorNow("expected invalid parameters", p)
+		}
+	}
+}
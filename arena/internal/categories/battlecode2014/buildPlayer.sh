@@ -0,0 +1,79 @@
+#! /bin/bash
+
+#
+# Compiles a player so that its classes can be reused by runMatch.sh
+# 
+# Author: Glen Kelley
+#
+
+function usage {
+  echo ""
+  echo "$0"
+  echo ""
+  echo "	-r battlecode tar	The tar file of the battlecode application"
+  echo "	-d temp_directory       A temporary directory for the script to do work in"	
+  echo "	-n name			The name of the player"
+  echo "	-s source_directory	The player source checked out by the server"
+  echo "	-o output_directory	The directory to copy the compiled classes of the player to"
+  echo "" 
+  exit 1
+}
+
+function error {
+	echo "$@" >&2
+}
+
+while getopts "?r:d:n:s:o:" opt; do
+  case $opt in
+    r) BATTLECODE_TAR="$OPTARG" ;;
+    d) BATTLECODE_DIR="$OPTARG" ;;
+    n) NAME="$OPTARG" ;;
+    s) SOURCE_DIR="$OPTARG" ;;
+    o) OUTPUT_DIR="$OPTARG" ;;
+    ? ) usage
+  esac
+done
+set -ex
+
+if [[ -z "$BATTLECODE_TAR" ]] ; then
+  error "Error: You must define the battlecode root directory."
+  usage
+elif [[ ! -f "$BATTLECODE_TAR" ]] ; then
+  error "Error: $BATTLECODE_TAR is not a file."
+  usage
+fi
+
+if [[ -z "$NAME" ]] ; then
+  error "Error: You must define the player name."
+  usage
+fi
+if [[ -z "$SOURCE_DIR" ]] ; then
+  error "Error: You must define the player source."
+  usage
+elif [[ ! -d "$SOURCE_DIR" ]] ; then
+  error "Error: $SOURCE_DIR is not a directory."
+  usage
+fi
+if [[ -z "$OUTPUT_DIR" ]] ; then
+  error "Error: You must define an output directory."
+  usage
+fi
+if [[ -z "$BATTLECODE_DIR" ]] ; then
+  error "Error: You must define a temp directory."
+  usage
+fi
+
+mkdir -p "$BATTLECODE_DIR"
+tar -xf "$BATTLECODE_TAR" -C "$BATTLECODE_DIR/"
+mkdir -p "$BATTLECODE_DIR/teams/"
+cp -R "$SOURCE_DIR/src/$NAME" "$BATTLECODE_DIR/teams/$NAME"
+
+pushd "$BATTLECODE_DIR" >/dev/null
+if ! ant build > output.log 2> error.log ; then
+	cat output.log error.log >&2
+	exit 1
+fi
+popd >/dev/null
+
+mkdir -p "$OUTPUT_DIR"
+cp -R "$BATTLECODE_DIR/bin/$NAME/." "$OUTPUT_DIR/"
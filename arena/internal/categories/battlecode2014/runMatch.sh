@@ -18,6 +18,8 @@ function usage {
   echo "	-C commit2		The git commit hash of the second player repo"
   echo "	-m map			The name of the map"
   echo "	-M map_file		The file of the map content"
+  echo "	-s staged_directory	Player sources already checked out by the server, used instead of cloning"
+  echo "	-b built_directory	Player classes compiled by buildPlayer.sh, used instead of compiling the sources"
   echo "" 
   exit 1
 }
@@ -26,7 +28,7 @@ function error {
 	echo "$@" >&2
 }
 
-while getopts "?r:d:p:P:c:C:u:m:M:" opt; do
+while getopts "?r:d:p:P:c:C:u:m:M:s:b:" opt; do
   case $opt in
     r) BATTLECODE_TAR="$OPTARG" ;;
     d) BATTLECODE_DIR="$OPTARG" ;;
@@ -36,6 +38,8 @@ while getopts "?r:d:p:P:c:C:u:m:M:" opt; do
     C) COMMIT2="$OPTARG" ;;
     m) MAP="$OPTARG" ;;
     M) MAP_FILE="$OPTARG" ;;
+    s) STAGED_DIR="$OPTARG" ;;
+    b) BUILT_DIR="$OPTARG" ;;
     ? ) usage
   esac
 done
@@ -85,7 +89,7 @@ elif [[ ! -d "$BATTLECODE_DIR" ]] ; then
   usage
 fi
 
-LOG=~/.battleref/arena.log
+LOG=${BATTLEREF_LOG:-$HOME/.battleref/arena.log}
 echo "`date` START" >> $LOG
 
 tar -xf "$BATTLECODE_TAR" -C "$BATTLECODE_DIR/"
@@ -96,31 +100,69 @@ mkdir -p "$BATTLECODE_DIR/teams/"
 mkdir -p "$BATTLECODE_DIR/maps/"
 cp "$MAP_FILE" "$BATTLECODE_DIR/maps/${MAP}.xml"
 
+#Create checkout directory, only the player package is moved into teams
+mkdir -p "$BATTLECODE_DIR/extract/"
+
+#Moves a player to another package, staged players are renamed by the server
+function renamePackage {
+	REPO_PATH=$1
+	FROM=$2
+	TO=$3
+	if [[ -d "$REPO_PATH/src/$FROM" ]] ; then
+		mv "$REPO_PATH/src/$FROM" "$REPO_PATH/src/$TO"
+	fi
+	find "$REPO_PATH" -name '*.java' -exec sed -i -E "s/^([[:space:]]*(package|import([[:space:]]+static)?)[[:space:]]+)$FROM\b/\1$TO/" {} +
+}
+
 function createRepo {
 	REPO_URL=$1
 	REPO_NAME=$2
 	COMMIT=$3
-	REPO_PATH=$BATTLECODE_DIR/teams/$REPO_NAME
-	git clone "$REPO_URL" "$REPO_PATH"
-	pushd "$REPO_PATH" >/dev/null
-	if ! git checkout "$COMMIT" 2>error.log ; then 
-		cat error.log >&2
+	PACKAGE=$4
+	REPO_PATH=$BATTLECODE_DIR/extract/$REPO_NAME
+	TEAM_DIR=$BATTLECODE_DIR/teams/$REPO_NAME
+	if [[ -n "$STAGED_DIR" ]] ; then
+		cp -R "$STAGED_DIR/$REPO_NAME" "$REPO_PATH"
+	else
+		git clone "$REPO_URL" "$REPO_PATH"
+		pushd "$REPO_PATH" >/dev/null
+		if ! git checkout "$COMMIT" 2>error.log ; then 
+			cat error.log >&2
+		fi
+		popd >/dev/null
+		if [[ "$PACKAGE" != "$REPO_NAME" ]] ; then
+			renamePackage "$REPO_PATH" "$PACKAGE" "$REPO_NAME"
+		fi
 	fi
-	popd >/dev/null
+	mv "$REPO_PATH/src/$REPO_NAME" "$TEAM_DIR"
+	rm -rf "$REPO_PATH"
 }
 
-#Create teams
+#Create teams, side B of a match between two commits of the same player is renamed to its own package
 NAME1=`basename "${PLAYER1%.git}" | sed 's/^.*://'`
 NAME2=`basename "${PLAYER2%.git}" | sed 's/^.*://'`
-createRepo "$PLAYER1" "$NAME1" "$COMMIT1"
+createRepo "$PLAYER1" "$NAME1" "$COMMIT1" "$NAME1"
+
+if [[ "$PLAYER1" != "$PLAYER2" ]] ; then
+  createRepo "$PLAYER2" "$NAME2" "$COMMIT2" "$NAME2"
+elif [[ "$COMMIT1" != "$COMMIT2" ]] ; then
+  NAME2="${NAME1}_b"
+  createRepo "$PLAYER2" "$NAME2" "$COMMIT2" "$NAME1"
+fi
+
+#Install compiled teams, newer than their sources so ant does not compile them again
+function installBuild {
+	REPO_NAME=$1
+	mkdir -p "$BATTLECODE_DIR/bin"
+	cp -R "$BUILT_DIR/$REPO_NAME" "$BATTLECODE_DIR/bin/$REPO_NAME"
+	find "$BATTLECODE_DIR/bin/$REPO_NAME" -exec touch {} +
+}
 
-if [[ "$PLAYER1" = "$PLAYER2" ]] ; then
-  if [[ "$COMMIT1" != "$COMMIT2" ]] ; then
-    error "Error: Unable to play different commits of the same player."
-    exit 1
+if [[ -n "$BUILT_DIR" ]] ; then
+  installBuild "$NAME1"
+  if [[ "$NAME1" != "$NAME2" ]] ; then
+    installBuild "$NAME2"
   fi
-else
-  createRepo "$PLAYER2" "$NAME2" "$COMMIT2"
 fi
 
 error "Match [$NAME1:$COMMIT1] vs [$NAME2:$COMMIT2] on $MAP" >&2
@@ -149,14 +191,7 @@ if [[ -f "match.rms" ]] ; then
 	mv "match.rms" "replay.xml.gz"
 fi
 
-WINNER=`grep "\[java\] \[server\]" output.log | perl -i -n -e 'if(/ \((\w)\) wins/){print "$1"}'`
-REASON=`grep "Reason:" output.log | perl -i -n -e '
-	if(/Reason: ([^\n]+)/){
-		if ($1 eq "The winning team won by getting a lot of milk.") { print "VICTORY" }
-		if ($1 eq "The winning team won on tiebreakers.") { print "TIE" }
-		if ($1 =~ /Team (A|B) won by default./) { print "TIE" }
-	}'`
-echo -n "{\"winner\":\"$WINNER\",\"reason\":\"$REASON\"}"
+#The result is read from output.log and the replay by the server
 
 popd > /dev/null
 echo "`date` FINISH MATCH" >> $LOG
@@ -0,0 +1,69 @@
+package arena
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The most output kept for each stream of a match log
+const MaxLogBytes = 256 * 1024
+
+// The output of a match. Engine and Stderr are the output of the engine and of runMatch.sh,
+// TeamA and TeamB are what each team printed, including multi-line prints and the stack traces of their exceptions.
+type MatchLogs struct {
+	Engine string `json:"engine"`
+	TeamA  string `json:"team_a"`
+	TeamB  string `json:"team_b"`
+	Stderr string `json:"stderr"`
+}
+
+var (
+	teamLineRegex   = regexp.MustCompile(`^\s*(?:\[java\]\s*)?\[(A|B):[^\]]*\]`)
+	serverLineRegex = regexp.MustCompile(`^\s*(?:\[java\]\s*)?\[server\]`)
+)
+
+// Splits the engine output of a match into the lines printed by each team and the rest.
+// Lines without a prefix continue the print before them, until the engine or the other team prints.
+func NewMatchLogs(engineOutput, stderr []byte) MatchLogs {
+	var engine, teamA, teamB []string
+	team := ""
+	for _, line := range strings.Split(strings.TrimRight(string(engineOutput), "\n"), "\n") {
+		if m := teamLineRegex.FindStringSubmatch(line); m != nil {
+			team = m[1]
+		} else if serverLineRegex.MatchString(line) {
+			team = ""
+		}
+		switch team {
+		case WinnerA:
+			teamA = append(teamA, line)
+		case WinnerB:
+			teamB = append(teamB, line)
+		default:
+			engine = append(engine, line)
+		}
+	}
+	return MatchLogs{
+		truncateLog(strings.Join(engine, "\n")),
+		truncateLog(strings.Join(teamA, "\n")),
+		truncateLog(strings.Join(teamB, "\n")),
+		truncateLog(string(stderr)),
+	}
+}
+
+// The compiler output of a failed build, attributed to the team which failed to compile
+func (e *BuildError) Logs(p MatchProperties) MatchLogs {
+	if name1, _ := p.PlayerNames(); e.Name == name1 {
+		return MatchLogs{TeamA: truncateLog(e.Output)}
+	} else {
+		return MatchLogs{TeamB: truncateLog(e.Output)}
+	}
+}
+
+// Keeps the start and end of a log which is too long, where the configuration and the crash usually are
+func truncateLog(log string) string {
+	if len(log) <= MaxLogBytes {
+		return log
+	}
+	half := MaxLogBytes / 2
+	return log[:half] + "\n[log truncated]\n" + log[len(log)-half:]
+}
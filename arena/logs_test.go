@@ -0,0 +1,45 @@
+package arena
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"strings"
+	"testing"
+)
+
+func TestNewMatchLogs(test *testing.T) {
+	t := (*testutil.T)(test)
+	output := strings.Join([]string{
+		"     [java] [server] -------------------- Match Starting --------------------",
+		"     [java] [A:ARCHON#1@1] hello from a",
+		"     [java] secret plan line 2",
+		"     [java] secret plan line 3",
+		"     [java] [B:SOLDIER#2@3] java.lang.NullPointerException",
+		"     [java] \tat teamb.RobotPlayer.run(RobotPlayer.java:12)",
+		"     [java] \t... 3 more",
+		"     [java] [server] teamb (B) wins",
+		"     [java] [server] Reason: destroyed",
+	}, "\n")
+	logs := NewMatchLogs([]byte(output), []byte("StderrFoo"))
+	if !strings.Contains(logs.TeamA, "hello from a") || !strings.Contains(logs.TeamA, "secret plan line 3") || strings.Contains(logs.TeamA, "NullPointer") {
+		t.Error("Unexpected team A log", logs.TeamA)
+	}
+	if !strings.Contains(logs.TeamB, "RobotPlayer.java:12") || !strings.Contains(logs.TeamB, "3 more") || strings.Contains(logs.TeamB, "secret") || strings.Contains(logs.TeamB, "wins") {
+		t.Error("Unexpected team B log", logs.TeamB)
+	}
+	if !strings.Contains(logs.Engine, "Match Starting") || !strings.Contains(logs.Engine, "Reason") || strings.Contains(logs.Engine, "hello") || strings.Contains(logs.Engine, "secret") {
+		t.Error("Unexpected engine log", logs.Engine)
+	}
+	if logs.Stderr != "StderrFoo" {
+		t.Error("Unexpected stderr", logs.Stderr)
+	}
+}
+
+func TestTruncateLog(test *testing.T) {
+	t := (*testutil.T)(test)
+	log := "start" + strings.Repeat("x", MaxLogBytes) + "end"
+	if truncated := truncateLog(log); len(truncated) > MaxLogBytes+len("\n[log truncated]\n") {
+		t.Error("Log not truncated", len(truncated))
+	} else if !strings.HasPrefix(truncated, "start") || !strings.HasSuffix(truncated, "end") {
+		t.Error("Expected the start and end of the log")
+	}
+}
@@ -0,0 +1,249 @@
+package arena
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/GlenKelley/battleref/simulator/battlecode2016"
+	"github.com/GlenKelley/battleref/web"
+	"strconv"
+	"strings"
+)
+
+// The smallest and largest width and height of a map in each category
+var MapBounds = map[string][2]int{
+	"battlecode2014": {20, 100},
+	"battlecode2015": {30, 120},
+	"battlecode2016": {30, 80},
+}
+
+// The zombies a 2016 map may schedule
+var ZombieTypes = map[string]bool{
+	"STANDARDZOMBIE": true,
+	"RANGEDZOMBIE":   true,
+	"FASTZOMBIE":     true,
+	"BIGZOMBIE":      true,
+}
+
+// Returned when a map cannot be played, with an item for each problem found
+type MapError struct {
+	Problems []web.ErrorItem
+}
+
+func (e *MapError) Error() string {
+	messages := []string{}
+	for _, problem := range e.Problems {
+		messages = append(messages, problem.Message)
+	}
+	return "Invalid map: " + strings.Join(messages, ", ")
+}
+
+type mapProblems struct {
+	items []web.ErrorItem
+}
+
+func (p *mapProblems) add(reason, location, format string, args ...interface{}) {
+	p.items = append(p.items, web.NewErrorItem(reason, fmt.Sprintf(format, args...), location, "map"))
+}
+
+func (p *mapProblems) err() error {
+	if len(p.items) == 0 {
+		return nil
+	}
+	return &MapError{p.items}
+}
+
+// The map format of 2014 and 2015, a grid of symbol characters each followed by a number
+type TextMap struct {
+	XMLName xml.Name    `xml:"map"`
+	Width   int         `xml:"width,attr"`
+	Height  int         `xml:"height,attr"`
+	Game    MapGame     `xml:"game"`
+	Symbols []MapSymbol `xml:"symbols>symbol"`
+	Data    string      `xml:"data"`
+}
+
+type MapGame struct {
+	Seed   int `xml:"seed,attr"`
+	Rounds int `xml:"rounds,attr"`
+}
+
+type MapSymbol struct {
+	Terrain   string `xml:"terrain,attr"`
+	Type      string `xml:"type,attr"`
+	Team      string `xml:"team,attr"`
+	Character string `xml:"character,attr"`
+}
+
+// The map format of 2016
+type ObjectMap struct {
+	XMLName xml.Name   `xml:"object-stream"`
+	Map     bc2016.Map `xml:"game-map"`
+}
+
+// Parses a map of a category and checks that the engine can play it.
+// Problems with the map are returned as a *MapError.
+func ValidateMap(category string, source []byte) error {
+	problems := &mapProblems{}
+	bounds, ok := MapBounds[category]
+	if !ok {
+		return fmt.Errorf("No map validator is known for category %v", category)
+	}
+	switch category {
+	case "battlecode2016":
+		var objectMap ObjectMap
+		if err := xml.Unmarshal(source, &objectMap); err != nil {
+			problems.add("Invalid XML", "source", "Unable to parse the map: %v", err)
+		} else {
+			validateObjectMap(problems, objectMap.Map, bounds)
+		}
+	default:
+		var textMap TextMap
+		if err := xml.Unmarshal(source, &textMap); err != nil {
+			problems.add("Invalid XML", "source", "Unable to parse the map: %v", err)
+		} else {
+			validateTextMap(problems, textMap, bounds, category == "battlecode2015")
+		}
+	}
+	return problems.err()
+}
+
+func validateDimensions(problems *mapProblems, width, height, rounds int, bounds [2]int) bool {
+	valid := true
+	for _, dimension := range []struct {
+		name  string
+		value int
+	}{{"width", width}, {"height", height}} {
+		if dimension.value < bounds[0] || dimension.value > bounds[1] {
+			problems.add("Invalid dimensions", dimension.name, "The %v %v is not between %v and %v", dimension.name, dimension.value, bounds[0], bounds[1])
+			valid = false
+		}
+	}
+	if rounds <= 0 {
+		problems.add("Invalid rounds", "rounds", "The map must last at least one round, not %v", rounds)
+	}
+	return valid
+}
+
+func validateTextMap(problems *mapProblems, m TextMap, bounds [2]int, towers bool) {
+	if !validateDimensions(problems, m.Width, m.Height, m.Game.Rounds, bounds) {
+		return
+	}
+	symbols := map[string]MapSymbol{}
+	for _, symbol := range m.Symbols {
+		symbols[symbol.Character] = symbol
+	}
+	rows := []string{}
+	for _, row := range strings.Split(m.Data, "\n") {
+		if row = strings.TrimSpace(row); row != "" {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) != m.Height {
+		problems.add("Invalid dimensions", "data", "The map has %v rows, not its height %v", len(rows), m.Height)
+		return
+	}
+	robots := map[string]int{}
+	for y, row := range rows {
+		cells := strings.Fields(row)
+		if len(cells) != m.Width {
+			problems.add("Invalid dimensions", fmt.Sprintf("data[%v]", y), "Row %v has %v cells, not the map width %v", y, len(cells), m.Width)
+			continue
+		}
+		for x, cell := range cells {
+			character := strings.TrimRight(cell, "0123456789.")
+			if symbol, ok := symbols[character]; !ok || character == "" {
+				problems.add("Unknown symbol", fmt.Sprintf("data[%v][%v]", y, x), "Cell %v has no symbol", cell)
+			} else if _, err := strconv.ParseFloat(cell[len(character):], 64); err != nil {
+				problems.add("Invalid value", fmt.Sprintf("data[%v][%v]", y, x), "Cell %v has no value", cell)
+			} else if symbol.Type != "TERRAIN" {
+				robots[symbol.Type+symbol.Team]++
+			}
+		}
+	}
+	for _, team := range []string{"A", "B"} {
+		if robots["HQ"+team] != 1 {
+			problems.add("Missing robots", "data", "Team %v has %v HQs, not 1", team, robots["HQ"+team])
+		}
+	}
+	if towers && robots["TOWERA"] != robots["TOWERB"] {
+		problems.add("Missing robots", "data", "Team A has %v towers but team B has %v", robots["TOWERA"], robots["TOWERB"])
+	}
+}
+
+func validateObjectMap(problems *mapProblems, m bc2016.Map, bounds [2]int) {
+	if !validateDimensions(problems, m.Width, m.Height, m.Rounds, bounds) {
+		return
+	}
+	for _, grid := range []struct {
+		name   string
+		values []bc2016.FloatArray2D
+	}{{"initialRubble", m.InitialRubble}, {"initialParts", m.InitialParts}} {
+		if len(grid.values) != m.Height {
+			problems.add("Invalid dimensions", grid.name, "%v has %v rows, not the map height %v", grid.name, len(grid.values), m.Height)
+			continue
+		}
+		for y, row := range grid.values {
+			location := fmt.Sprintf("%v[%v]", grid.name, y)
+			values := rowValues(row)
+			if len(values) != m.Width {
+				problems.add("Invalid dimensions", location, "Row %v of %v has %v values, not the map width %v", y, grid.name, len(values), m.Width)
+				continue
+			}
+			for _, value := range values {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil || v < 0 {
+					problems.add("Invalid value", location, "%v is not a non-negative number", value)
+					break
+				}
+			}
+		}
+	}
+
+	robots := map[bc2016.Team]map[string]int{}
+	for i, robot := range m.InitialRobots {
+		if robots[robot.Team] == nil {
+			robots[robot.Team] = map[string]int{}
+		}
+		robots[robot.Team][robot.Type]++
+		if robot.OriginOffsetX < 0 || robot.OriginOffsetX >= m.Width || robot.OriginOffsetY < 0 || robot.OriginOffsetY >= m.Height {
+			problems.add("Invalid position", fmt.Sprintf("initialRobots[%v]", i), "The %v at (%v, %v) is outside the map", robot.Type, robot.OriginOffsetX, robot.OriginOffsetY)
+		}
+	}
+	if m.Armageddon {
+		// Team B plays the zombies on an armageddon map
+		if robots["A"]["ARCHON"] == 0 || robots["ZOMBIE"]["ZOMBIEDEN"] == 0 {
+			problems.add("Missing robots", "initialRobots", "An armageddon map needs an archon and a zombie den, it has %v and %v", robots["A"]["ARCHON"], robots["ZOMBIE"]["ZOMBIEDEN"])
+		}
+	} else if robots["A"]["ARCHON"] == 0 || robots["B"]["ARCHON"] == 0 {
+		problems.add("Missing robots", "initialRobots", "Both teams need an archon, team A has %v and team B has %v", robots["A"]["ARCHON"], robots["B"]["ARCHON"])
+	} else if robots["A"]["ARCHON"] != robots["B"]["ARCHON"] {
+		problems.add("Missing robots", "initialRobots", "Team A has %v archons but team B has %v", robots["A"]["ARCHON"], robots["B"]["ARCHON"])
+	}
+
+	previous := -1
+	for i, round := range m.ZombieSpawnSchedule {
+		location := fmt.Sprintf("zombieSpawnSchedule[%v]", i)
+		if round.Number <= previous || round.Number > m.Rounds {
+			problems.add("Invalid schedule", location, "Spawn round %v must come after the previous spawn round and by round %v", round.Number, m.Rounds)
+		}
+		previous = round.Number
+		for _, zombies := range round.ZombieCount {
+			if !ZombieTypes[zombies.Type] {
+				problems.add("Invalid schedule", location, "Unknown zombie type %v", zombies.Type)
+			} else if zombies.Count < 0 {
+				problems.add("Invalid schedule", location, "Round %v spawns %v %v", round.Number, zombies.Count, zombies.Type)
+			}
+		}
+	}
+	if len(m.ZombieSpawnSchedule) > 0 && robots["ZOMBIE"]["ZOMBIEDEN"] == 0 {
+		problems.add("Invalid schedule", "zombieSpawnSchedule", "Zombies are scheduled but the map has no zombie den")
+	}
+}
+
+// The comma separated values of a row of a 2016 grid, which decodes in pieces
+func rowValues(row bc2016.FloatArray2D) []string {
+	parts := []string{}
+	for _, part := range row {
+		parts = append(parts, strings.TrimSpace(string(part)))
+	}
+	return strings.Split(strings.Join(parts, ","), ",")
+}
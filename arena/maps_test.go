@@ -0,0 +1,63 @@
+package arena
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The reasons a map was rejected, separated by commas
+func mapProblemReasons(t *testutil.T, category string, source []byte) string {
+	reasons := []string{}
+	if err := ValidateMap(category, source); err == nil {
+		return ""
+	} else if mapErr, ok := err.(*MapError); !ok {
+		t.ErrorNow(err)
+	} else {
+		for _, problem := range mapErr.Problems {
+			reasons = append(reasons, problem.Reason)
+		}
+	}
+	return strings.Join(reasons, ",")
+}
+
+func TestValidateDefaultMaps(test *testing.T) {
+	t := (*testutil.T)(test)
+	for category := range MapBounds {
+		files, err := filepath.Glob(filepath.Join("internal", "categories", category, "maps", "*.xml"))
+		t.CheckError(err)
+		if len(files) == 0 {
+			t.ErrorNow("expected maps for", category)
+		}
+		for _, file := range files {
+			source, err := ioutil.ReadFile(file)
+			t.CheckError(err)
+			if err := ValidateMap(category, source); err != nil {
+				t.ErrorNow(file, err)
+			}
+		}
+	}
+}
+
+func TestValidateMap(test *testing.T) {
+	t := (*testutil.T)(test)
+	if err := ValidateMap("battlecode2000", SampleMap); err == nil {
+		t.ErrorNow("expected an error for an unknown category")
+	}
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2014", SampleMap), "")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2014", []byte("SourceFoo")), "Invalid XML")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2014", []byte(strings.Replace(string(SampleMap), `width="20"`, `width="200"`, 1))), "Invalid dimensions")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2014", []byte(strings.Replace(string(SampleMap), "b0", "_0", 1))), "Missing robots")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2014", []byte(strings.Replace(string(SampleMap), "a0", "x0", 1))), "Unknown symbol,Missing robots")
+
+	source, err := ioutil.ReadFile(filepath.Join("internal", "categories", "battlecode2016", "maps", "6147.xml"))
+	t.CheckError(err)
+	map2016 := string(source)
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2016", source), "")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2016", []byte(strings.Replace(map2016, "<double-array>0.0,", "<double-array>", 1))), "Invalid dimensions")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2016", []byte(strings.Replace(map2016, `team="B"`, `team="NEUTRAL"`, -1))), "Missing robots")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2016", []byte(strings.Replace(map2016, `<round number="100">`, `<round number="10">`, 1))), "Invalid schedule")
+	t.ExpectEqual(mapProblemReasons(t, "battlecode2016", []byte(strings.Replace(map2016, `count="4"`, `count="-4"`, 1))), "Invalid schedule")
+}
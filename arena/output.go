@@ -0,0 +1,167 @@
+package arena
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Reason codes for the way a match was decided
+const (
+	ReasonCodeDestruction  = "DESTRUCTION"
+	ReasonCodeMilk         = "MILK"
+	ReasonCodeTiebreakers  = "TIEBREAKERS"
+	ReasonCodeDefault      = "DEFAULT"
+	ReasonCodeTowers       = "TOWERS"
+	ReasonCodeHQHealth     = "HQ_HEALTH"
+	ReasonCodeTowerHealth  = "TOWER_HEALTH"
+	ReasonCodeSanitation   = "SANITATION"
+	ReasonCodeOre          = "ORE"
+	ReasonCodeArchons      = "ARCHONS"
+	ReasonCodeArchonHealth = "ARCHON_HEALTH"
+	ReasonCodeParts        = "PARTS"
+	ReasonCodeArbitrary    = "ARBITRARY"
+)
+
+// A way for a match to end. Tier zero is an outright victory, higher tiers are
+// successive tiebreakers applied by the engine once the round limit is reached.
+type MatchOutcome struct {
+	Pattern *regexp.Regexp
+	Code    string
+	Tier    int
+}
+
+// The outcomes reported by the engine of each category, matched against its "Reason:" line
+var MatchOutcomes = map[string][]MatchOutcome{
+	"battlecode2014": {
+		{regexp.MustCompile(`^The winning team won by destruction\.$`), ReasonCodeDestruction, 0},
+		{regexp.MustCompile(`^The winning team won by getting a lot of milk\.$`), ReasonCodeMilk, 0},
+		{regexp.MustCompile(`^The winning team won on tiebreakers\.$`), ReasonCodeTiebreakers, 1},
+		{regexp.MustCompile(`^Team (A|B) won by default\.$`), ReasonCodeDefault, 2},
+	},
+	"battlecode2015": {
+		{regexp.MustCompile(`^The winning team won by destruction\.$`), ReasonCodeDestruction, 0},
+		{regexp.MustCompile(`^The winning team won on tiebreakers \(more towers remaining\)\.$`), ReasonCodeTowers, 1},
+		{regexp.MustCompile(`^The winning team won on tiebreakers \(more HQ health\)\.$`), ReasonCodeHQHealth, 2},
+		{regexp.MustCompile(`^The winning team won on tiebreakers \(more TOWER health\)\.$`), ReasonCodeTowerHealth, 3},
+		{regexp.MustCompile(`^The winning team won due to superior sanitation\.$`), ReasonCodeSanitation, 4},
+		{regexp.MustCompile(`^The winning team won on tiebreakers \(more total ore value\)\.$`), ReasonCodeOre, 5},
+		{regexp.MustCompile(`^Team (A|B) won arbitrarily\.$`), ReasonCodeArbitrary, 6},
+	},
+	"battlecode2016": {
+		{regexp.MustCompile(`^The winning team won by destruction\.$`), ReasonCodeDestruction, 0},
+		{regexp.MustCompile(`^The winning team won on tiebreakers \(more Archons remaining\)\.$`), ReasonCodeArchons, 1},
+		{regexp.MustCompile(`^The winning team won on tiebreakers \(more Archon health\)\.$`), ReasonCodeArchonHealth, 2},
+		{regexp.MustCompile(`^The winning team won on tiebreakers \(more Parts\)\.?$`), ReasonCodeParts, 3},
+		{regexp.MustCompile(`^The winning team won arbitrarily\.$`), ReasonCodeArbitrary, 4},
+	},
+}
+
+// Only lines printed by the engine are read, a team can print anything after its own prefix
+var (
+	winnerRegex = regexp.MustCompile(`^\s*\[java\] \[server\].*\((A|B)\) wins`)
+	roundRegex  = regexp.MustCompile(`^\s*\[java\] \[server\].*\(round (\d+)\)`)
+	reasonRegex = regexp.MustCompile(`^\s*\[java\] \[server\] Reason: (.+)`)
+)
+
+// Returned when the engine reports a reason which is not one of the outcomes of the category.
+// Playing the match again would report the same reason, so the match is not retried.
+type UnrecognisedReasonError struct {
+	Category string
+	Reason   string
+}
+
+func (e *UnrecognisedReasonError) Error() string {
+	return fmt.Sprintf("Unrecognised match reason %q for %v", e.Reason, e.Category)
+}
+
+// Reads the result of a match from the engine output and its replay
+func ParseMatchOutput(category string, output, replay []byte) (MatchResult, error) {
+	var result MatchResult
+	outcomes, ok := MatchOutcomes[category]
+	if !ok {
+		return result, fmt.Errorf("No match outcomes are known for category %v", category)
+	}
+	var reason string
+	for _, line := range strings.Split(string(output), "\n") {
+		if m := winnerRegex.FindStringSubmatch(line); m != nil {
+			result.Winner = m[1]
+		}
+		if m := roundRegex.FindStringSubmatch(line); m != nil {
+			result.Rounds, _ = strconv.Atoi(m[1])
+		}
+		if m := reasonRegex.FindStringSubmatch(line); m != nil {
+			reason = strings.TrimSpace(m[1])
+		}
+	}
+	if len(replay) > 0 {
+		if summary, err := readReplaySummary(replay); err != nil {
+			return result, err
+		} else {
+			if result.Winner == "" {
+				result.Winner = summary.Winner
+			} else if summary.Winner != "" && summary.Winner != result.Winner {
+				return result, fmt.Errorf("Match output winner %v does not match replay winner %v", result.Winner, summary.Winner)
+			}
+			if summary.Rounds > 0 {
+				result.Rounds = summary.Rounds
+			}
+		}
+	}
+	if result.Winner == "" {
+		return result, fmt.Errorf("No winner found in match output")
+	} else if reason == "" {
+		return result, fmt.Errorf("No reason found in match output")
+	}
+	for _, outcome := range outcomes {
+		if outcome.Pattern.MatchString(reason) {
+			result.ReasonCode = outcome.Code
+			result.TiebreakTier = outcome.Tier
+			if outcome.Tier == 0 {
+				result.Reason = ReasonVictory
+			} else {
+				result.Reason = ReasonTie
+			}
+			return result, nil
+		}
+	}
+	return result, &UnrecognisedReasonError{category, reason}
+}
+
+type replaySummary struct {
+	Winner string
+	Rounds int
+}
+
+// Counts the rounds and finds the winner of a gzipped replay without decoding every signal
+func readReplaySummary(replay []byte) (replaySummary, error) {
+	var summary replaySummary
+	reader, err := gzip.NewReader(bytes.NewReader(replay))
+	if err != nil {
+		return summary, err
+	}
+	decoder := xml.NewDecoder(reader)
+	for {
+		if token, err := decoder.Token(); err == io.EOF {
+			return summary, nil
+		} else if err != nil {
+			return summary, err
+		} else if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "ser.RoundDelta":
+				summary.Rounds++
+			case "ser.MatchFooter":
+				for _, attr := range start.Attr {
+					if attr.Name.Local == "winner" {
+						summary.Winner = attr.Value
+					}
+				}
+			}
+		}
+	}
+}
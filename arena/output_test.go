@@ -0,0 +1,105 @@
+package arena
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The logs in testdata are not captured from the engine, which cannot run without the battlecode
+// tars. Each holds only the [java] lines of a match, rebuilt from the strings the engine prints.
+// A captured log can replace one from the engine output of a played match, served by /match/logs.
+var outputTests = []struct {
+	category string
+	log      string
+	replay   string
+	result   MatchResult
+}{
+	{"battlecode2014", "battlecode2014_milk.log", "", MatchResult{WinnerA, ReasonVictory, ReasonCodeMilk, 1742, 0, nil, MatchLogs{}}},
+	{"battlecode2014", "battlecode2014_tiebreakers.log", "", MatchResult{WinnerA, ReasonTie, ReasonCodeTiebreakers, 2500, 1, nil, MatchLogs{}}},
+	{"battlecode2014", "battlecode2014_default.log", "", MatchResult{WinnerB, ReasonTie, ReasonCodeDefault, 2500, 2, nil, MatchLogs{}}},
+	{"battlecode2015", "battlecode2015_towers.log", "../simulator/battlecode2015/replay.xml.gz", MatchResult{WinnerB, ReasonTie, ReasonCodeTowers, 2000, 1, nil, MatchLogs{}}},
+	{"battlecode2015", "battlecode2015_arbitrary.log", "", MatchResult{WinnerA, ReasonTie, ReasonCodeArbitrary, 2000, 6, nil, MatchLogs{}}},
+	{"battlecode2016", "battlecode2016_destruction.log", "../simulator/battlecode2016/replay.xml.gz", MatchResult{WinnerB, ReasonVictory, ReasonCodeDestruction, 1254, 0, nil, MatchLogs{}}},
+	{"battlecode2016", "battlecode2016_parts.log", "", MatchResult{WinnerB, ReasonTie, ReasonCodeParts, 3000, 3, nil, MatchLogs{}}},
+}
+
+var outputErrorTests = []struct {
+	category string
+	log      string
+	replay   string
+}{
+	{"battlecode2016", "battlecode2016_unknown.log", ""},
+	{"battlecode2015", "battlecode2016_parts.log", ""},
+	{"battlecode2016", "battlecode2014_milk.log", "../simulator/battlecode2016/replay.xml.gz"},
+	{"unknown", "battlecode2016_parts.log", ""},
+}
+
+func readOutputTest(t *testutil.T, log, replay string) ([]byte, []byte) {
+	output, err := ioutil.ReadFile(filepath.Join("testdata", log))
+	t.CheckError(err)
+	if replay == "" {
+		return output, nil
+	}
+	bs, err := ioutil.ReadFile(replay)
+	t.CheckError(err)
+	return output, bs
+}
+
+func TestParseMatchOutput(test *testing.T) {
+	t := (*testutil.T)(test)
+	for _, tt := range outputTests {
+		output, replay := readOutputTest(t, tt.log, tt.replay)
+		if result, err := ParseMatchOutput(tt.category, output, replay); err != nil {
+			t.Error(tt.log, err)
+		} else if result.Winner != tt.result.Winner || result.Reason != tt.result.Reason || result.ReasonCode != tt.result.ReasonCode || result.Rounds != tt.result.Rounds || result.TiebreakTier != tt.result.TiebreakTier {
+			t.Errorf("%v: expected %+v, not %+v", tt.log, tt.result, result)
+		}
+	}
+}
+
+func TestParseMatchOutputErrors(test *testing.T) {
+	t := (*testutil.T)(test)
+	for _, tt := range outputErrorTests {
+		output, replay := readOutputTest(t, tt.log, tt.replay)
+		if result, err := ParseMatchOutput(tt.category, output, replay); err == nil {
+			t.Errorf("%v as %v: expected an error, not %+v", tt.log, tt.category, result)
+		}
+	}
+}
+
+func TestParseMatchOutputUnrecognisedReason(test *testing.T) {
+	t := (*testutil.T)(test)
+	output, replay := readOutputTest(t, "battlecode2016_unknown.log", "")
+	if _, err := ParseMatchOutput("battlecode2016", output, replay); err == nil {
+		t.ErrorNow("expected an unrecognised reason to be an error")
+	} else if _, ok := err.(*UnrecognisedReasonError); !ok {
+		t.ErrorNow("expected an unrecognised reason error, not", err)
+	}
+}
+
+func TestParseMatchOutputIgnoresTeamPrints(test *testing.T) {
+	t := (*testutil.T)(test)
+	output := []byte(strings.Join([]string{
+		"     [java] [A:ARCHON#1@1] [server] samplePlayer (A) wins (round 10)",
+		"     [java] [A:ARCHON#1@1] [server] Reason: The winning team won by destruction.",
+		"     [java] Reason: The winning team won by destruction.",
+		"     [java] [server]          samplePlayer (B) wins (round 3000)",
+		"     [java] [server] Reason: The winning team won on tiebreakers (more Parts)",
+	}, "\n"))
+	if result, err := ParseMatchOutput("battlecode2016", output, nil); err != nil {
+		t.ErrorNow(err)
+	} else if result.Winner != WinnerB || result.Rounds != 3000 || result.ReasonCode != ReasonCodeParts {
+		t.ErrorNow("expected the result printed by the engine, not", result)
+	}
+}
+
+func TestParseMatchOutputWithoutReason(test *testing.T) {
+	t := (*testutil.T)(test)
+	output := []byte("     [java] [server]          samplePlayer (A) wins (round 3000)\n")
+	if _, err := ParseMatchOutput("battlecode2016", output, nil); err == nil {
+		t.ErrorNow("expected missing reason to be an error")
+	}
+}
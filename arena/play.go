@@ -2,7 +2,8 @@ package arena
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime/debug"
+	"syscall"
 	"time"
 )
 
@@ -21,6 +23,12 @@ const (
 	WinnerB = "B"
 )
 
+// The wall-clock limit on a match when its category has no limit of its own
+const DefaultMatchTimeout = 30 * time.Minute
+
+// Returned by an arena when a match is killed for running past its time limit
+var ErrMatchTimeout = errors.New("Match exceeded its time limit")
+
 type MatchProperties struct {
 	MapName     string
 	MapSource   io.Reader
@@ -32,42 +40,79 @@ type MatchProperties struct {
 }
 
 type Arena interface {
-	RunMatch(properties MatchProperties, clock func() time.Time) (time.Time, MatchResult, error)
+	RunMatch(ctx context.Context, properties MatchProperties, clock func() time.Time) (time.Time, MatchResult, error)
 }
 
 type MatchResult struct {
-	Winner string `json:"winner"`
-	Reason string `json:"reason"`
-	Replay []byte `json:"-"`
+	Winner       string    `json:"winner"`
+	Reason       string    `json:"reason"`
+	ReasonCode   string    `json:"reason_code"`
+	Rounds       int       `json:"rounds"`
+	TiebreakTier int       `json:"tiebreak_tier"`
+	Replay       []byte    `json:"-"`
+	Logs         MatchLogs `json:"logs"`
 }
 
 type LocalArena struct {
 	ResourceDir string
+	Timeouts    map[string]time.Duration
+	Sandbox     *Sandbox
+	Cache       *BuildCache
+}
+
+// The wall-clock limit for a match in a category
+func (a LocalArena) MatchTimeout(category string) time.Duration {
+	if timeout, ok := a.Timeouts[category]; ok && timeout > 0 {
+		return timeout
+	} else {
+		return DefaultMatchTimeout
+	}
 }
 
-func (a LocalArena) RunMatch(p MatchProperties, clock func() time.Time) (time.Time, MatchResult, error) {
+func (a LocalArena) tempDir() (string, error) {
+	if a.Sandbox != nil {
+		return a.Sandbox.TempDir()
+	}
+	return ioutil.TempDir("", "battlecode")
+}
+
+// Checks out the players of a match into stageDir/<name>, see stagePlayers
+type Stager func(ctx context.Context, stageDir string, p MatchProperties) error
+
+func (a LocalArena) RunMatch(ctx context.Context, p MatchProperties, clock func() time.Time) (time.Time, MatchResult, error) {
+	var stage Stager
+	if a.Sandbox != nil || a.Cache != nil {
+		stage = stagePlayers
+	}
+	return a.RunStagedMatch(ctx, p, stage, clock)
+}
+
+// Plays a match with player sources provided by stage, or cloned by runMatch.sh when stage is nil.
+// Staged players are compiled through the build cache when the arena has one.
+func (a LocalArena) RunStagedMatch(ctx context.Context, p MatchProperties, stage Stager, clock func() time.Time) (time.Time, MatchResult, error) {
 	var result MatchResult
+	ctx, cancel := context.WithTimeout(ctx, a.MatchTimeout(p.Category))
+	defer cancel()
 	tarFile := "battlecode.tar"
-	mapFile, err := ioutil.TempFile(os.TempDir(), p.MapName)
+
+	tempDir, err := a.tempDir()
 	if err != nil {
 		return clock(), result, err
 	}
-	defer os.Remove(mapFile.Name())
-	if file, err := os.Create(mapFile.Name()); err != nil {
+	defer os.RemoveAll(tempDir)
+
+	// The map is kept inside the match directory so that it is visible to a sandboxed match
+	mapFile := filepath.Join(tempDir, "map_source.xml")
+	if file, err := os.Create(mapFile); err != nil {
 		return clock(), result, err
 	} else if _, err := io.Copy(file, p.MapSource); err != nil {
+		file.Close()
 		return clock(), result, err
 	} else {
 		file.Close()
 	}
 
-	tempDir, err := ioutil.TempDir("", "battlecode")
-	if err != nil {
-		return clock(), result, err
-	}
-	defer os.RemoveAll(tempDir)
-
-	cmd := exec.Command("./runMatch.sh",
+	args := []string{
 		"-r", tarFile,
 		"-d", tempDir,
 		"-p", p.PlayerRepo1,
@@ -75,34 +120,157 @@ func (a LocalArena) RunMatch(p MatchProperties, clock func() time.Time) (time.Ti
 		"-c", p.Commit1,
 		"-C", p.Commit2,
 		"-m", p.MapName,
-		"-M", mapFile.Name(),
-	)
+		"-M", mapFile,
+	}
+	if stage != nil {
+		stageDir := filepath.Join(tempDir, "staged")
+		if err := stage(ctx, stageDir, p); err != nil {
+			return clock(), result, err
+		}
+		args = append(args, "-s", stageDir)
+		if a.Cache != nil {
+			builtDir := filepath.Join(tempDir, "built")
+			if err := a.buildPlayers(ctx, p, tempDir, stageDir, builtDir); err != nil {
+				if buildErr, ok := err.(*BuildError); ok {
+					result.Logs = buildErr.Logs(p)
+				}
+				if ctx.Err() == context.DeadlineExceeded {
+					return clock(), result, ErrMatchTimeout
+				}
+				return clock(), result, err
+			}
+			args = append(args, "-b", builtDir)
+		}
+	}
+	cmd := exec.Command("./runMatch.sh", args...)
 	cmd.Dir = filepath.Join(a.ResourceDir, p.Category)
 	buffer := bytes.Buffer{}
+	output := bytes.Buffer{}
 	cmd.Stderr = &buffer
+	cmd.Stdout = &output
 	log.Println(cmd)
-	if out, err := cmd.Output(); err != nil {
+	if a.Sandbox != nil {
+		if cmd, err = a.Sandbox.Command(cmd, tempDir); err != nil {
+			return clock(), result, err
+		}
+	}
+	err = runProcessGroup(ctx, cmd)
+	out := output.Bytes()
+	engineOutput, readErr := ioutil.ReadFile(filepath.Join(tempDir, "output.log"))
+	result.Logs = NewMatchLogs(engineOutput, buffer.Bytes())
+	if err != nil {
 		debug.PrintStack()
 		log.Println("runMatch Error: ", string(buffer.Bytes()))
 		log.Println("runMatch Output: ", string(out))
+		if ctx.Err() == context.DeadlineExceeded {
+			return clock(), result, ErrMatchTimeout
+		}
 		return clock(), result, err
-	} else if err := json.NewDecoder(bytes.NewReader(out)).Decode(&result); err != nil {
+	} else if readErr != nil {
 		log.Println("runMatch Error: ", string(buffer.Bytes()))
-		return clock(), result, err
+		return clock(), result, readErr
 	} else if bs, err := ioutil.ReadFile(filepath.Join(tempDir, "replay.xml.gz")); err != nil {
 		log.Println("runMatch Error: ", string(buffer.Bytes()))
 		return clock(), result, err
+	} else if parsed, err := ParseMatchOutput(p.Category, engineOutput, bs); err != nil {
+		log.Println("runMatch Error: ", string(buffer.Bytes()))
+		return clock(), result, err
 	} else {
 		log.Println("runMatch Error: ", string(buffer.Bytes()))
 		log.Println("runMatch Output: ", string(out))
 		log.Println("bs length", len(bs))
-		result.Replay = bs
-		return clock(), result, nil
+		parsed.Replay = bs
+		parsed.Logs = result.Logs
+		return clock(), parsed, nil
+	}
+}
+
+// Copies each player's compiled classes from the build cache into builtDir/<name>, compiling those which are missing
+func (a LocalArena) buildPlayers(ctx context.Context, p MatchProperties, tempDir, stageDir, builtDir string) error {
+	name1, name2 := p.PlayerNames()
+	players := [][3]string{{p.PlayerRepo1, p.Commit1, name1}}
+	if name1 != name2 {
+		players = append(players, [3]string{p.PlayerRepo2, p.Commit2, name2})
+	}
+	for _, player := range players {
+		name := player[2]
+		build := func(dir string) error {
+			_, err := a.buildPlayer(ctx, p.Category, tempDir, filepath.Join(stageDir, name), name, dir)
+			return err
+		}
+		key := BuildKey(p.Category, player[0], player[1])
+		if name != PlayerName(player[0]) {
+			// A renamed package compiles to different classes than the commit's own package
+			key = BuildKey(p.Category, player[0]+"\x00"+name, player[1])
+		}
+		if err := a.Cache.CopyTo(key, filepath.Join(builtDir, name), build); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compiles a staged player with buildPlayer.sh and copies its classes into dir, returning the compiler output
+func (a LocalArena) buildPlayer(ctx context.Context, category, tempDir, sourceDir, name, dir string) (string, error) {
+	buildDir := filepath.Join(tempDir, "build_"+name)
+	defer os.RemoveAll(buildDir)
+	classesDir := filepath.Join(buildDir, "classes")
+	cmd := exec.Command("./buildPlayer.sh",
+		"-r", "battlecode.tar",
+		"-d", filepath.Join(buildDir, "battlecode"),
+		"-n", name,
+		"-s", sourceDir,
+		"-o", classesDir,
+	)
+	cmd.Dir = filepath.Join(a.ResourceDir, category)
+	output := bytes.Buffer{}
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	log.Println(cmd)
+	var err error
+	if a.Sandbox != nil {
+		if cmd, err = a.Sandbox.Command(cmd, tempDir); err != nil {
+			return "", err
+		}
+	}
+	if err := runProcessGroup(ctx, cmd); err != nil {
+		log.Println("buildPlayer Output: ", output.String())
+		if ctx.Err() != nil {
+			return output.String(), ctx.Err()
+		}
+		return output.String(), &BuildError{name, output.String(), err}
+	}
+	return output.String(), copyDir(classesDir, dir)
+}
+
+// Runs a command in its own process group, killing the whole group if the context expires
+func runProcessGroup(ctx context.Context, cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			log.Println("Failed to kill match process group:", err)
+		}
+		<-done
+		return ctx.Err()
 	}
 }
 
-func NewArena(resourceDir string) Arena {
-	return LocalArena{resourceDir}
+// Creates an arena which plays matches on this machine, inside the sandbox and with the build cache unless they are nil
+func NewArena(resourceDir string, timeouts map[string]time.Duration, sandbox *Sandbox, cache *BuildCache) Arena {
+	return LocalArena{resourceDir, timeouts, sandbox, cache}
 }
 
 type DummyArena struct {
@@ -111,6 +279,6 @@ type DummyArena struct {
 	Err    error
 }
 
-func (a DummyArena) RunMatch(p MatchProperties, clock func() time.Time) (time.Time, MatchResult, error) {
+func (a DummyArena) RunMatch(ctx context.Context, p MatchProperties, clock func() time.Time) (time.Time, MatchResult, error) {
 	return a.Finish, a.Result, a.Err
 }
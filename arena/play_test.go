@@ -2,6 +2,7 @@ package arena
 
 import (
 	"bytes"
+	"context"
 	"github.com/GlenKelley/battleref/testing"
 	"go/build"
 	"io/ioutil"
@@ -222,9 +223,9 @@ func runTestMatch(t *testutil.T, category, mapName string, sampleMap []byte, win
 	t.CheckError(err)
 	commitHash := strings.TrimSpace(string(bs))
 
-	arena := NewArena(resourceDir)
+	arena := NewArena(resourceDir, nil, nil, nil)
 	finishedTime := time.Now()
-	if finished, result, err := arena.RunMatch(MatchProperties{
+	if finished, result, err := arena.RunMatch(context.Background(), MatchProperties{
 		mapName,
 		bytes.NewReader(sampleMap),
 		category,
@@ -244,3 +245,104 @@ func runTestMatch(t *testutil.T, category, mapName string, sampleMap []byte, win
 		t.ErrorNow(len(result.Replay))
 	}
 }
+
+func hangingArena(t *testutil.T, timeout time.Duration) (LocalArena, func()) {
+	resourceDir, err := ioutil.TempDir(os.TempDir(), "hangingArena")
+	t.CheckError(err)
+	categoryDir := filepath.Join(resourceDir, "hanging")
+	t.CheckError(os.Mkdir(categoryDir, 0755))
+	script := "#! /bin/sh\nsleep 60 &\nsleep 60\n"
+	t.CheckError(ioutil.WriteFile(filepath.Join(categoryDir, "runMatch.sh"), []byte(script), 0755))
+	return LocalArena{resourceDir, map[string]time.Duration{"hanging": timeout}, nil, nil}, func() { os.RemoveAll(resourceDir) }
+}
+
+func TestRunMatchTimeout(test *testing.T) {
+	t := (*testutil.T)(test)
+	arena, cleanup := hangingArena(t, 100*time.Millisecond)
+	defer cleanup()
+	start := time.Now()
+	if _, _, err := arena.RunMatch(context.Background(), MatchProperties{MapName: "sampleMap", MapSource: bytes.NewReader(SampleMap), Category: "hanging"}, time.Now); err != ErrMatchTimeout {
+		t.ErrorNow("expected timeout, not", err)
+	} else if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.ErrorNow("match was not killed promptly", elapsed)
+	}
+}
+
+func TestRunMatchCancel(test *testing.T) {
+	t := (*testutil.T)(test)
+	arena, cleanup := hangingArena(t, time.Hour)
+	defer cleanup()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, _, err := arena.RunMatch(ctx, MatchProperties{MapName: "sampleMap", MapSource: bytes.NewReader(SampleMap), Category: "hanging"}, time.Now); err != context.Canceled {
+		t.ErrorNow("expected cancellation, not", err)
+	}
+}
+
+func TestMatchTimeout(test *testing.T) {
+	t := (*testutil.T)(test)
+	arena := LocalArena{"", map[string]time.Duration{"battlecode2016": time.Minute}, nil, nil}
+	t.ExpectEqual(arena.MatchTimeout("battlecode2016"), time.Minute)
+	t.ExpectEqual(arena.MatchTimeout("battlecode2015"), DefaultMatchTimeout)
+}
+
+// A runMatch.sh which checks it was given both compiled players, and a buildPlayer.sh which counts its builds
+const cachedRunMatch = `#! /bin/sh
+while getopts "r:d:p:P:c:C:m:M:s:b:" opt; do
+  case $opt in
+    d) DIR="$OPTARG" ;;
+    b) BUILT="$OPTARG" ;;
+  esac
+done
+test -f "$BUILT/glen/RobotPlayer.class" && test -f "$BUILT/kelley/RobotPlayer.class" || exit 1
+touch "$DIR/replay.xml.gz"
+echo "     [java] [server] glen (A) wins (round 2000)" > "$DIR/output.log"
+echo "     [java] [server] Reason: The winning team won by destruction." >> "$DIR/output.log"
+`
+
+const cachedBuildPlayer = `#! /bin/sh
+while getopts "r:d:n:s:o:" opt; do
+  case $opt in
+    s) SOURCE="$OPTARG" ;;
+    o) OUTPUT="$OPTARG" ;;
+  esac
+done
+test -f "$SOURCE/RobotPlayer.java" || exit 1
+echo build >> ../builds.log
+mkdir -p "$OUTPUT" && cp "$SOURCE/RobotPlayer.java" "$OUTPUT/RobotPlayer.class"
+`
+
+func TestRunMatchBuildCache(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "cachedArena")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	categoryDir := filepath.Join(root, "resources", "battlecode2014")
+	t.CheckError(os.MkdirAll(categoryDir, 0755))
+	t.CheckError(ioutil.WriteFile(filepath.Join(categoryDir, "runMatch.sh"), []byte(cachedRunMatch), 0755))
+	t.CheckError(ioutil.WriteFile(filepath.Join(categoryDir, "buildPlayer.sh"), []byte(cachedBuildPlayer), 0755))
+
+	stage := func(ctx context.Context, stageDir string, p MatchProperties) error {
+		for _, repo := range []string{p.PlayerRepo1, p.PlayerRepo2} {
+			dir := filepath.Join(stageDir, PlayerName(repo))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			} else if err := ioutil.WriteFile(filepath.Join(dir, "RobotPlayer.java"), []byte("package x;"), 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	arena := LocalArena{filepath.Join(root, "resources"), nil, nil, NewBuildCache(filepath.Join(root, "cache"), 0)}
+	for i := 0; i < 3; i++ {
+		properties := MatchProperties{"sampleMap", bytes.NewReader(SampleMap), "battlecode2014", "/repos/glen.git", "/repos/kelley.git", "abcdef", "012345"}
+		if _, _, err := arena.RunStagedMatch(context.Background(), properties, stage, time.Now); err != nil {
+			t.ErrorNow(err)
+		}
+	}
+	if bs, err := ioutil.ReadFile(filepath.Join(root, "resources", "builds.log")); err != nil {
+		t.ErrorNow(err)
+	} else if builds := strings.Count(string(bs), "build"); builds != 2 {
+		t.ErrorNow("expected each player to be built once, not", builds)
+	}
+}
@@ -0,0 +1,179 @@
+package arena
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The width and height in pixels of each map cell in a preview
+const PreviewCellSize = 10
+
+// Parts at which a preview draws the largest parts circle, as the replay viewer does
+const PreviewFullParts = 75
+
+// The sprite drawn for robots without their own
+const OtherSprite = "OTHER"
+
+// Sprites are tinted with their team's colour, zombies are green
+var TeamTints = map[string]color.NRGBA{
+	"A":       {255, 0, 0, 255},
+	"B":       {0, 0, 255, 255},
+	"NEUTRAL": {255, 255, 255, 255},
+	"ZOMBIE":  {0, 255, 0, 255},
+}
+
+var (
+	previewBackground = color.NRGBA{0, 0, 0, 255}
+	previewRubble     = color.NRGBA{0xAA, 0xAA, 0xAA, 255}
+	previewObstacle   = color.NRGBA{0xCC, 0xCC, 0xCC, 255}
+	previewParts      = color.NRGBA{0xCC, 0x7A, 0x00, 255}
+)
+
+// Renders PNG previews of maps with the replay viewer's sprites, each sprite named after its
+// robot type in lower case. A preview is kept for as long as the server runs, keyed by the map source.
+type MapPreviews struct {
+	SpriteDir string
+	mutex     sync.Mutex
+	sprites   map[string]image.Image
+	previews  map[string][]byte
+}
+
+func NewMapPreviews(spriteDir string) *MapPreviews {
+	return &MapPreviews{SpriteDir: spriteDir, sprites: map[string]image.Image{}, previews: map[string][]byte{}}
+}
+
+// A PNG preview of a map, rendered once for each distinct map source
+func (p *MapPreviews) Preview(category string, source []byte) ([]byte, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256(append([]byte(category+"\x00"), source...)))
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if preview, ok := p.previews[key]; ok {
+		return preview, nil
+	}
+	if category != "battlecode2016" {
+		return nil, fmt.Errorf("Previews are only drawn for battlecode2016 maps, not %v", category)
+	} else if err := ValidateMap(category, source); err != nil {
+		return nil, err
+	}
+	layout, err := ParseMapLayout(category, source)
+	if err != nil {
+		return nil, err
+	}
+	sprites := map[string]image.Image{}
+	for _, robotType := range append([]string{OtherSprite}, robotTypes(layout)...) {
+		if sprite, err := p.sprite(robotType); err != nil {
+			return nil, err
+		} else if sprite != nil {
+			sprites[robotType] = sprite
+		}
+	}
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, RenderMap(layout, sprites, PreviewCellSize)); err != nil {
+		return nil, err
+	}
+	p.previews[key] = buffer.Bytes()
+	return p.previews[key], nil
+}
+
+func robotTypes(layout MapLayout) []string {
+	types := []string{}
+	seen := map[string]bool{}
+	for _, robot := range layout.Robots {
+		if !seen[robot.Type] {
+			seen[robot.Type] = true
+			types = append(types, robot.Type)
+		}
+	}
+	return types
+}
+
+// The sprite of a robot type, nil when there is no sprite for it
+func (p *MapPreviews) sprite(robotType string) (image.Image, error) {
+	if sprite, ok := p.sprites[robotType]; ok {
+		return sprite, nil
+	}
+	file, err := os.Open(filepath.Join(p.SpriteDir, strings.ToLower(robotType)+".png"))
+	if os.IsNotExist(err) && robotType != OtherSprite {
+		p.sprites[robotType] = nil
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	sprite, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read the %v sprite: %v", robotType, err)
+	}
+	p.sprites[robotType] = sprite
+	return sprite, nil
+}
+
+// Draws a map's rubble as a grey heatmap, its parts as orange circles and its initial robots as their
+// sprites tinted by team. Robots without a sprite are drawn with the OTHER sprite, or as a square without one.
+func RenderMap(layout MapLayout, sprites map[string]image.Image, cellSize int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, layout.Width*cellSize, layout.Height*cellSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(previewBackground), image.ZP, draw.Src)
+	for y := 0; y < layout.Height; y++ {
+		for x := 0; x < layout.Width; x++ {
+			cell := image.Rect(x*cellSize, y*cellSize, (x+1)*cellSize, (y+1)*cellSize)
+			if rubble := layout.Rubble[y][x]; rubble >= layout.Obstruction {
+				fill(img, cell, previewObstacle, 0.5)
+			} else if rubble > 0 {
+				fill(img, cell, previewRubble, rubble*0.5/layout.Obstruction)
+			}
+			if parts := layout.Parts[y][x]; parts > 1 {
+				radius := math.Min(0.4, parts/PreviewFullParts) * float64(cellSize)
+				center := float64(cellSize) / 2
+				for py := 0; py < cellSize; py++ {
+					for px := 0; px < cellSize; px++ {
+						if dx, dy := float64(px)+0.5-center, float64(py)+0.5-center; dx*dx+dy*dy <= radius*radius {
+							fill(img, image.Rect(cell.Min.X+px, cell.Min.Y+py, cell.Min.X+px+1, cell.Min.Y+py+1), previewParts, 1)
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, robot := range layout.Robots {
+		tint, ok := TeamTints[robot.Team]
+		if !ok {
+			tint = TeamTints["ZOMBIE"]
+		}
+		cell := image.Rect(robot.X*cellSize, robot.Y*cellSize, (robot.X+1)*cellSize, (robot.Y+1)*cellSize)
+		sprite := sprites[robot.Type]
+		if sprite == nil {
+			sprite = sprites[OtherSprite]
+		}
+		if sprite == nil {
+			fill(img, cell.Inset(cellSize/5), tint, 1)
+			continue
+		}
+		bounds := sprite.Bounds()
+		for py := 0; py < cellSize; py++ {
+			for px := 0; px < cellSize; px++ {
+				c := color.NRGBAModel.Convert(sprite.At(bounds.Min.X+px*bounds.Dx()/cellSize, bounds.Min.Y+py*bounds.Dy()/cellSize)).(color.NRGBA)
+				tinted := color.NRGBA{uint8(int(c.R) * int(tint.R) / 255), uint8(int(c.G) * int(tint.G) / 255), uint8(int(c.B) * int(tint.B) / 255), 255}
+				fill(img, image.Rect(cell.Min.X+px, cell.Min.Y+py, cell.Min.X+px+1, cell.Min.Y+py+1), tinted, float64(c.A)/255)
+			}
+		}
+	}
+	return img
+}
+
+// Blends a colour over a rectangle with an opacity between 0 and 1
+func fill(img draw.Image, r image.Rectangle, c color.NRGBA, alpha float64) {
+	c.A = uint8(math.Max(0, math.Min(1, alpha)) * float64(c.A))
+	if c.A > 0 {
+		draw.Draw(img, r, image.NewUniform(c), image.ZP, draw.Over)
+	}
+}
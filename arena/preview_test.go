@@ -0,0 +1,57 @@
+package arena
+
+import (
+	"bytes"
+	"github.com/GlenKelley/battleref/testing"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderMap(test *testing.T) {
+	t := (*testutil.T)(test)
+	layout := newMapLayout(3, 1, RubbleObstruction)
+	layout.Rubble[0][0] = RubbleObstruction
+	layout.Parts[0][1] = PreviewFullParts
+	layout.Robots = append(layout.Robots, MapRobot{2, 0, "ARCHON", "B"})
+	img := RenderMap(layout, map[string]image.Image{}, PreviewCellSize)
+	t.ExpectEqual(img.Bounds(), image.Rect(0, 0, 3*PreviewCellSize, PreviewCellSize))
+
+	center := PreviewCellSize / 2
+	// Obstructing rubble is half opaque over the black background
+	t.ExpectEqual(img.At(center, center), color.RGBA{101, 101, 101, 255})
+	t.ExpectEqual(img.At(PreviewCellSize+center, center), color.RGBA{0xCC, 0x7A, 0x00, 255})
+	t.ExpectEqual(img.At(PreviewCellSize+1, 0), color.RGBA{0, 0, 0, 255})
+	t.ExpectEqual(img.At(2*PreviewCellSize+center, center), color.RGBA{0, 0, 255, 255})
+}
+
+func TestMapPreview(test *testing.T) {
+	t := (*testutil.T)(test)
+	source, err := ioutil.ReadFile(filepath.Join("internal", "categories", "battlecode2016", "maps", "6147.xml"))
+	t.CheckError(err)
+	layout, err := ParseMapLayout("battlecode2016", source)
+	t.CheckError(err)
+
+	previews := NewMapPreviews(filepath.Join("..", "internal", "web", "images"))
+	preview, err := previews.Preview("battlecode2016", source)
+	t.CheckError(err)
+	img, err := png.Decode(bytes.NewReader(preview))
+	t.CheckError(err)
+	t.ExpectEqual(img.Bounds(), image.Rect(0, 0, layout.Width*PreviewCellSize, layout.Height*PreviewCellSize))
+	if _, ok := previews.sprites["ARCHON"]; !ok {
+		t.ErrorNow("expected the archon sprite to be drawn")
+	}
+
+	cached, err := previews.Preview("battlecode2016", source)
+	t.CheckError(err)
+	t.ExpectEqual(&cached[0], &preview[0])
+	if _, err := previews.Preview("battlecode2014", SampleMap); err == nil {
+		t.ErrorNow("expected only 2016 maps to be previewed")
+	}
+	if _, err := previews.Preview("battlecode2016", []byte("SourceFoo")); err == nil {
+		t.ErrorNow("expected an invalid map to be refused")
+	}
+}
@@ -0,0 +1,291 @@
+package arena
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How long a worker holds a job without sending a heartbeat
+const DefaultLeaseDuration = time.Minute
+
+var (
+	ErrUnknownWorker = errors.New("Unknown worker")
+	ErrLeaseLost     = errors.New("Job is not leased to this worker")
+)
+
+// A match handed out to a remote worker
+type RemoteJob struct {
+	Id        string `json:"id"`
+	Category  string `json:"category"`
+	MapName   string `json:"map_name"`
+	MapSource string `json:"map_source"`
+	Player1   string `json:"player1"`
+	Player2   string `json:"player2"`
+	Commit1   string `json:"commit1"`
+	Commit2   string `json:"commit2"`
+}
+
+type RemoteWorker struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// The outcome of a remote job as reported by the worker
+type RemoteResult struct {
+	Result      MatchResult `json:"result"`
+	Replay      []byte      `json:"replay"`
+	Error       string      `json:"error"`
+	Timeout     bool        `json:"timeout"`
+	BuildPlayer string      `json:"build_player,omitempty"`
+}
+
+type remoteJob struct {
+	RemoteJob
+	properties MatchProperties
+	worker     string
+	expires    time.Time
+	done       chan RemoteResult
+}
+
+// An arena which plays matches on remote workers. Jobs wait in a queue until a worker leases them,
+// and a job whose lease expires without a heartbeat is handed to the next worker which asks for one.
+type RemoteArena struct {
+	LeaseDuration time.Duration
+	Now           func() time.Time
+	mutex         sync.Mutex
+	nextId        int64
+	pending       []*remoteJob
+	jobs          map[string]*remoteJob
+	workers       map[string]*RemoteWorker
+}
+
+func NewRemoteArena(leaseDuration time.Duration) *RemoteArena {
+	if leaseDuration <= 0 {
+		leaseDuration = DefaultLeaseDuration
+	}
+	return &RemoteArena{
+		LeaseDuration: leaseDuration,
+		Now:           time.Now,
+		jobs:          map[string]*remoteJob{},
+		workers:       map[string]*RemoteWorker{},
+	}
+}
+
+// Creates an arena of the given type, where local is used for matches played on this machine
+func CreateArena(arenaType string, conf map[string]string, local Arena) (Arena, error) {
+	switch arenaType {
+	case "", ":local:":
+		return local, nil
+	case ":remote:":
+		lease := DefaultLeaseDuration
+		if value, ok := conf["lease"]; ok {
+			if duration, err := time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("Invalid lease duration: %v", err)
+			} else {
+				lease = duration
+			}
+		}
+		return NewRemoteArena(lease), nil
+	case ":simulated:":
+		return NewSimulatedArenaFromConf(conf)
+	default:
+		return nil, fmt.Errorf("Unknown arena type %v", arenaType)
+	}
+}
+
+// Queues the match for a worker and blocks until it has been played or the context ends
+func (a *RemoteArena) RunMatch(ctx context.Context, p MatchProperties, clock func() time.Time) (time.Time, MatchResult, error) {
+	source, err := ioutil.ReadAll(p.MapSource)
+	if err != nil {
+		return clock(), MatchResult{}, err
+	}
+	job := a.submit(p, string(source))
+	select {
+	case outcome := <-job.done:
+		if outcome.Timeout {
+			return clock(), outcome.Result, ErrMatchTimeout
+		} else if outcome.BuildPlayer != "" {
+			return clock(), outcome.Result, &BuildError{outcome.BuildPlayer, outcome.Result.Logs.TeamA + outcome.Result.Logs.TeamB, errors.New(outcome.Error)}
+		} else if outcome.Error != "" {
+			return clock(), outcome.Result, errors.New(outcome.Error)
+		}
+		outcome.Result.Replay = outcome.Replay
+		return clock(), outcome.Result, nil
+	case <-ctx.Done():
+		a.remove(job.Id)
+		return clock(), MatchResult{}, ctx.Err()
+	}
+}
+
+func (a *RemoteArena) submit(p MatchProperties, mapSource string) *remoteJob {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.nextId++
+	job := &remoteJob{
+		RemoteJob: RemoteJob{
+			strconv.FormatInt(a.nextId, 10),
+			p.Category,
+			p.MapName,
+			mapSource,
+			PlayerName(p.PlayerRepo1),
+			PlayerName(p.PlayerRepo2),
+			p.Commit1,
+			p.Commit2,
+		},
+		properties: p,
+		done:       make(chan RemoteResult, 1),
+	}
+	a.jobs[job.Id] = job
+	a.pending = append(a.pending, job)
+	return job
+}
+
+func (a *RemoteArena) remove(id string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.jobs, id)
+	for i, job := range a.pending {
+		if job.Id == id {
+			a.pending = append(a.pending[:i], a.pending[i+1:]...)
+			break
+		}
+	}
+}
+
+func (a *RemoteArena) Register(name string) (RemoteWorker, error) {
+	bs := make([]byte, 8)
+	if _, err := rand.Read(bs); err != nil {
+		return RemoteWorker{}, err
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	worker := &RemoteWorker{hex.EncodeToString(bs), name, a.Now()}
+	a.workers[worker.Id] = worker
+	return *worker, nil
+}
+
+// The registered workers, including any which have stopped sending heartbeats
+func (a *RemoteArena) Workers() []RemoteWorker {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	workers := []RemoteWorker{}
+	for _, worker := range a.workers {
+		workers = append(workers, *worker)
+	}
+	return workers
+}
+
+// Hands the next queued job to a worker, or nil if there is nothing to play
+func (a *RemoteArena) Lease(workerId string) (*RemoteJob, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	now := a.Now()
+	if err := a.touch(workerId, now); err != nil {
+		return nil, err
+	}
+	a.requeueExpired(now)
+	if len(a.pending) == 0 {
+		return nil, nil
+	}
+	job := a.pending[0]
+	a.pending = a.pending[1:]
+	job.worker = workerId
+	job.expires = now.Add(a.LeaseDuration)
+	leased := job.RemoteJob
+	return &leased, nil
+}
+
+// Extends a worker's lease on a job
+func (a *RemoteArena) Heartbeat(workerId, jobId string) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	now := a.Now()
+	if job, err := a.leased(workerId, jobId, now); err != nil {
+		return err
+	} else {
+		job.expires = now.Add(a.LeaseDuration)
+		return nil
+	}
+}
+
+// Records the outcome of a job and wakes the match waiting on it
+func (a *RemoteArena) Complete(workerId, jobId string, result RemoteResult) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if job, err := a.leased(workerId, jobId, a.Now()); err != nil {
+		return err
+	} else {
+		delete(a.jobs, jobId)
+		job.done <- result
+		return nil
+	}
+}
+
+// Writes a tar of a player's source at the commit used by a job
+func (a *RemoteArena) WriteSource(ctx context.Context, workerId, jobId string, player int, w io.Writer) error {
+	a.mutex.Lock()
+	job, err := a.leased(workerId, jobId, a.Now())
+	a.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	repo, commit := job.properties.PlayerRepo1, job.properties.Commit1
+	if player == 2 {
+		repo, commit = job.properties.PlayerRepo2, job.properties.Commit2
+	} else if player != 1 {
+		return fmt.Errorf("Invalid player %v", player)
+	}
+	stageDir, err := ioutil.TempDir("", "battleref_source")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stageDir)
+	if err := stagePlayer(ctx, repo, commit, filepath.Join(stageDir, "source")); err != nil {
+		return err
+	}
+	return writeTar(w, filepath.Join(stageDir, "source"))
+}
+
+func (a *RemoteArena) touch(workerId string, now time.Time) error {
+	if worker, ok := a.workers[workerId]; !ok {
+		return ErrUnknownWorker
+	} else {
+		worker.LastSeen = now
+		return nil
+	}
+}
+
+func (a *RemoteArena) leased(workerId, jobId string, now time.Time) (*remoteJob, error) {
+	if err := a.touch(workerId, now); err != nil {
+		return nil, err
+	}
+	a.requeueExpired(now)
+	if job, ok := a.jobs[jobId]; !ok || job.worker != workerId {
+		return nil, ErrLeaseLost
+	} else {
+		return job, nil
+	}
+}
+
+// Returns jobs held by workers which have stopped sending heartbeats to the front of the queue
+func (a *RemoteArena) requeueExpired(now time.Time) {
+	var expired []*remoteJob
+	for _, job := range a.jobs {
+		if job.worker != "" && now.After(job.expires) {
+			job.worker = ""
+			expired = append(expired, job)
+		}
+	}
+	a.pending = append(expired, a.pending...)
+}
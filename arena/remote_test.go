@@ -0,0 +1,166 @@
+package arena
+
+import (
+	"bytes"
+	"context"
+	"github.com/GlenKelley/battleref/testing"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type remoteMatch struct {
+	result MatchResult
+	err    error
+}
+
+func startRemoteMatch(ctx context.Context, remote *RemoteArena) chan remoteMatch {
+	done := make(chan remoteMatch, 1)
+	go func() {
+		properties := MatchProperties{"sampleMap", strings.NewReader("<map/>"), "battlecode2016", "/repos/glen.git", "/repos/kelley.git", "abcdef", "012345"}
+		_, result, err := remote.RunMatch(ctx, properties, time.Now)
+		done <- remoteMatch{result, err}
+	}()
+	return done
+}
+
+func waitForLease(t *testutil.T, remote *RemoteArena, workerId string) *RemoteJob {
+	for i := 0; i < 500; i++ {
+		if job, err := remote.Lease(workerId); err != nil {
+			t.ErrorNow(err)
+		} else if job != nil {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.ErrorNow("no job was queued")
+	return nil
+}
+
+func TestRemoteArenaLeaseExpiry(test *testing.T) {
+	t := (*testutil.T)(test)
+	remote := NewRemoteArena(time.Minute)
+	now := time.Now()
+	remote.Now = func() time.Time { return now }
+	done := startRemoteMatch(context.Background(), remote)
+	worker1, err := remote.Register("worker1")
+	t.CheckError(err)
+	worker2, err := remote.Register("worker2")
+	t.CheckError(err)
+
+	job := waitForLease(t, remote, worker1.Id)
+	t.ExpectEqual(job.Player1, "glen")
+	t.ExpectEqual(job.Player2, "kelley")
+	t.ExpectEqual(job.MapSource, "<map/>")
+	if other, err := remote.Lease(worker2.Id); err != nil || other != nil {
+		t.ErrorNow("expected no job for the second worker", other, err)
+	}
+	now = now.Add(30 * time.Second)
+	t.CheckError(remote.Heartbeat(worker1.Id, job.Id))
+	now = now.Add(2 * time.Minute)
+	if reassigned, err := remote.Lease(worker2.Id); err != nil {
+		t.ErrorNow(err)
+	} else if reassigned == nil || reassigned.Id != job.Id {
+		t.ErrorNow("expected the expired job to be reassigned", reassigned)
+	}
+	if err := remote.Heartbeat(worker1.Id, job.Id); err != ErrLeaseLost {
+		t.ErrorNow("expected lost lease, not", err)
+	} else if err := remote.Complete(worker1.Id, job.Id, RemoteResult{}); err != ErrLeaseLost {
+		t.ErrorNow("expected lost lease, not", err)
+	}
+	t.CheckError(remote.Complete(worker2.Id, job.Id, RemoteResult{Result: MatchResult{Winner: WinnerB, Reason: ReasonVictory}, Replay: []byte("replay")}))
+	if match := <-done; match.err != nil {
+		t.ErrorNow(match.err)
+	} else if match.result.Winner != WinnerB || string(match.result.Replay) != "replay" {
+		t.ErrorNow("unexpected result", match.result)
+	}
+}
+
+func TestRemoteArenaTimeout(test *testing.T) {
+	t := (*testutil.T)(test)
+	remote := NewRemoteArena(time.Minute)
+	done := startRemoteMatch(context.Background(), remote)
+	worker, err := remote.Register("worker")
+	t.CheckError(err)
+	job := waitForLease(t, remote, worker.Id)
+	t.CheckError(remote.Complete(worker.Id, job.Id, RemoteResult{Timeout: true}))
+	if match := <-done; match.err != ErrMatchTimeout {
+		t.ErrorNow("expected timeout, not", match.err)
+	}
+}
+
+func TestRemoteArenaBuildError(test *testing.T) {
+	t := (*testutil.T)(test)
+	remote := NewRemoteArena(time.Minute)
+	done := startRemoteMatch(context.Background(), remote)
+	worker, err := remote.Register("worker")
+	t.CheckError(err)
+	job := waitForLease(t, remote, worker.Id)
+	t.CheckError(remote.Complete(worker.Id, job.Id, RemoteResult{Error: "exit status 1", BuildPlayer: "kelley"}))
+	if match := <-done; match.err == nil {
+		t.ErrorNow("expected build error")
+	} else if buildErr, ok := match.err.(*BuildError); !ok || buildErr.Name != "kelley" {
+		t.ErrorNow("expected build error for kelley, not", match.err)
+	}
+}
+
+func TestRemoteArenaCancel(test *testing.T) {
+	t := (*testutil.T)(test)
+	remote := NewRemoteArena(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := startRemoteMatch(ctx, remote)
+	worker, err := remote.Register("worker")
+	t.CheckError(err)
+	job := waitForLease(t, remote, worker.Id)
+	cancel()
+	if match := <-done; match.err != context.Canceled {
+		t.ErrorNow("expected cancellation, not", match.err)
+	} else if err := remote.Heartbeat(worker.Id, job.Id); err != ErrLeaseLost {
+		t.ErrorNow("expected lost lease, not", err)
+	}
+}
+
+func TestRemoteArenaUnknownWorker(test *testing.T) {
+	t := (*testutil.T)(test)
+	remote := NewRemoteArena(time.Minute)
+	if _, err := remote.Lease("missing"); err != ErrUnknownWorker {
+		t.ErrorNow("expected unknown worker, not", err)
+	}
+}
+
+func TestCreateArena(test *testing.T) {
+	t := (*testutil.T)(test)
+	local := LocalArena{}
+	if arena, err := CreateArena("", nil, local); err != nil {
+		t.ErrorNow(err)
+	} else if _, ok := arena.(LocalArena); !ok {
+		t.ErrorNow("expected local arena", arena)
+	} else if arena, err := CreateArena(":remote:", map[string]string{"lease": "30s"}, local); err != nil {
+		t.ErrorNow(err)
+	} else if arena.(*RemoteArena).LeaseDuration != 30*time.Second {
+		t.ErrorNow("unexpected lease", arena)
+	} else if _, err := CreateArena(":unknown:", nil, local); err == nil {
+		t.ErrorNow("expected unknown arena type to fail")
+	}
+}
+
+func TestTarRoundTrip(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "tar")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	source := filepath.Join(root, "source")
+	t.CheckError(os.MkdirAll(filepath.Join(source, "src", "glen"), 0755))
+	t.CheckError(ioutil.WriteFile(filepath.Join(source, "src", "glen", "RobotPlayer.java"), []byte("package glen;"), 0644))
+	buffer := bytes.Buffer{}
+	t.CheckError(writeTar(&buffer, source))
+	t.CheckError(extractTar(&buffer, filepath.Join(root, "copy")))
+	if bs, err := ioutil.ReadFile(filepath.Join(root, "copy", "src", "glen", "RobotPlayer.java")); err != nil {
+		t.ErrorNow(err)
+	} else {
+		t.ExpectEqual(string(bs), "package glen;")
+	}
+}
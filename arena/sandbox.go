@@ -0,0 +1,81 @@
+package arena
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The environment variable which carries the sandbox configuration into a re-executed server binary
+const sandboxEnv = "BATTLEREF_SANDBOX"
+
+// The restrictions placed on a match which runs player code.
+// A sandboxed match can only write to its match directory and to the empty directories which cover
+// hidden paths, cannot see the hidden paths or the other directories of the work directory, and has no network access. Read only paths are kept
+// read only on hosts where the rest of the filesystem cannot be. Limits of zero are not enforced,
+// and MaxProcesses counts every process owned by the server's user.
+type Sandbox struct {
+	WorkDir       string   `json:"work_dir"`
+	HiddenPaths   []string `json:"hidden_paths"`
+	ReadOnlyPaths []string `json:"read_only_paths"`
+	CPUSeconds    uint64   `json:"cpu_seconds"`
+	MemoryBytes   uint64   `json:"memory_bytes"`
+	MaxProcesses  uint64   `json:"max_processes"`
+	MaxFileBytes  uint64   `json:"max_file_bytes"`
+}
+
+// The sandbox configuration handed to the re-executed binary
+type sandboxSpec struct {
+	Sandbox
+	MatchDir string `json:"match_dir"`
+}
+
+func (s *Sandbox) Validate() error {
+	if s.WorkDir == "" {
+		return errors.New("Sandbox requires a work_dir")
+	} else if !filepath.IsAbs(s.WorkDir) {
+		return fmt.Errorf("Sandbox work_dir %v is not an absolute path", s.WorkDir)
+	}
+	for _, path := range append(s.HiddenPaths, s.ReadOnlyPaths...) {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("Sandbox path %v is not an absolute path", path)
+		} else if path == "/" {
+			return errors.New("Sandbox cannot hide or protect the root directory")
+		}
+	}
+	for _, path := range s.ReadOnlyPaths {
+		if isSubPath(s.WorkDir, path) {
+			return fmt.Errorf("Sandbox read only path %v is inside work_dir %v, which is hidden", path, s.WorkDir)
+		}
+	}
+	for _, path := range s.HiddenPaths {
+		if isSubPath(path, s.WorkDir) {
+			return fmt.Errorf("Sandbox work_dir %v is inside hidden path %v", s.WorkDir, path)
+		}
+		for _, readOnly := range s.ReadOnlyPaths {
+			if isSubPath(path, readOnly) {
+				return fmt.Errorf("Sandbox read only path %v is inside hidden path %v", readOnly, path)
+			}
+		}
+	}
+	return nil
+}
+
+// Creates a new directory for a single match inside the work directory
+func (s *Sandbox) TempDir() (string, error) {
+	if err := os.MkdirAll(s.WorkDir, 0700); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(s.WorkDir, "battlecode")
+}
+
+func isSubPath(parent, path string) bool {
+	if rel, err := filepath.Rel(parent, path); err != nil {
+		return false
+	} else {
+		return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+	}
+}
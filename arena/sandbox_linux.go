@@ -0,0 +1,299 @@
+//go:build linux
+// +build linux
+
+package arena
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	rlimitNproc = 6
+
+	prSetNoNewPrivs   = 38
+	prCapAmbient      = 47
+	prCapAmbientClear = 4
+	lastCapability    = 63
+
+	hiddenDirOptions = "size=16m,mode=1777"
+)
+
+// Mount flags which cannot be cleared by a remount inside a user namespace
+var lockedMountFlags = map[int64]uintptr{
+	0x2:    syscall.MS_NOSUID,
+	0x4:    syscall.MS_NODEV,
+	0x8:    syscall.MS_NOEXEC,
+	0x400:  syscall.MS_NOATIME,
+	0x800:  syscall.MS_NODIRATIME,
+	0x1000: syscall.MS_RELATIME,
+}
+
+// The statfs flag of a read only filesystem
+const statReadOnly = 0x1
+
+// Wraps cmd so that it runs inside the sandbox. Every mount is made read only, so matchDir and the
+// empty directories over hidden paths are the only places it can write. The rest of the work directory,
+// which holds the directories of other matches, is hidden. The server binary is re-executed inside new user, mount, pid and network namespaces,
+// where SandboxInit restricts the process before running the original command.
+func (s *Sandbox) Command(cmd *exec.Cmd, matchDir string) (*exec.Cmd, error) {
+	spec, err := json.Marshal(sandboxSpec{*s, matchDir})
+	if err != nil {
+		return nil, err
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(env,
+		"HOME="+matchDir,
+		"BATTLEREF_LOG="+filepath.Join(matchDir, "arena.log"),
+		sandboxEnv+"="+string(spec),
+	)
+	sandboxed := &exec.Cmd{
+		Path:   "/proc/self/exe",
+		Args:   append([]string{"battleref-sandbox", cmd.Path}, cmd.Args[1:]...),
+		Env:    env,
+		Dir:    cmd.Dir,
+		Stdin:  cmd.Stdin,
+		Stdout: cmd.Stdout,
+		Stderr: cmd.Stderr,
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+				syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		},
+	}
+	return sandboxed, nil
+}
+
+// Must be called at the start of main by any binary which runs sandboxed matches.
+// When the binary has been re-executed by Sandbox.Command this never returns.
+func SandboxInit() {
+	config := os.Getenv(sandboxEnv)
+	if config == "" {
+		return
+	}
+	runtime.LockOSThread()
+	if err := sandboxExec(config); err != nil {
+		fmt.Fprintln(os.Stderr, "Sandbox error:", err)
+		os.Exit(126)
+	}
+}
+
+func sandboxExec(config string) error {
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(config), &spec); err != nil {
+		return err
+	} else if err := os.Unsetenv(sandboxEnv); err != nil {
+		return err
+	} else if len(os.Args) < 2 {
+		return fmt.Errorf("No command to run")
+	} else if path, err := exec.LookPath(os.Args[1]); err != nil {
+		return err
+	} else if err := spec.mount(); err != nil {
+		return err
+	} else if err := spec.limit(); err != nil {
+		return err
+	} else if err := dropCapabilities(); err != nil {
+		return err
+	} else if err := installSeccompFilter(); err != nil {
+		return err
+	} else {
+		return syscall.Exec(path, os.Args[1:], os.Environ())
+	}
+}
+
+func (s sandboxSpec) mount() error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("Failed to make mounts private: %v", err)
+	} else if err := s.isolateMatchDir(); err != nil {
+		return err
+	}
+	for _, path := range s.ReadOnlyPaths {
+		if err := bindReadOnly(path); err != nil {
+			return err
+		}
+	}
+	if mounts, err := mountPoints(); err != nil {
+		return err
+	} else {
+		for _, path := range mounts {
+			if !isSubPath(s.MatchDir, path) {
+				if err := remountReadOnly(path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, path := range s.HiddenPaths {
+		if err := hide(path); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("Failed to mount /proc: %v", err)
+	}
+	// The working directory was entered before the mounts, so it is entered again through them
+	if wd, err := os.Getwd(); err != nil {
+		return err
+	} else {
+		return os.Chdir(wd)
+	}
+}
+
+// Covers the work directory with an empty tmpfs, so the directories of other matches cannot be read,
+// and binds the match directory back in through a descriptor opened before it was covered
+func (s sandboxSpec) isolateMatchDir() error {
+	if !isSubPath(s.WorkDir, s.MatchDir) {
+		if err := syscall.Mount(s.MatchDir, s.MatchDir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("Failed to bind %v: %v", s.MatchDir, err)
+		}
+		return nil
+	}
+	dir, err := os.Open(s.MatchDir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err := syscall.Mount("tmpfs", s.WorkDir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, hiddenDirOptions); err != nil {
+		return fmt.Errorf("Failed to hide %v: %v", s.WorkDir, err)
+	} else if err := os.MkdirAll(s.MatchDir, 0700); err != nil {
+		return err
+	} else if err := syscall.Mount(fmt.Sprintf("/proc/self/fd/%v", dir.Fd()), s.MatchDir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("Failed to bind %v: %v", s.MatchDir, err)
+	}
+	return nil
+}
+
+func bindReadOnly(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	} else if err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("Failed to bind %v: %v", path, err)
+	} else {
+		return remountReadOnly(path)
+	}
+}
+
+// Makes the mount at path read only, keeping the flags which cannot be cleared.
+// Mounts which are already read only or which cannot be reached are left alone.
+func remountReadOnly(path string) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); os.IsNotExist(err) || os.IsPermission(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if int64(stat.Flags)&statReadOnly != 0 {
+		return nil
+	}
+	flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+	for statFlag, mountFlag := range lockedMountFlags {
+		if int64(stat.Flags)&statFlag != 0 {
+			flags |= mountFlag
+		}
+	}
+	if err := syscall.Mount(path, path, "", flags, ""); err != nil {
+		return fmt.Errorf("Failed to make %v read only: %v", path, err)
+	}
+	return nil
+}
+
+// The mount points of this mount namespace, parents before their children
+func mountPoints() ([]string, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mounts := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 4 {
+			mounts = append(mounts, unescapeMountPoint(fields[4]))
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// Mount points escape spaces, tabs, newlines and backslashes as octal
+func unescapeMountPoint(path string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if c, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// Covers a directory with an empty tmpfs, or a file with /dev/null
+func hide(path string) error {
+	if info, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if info.IsDir() {
+		if err := syscall.Mount("tmpfs", path, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, hiddenDirOptions); err != nil {
+			return fmt.Errorf("Failed to hide %v: %v", path, err)
+		}
+	} else if err := syscall.Mount("/dev/null", path, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("Failed to hide %v: %v", path, err)
+	}
+	return nil
+}
+
+func (s sandboxSpec) limit() error {
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, s.CPUSeconds},
+		{syscall.RLIMIT_AS, s.MemoryBytes},
+		{rlimitNproc, s.MaxProcesses},
+		{syscall.RLIMIT_FSIZE, s.MaxFileBytes},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := syscall.Setrlimit(limit.resource, &rlimit); err != nil {
+			return fmt.Errorf("Failed to set rlimit %v: %v", limit.resource, err)
+		}
+	}
+	return nil
+}
+
+// Ensures the command does not keep the capabilities this process holds in its user namespace
+func dropCapabilities() error {
+	for capability := uintptr(0); capability <= lastCapability; capability++ {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, capability, 0); errno == syscall.EINVAL {
+			break
+		} else if errno != 0 {
+			return fmt.Errorf("Failed to drop capability %v: %v", capability, errno)
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClear, 0); errno != 0 && errno != syscall.EINVAL {
+		return fmt.Errorf("Failed to clear ambient capabilities: %v", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("Failed to set no_new_privs: %v", errno)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package arena
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Sandboxes are only available on linux
+func (s *Sandbox) Command(cmd *exec.Cmd, matchDir string) (*exec.Cmd, error) {
+	return nil, errors.New("Sandboxed matches require linux")
+}
+
+func SandboxInit() {
+}
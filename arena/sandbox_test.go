@@ -0,0 +1,153 @@
+package arena
+
+import (
+	"bytes"
+	"context"
+	"github.com/GlenKelley/battleref/testing"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	SandboxInit()
+	os.Exit(m.Run())
+}
+
+func runSandboxed(t *testutil.T, sandbox *Sandbox, matchDir, script string) ([]byte, error) {
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Dir = matchDir
+	if cmd, err := sandbox.Command(cmd, matchDir); err != nil {
+		return nil, err
+	} else {
+		return cmd.CombinedOutput()
+	}
+}
+
+func TestSandbox(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "sandbox")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	workDir := filepath.Join(root, "work")
+	secretDir := filepath.Join(root, "secret")
+	readOnlyDir := filepath.Join(root, "readonly")
+	for _, dir := range []string{workDir, secretDir, readOnlyDir} {
+		t.CheckError(os.Mkdir(dir, 0755))
+	}
+	t.CheckError(ioutil.WriteFile(filepath.Join(secretDir, "repo"), []byte("secret"), 0644))
+	t.CheckError(ioutil.WriteFile(filepath.Join(readOnlyDir, "runMatch.sh"), []byte("true"), 0644))
+
+	sandbox := &Sandbox{WorkDir: workDir, HiddenPaths: []string{secretDir}, ReadOnlyPaths: []string{readOnlyDir}, MaxFileBytes: 1 << 20}
+	t.CheckError(sandbox.Validate())
+	matchDir, err := sandbox.TempDir()
+	t.CheckError(err)
+	otherDir, err := sandbox.TempDir()
+	t.CheckError(err)
+	t.CheckError(ioutil.WriteFile(filepath.Join(otherDir, "player.tar"), []byte("source"), 0644))
+	t.CheckError(ioutil.WriteFile(filepath.Join(matchDir, "player.tar"), []byte("source"), 0644))
+	if output, err := runSandboxed(t, sandbox, matchDir, "true"); err != nil {
+		test.Skip("Sandbox is unavailable on this machine:", err, string(output))
+	}
+
+	checks := map[string]string{
+		"hidden paths are empty":             "test ! -e " + filepath.Join(secretDir, "repo"),
+		"other matches are hidden":           "test ! -e " + filepath.Join(otherDir, "player.tar") + " && test -e player.tar",
+		"match directory is writable":        "echo ok > result && test \"$HOME\" = \"$PWD\"",
+		"read only paths cannot be modified": "! echo false 2>/dev/null > " + filepath.Join(readOnlyDir, "runMatch.sh"),
+		"host filesystem is read only":       "! touch " + filepath.Join(root, "outside") + " 2>/dev/null",
+		"network is loopback only":           "test \"$(grep -c : /proc/net/dev)\" = 1",
+		"processes of the server are hidden": "test $$ = 1",
+		"capabilities are dropped":           "grep -q 'CapEff:.0000000000000000' /proc/self/status",
+		"file size is limited":               "! head -c 2000000 /dev/zero > large",
+		"mounts are denied":                  "! mount -t tmpfs tmpfs " + matchDir + " 2>/dev/null",
+	}
+	for name, script := range checks {
+		if output, err := runSandboxed(t, sandbox, matchDir, script); err != nil {
+			t.Error(name, err, string(output))
+		}
+	}
+}
+
+func TestSandboxValidate(test *testing.T) {
+	t := (*testutil.T)(test)
+	for _, sandbox := range []Sandbox{
+		{},
+		{WorkDir: "relative"},
+		{WorkDir: "/var/tmp/battleref", HiddenPaths: []string{"/var/tmp"}},
+		{WorkDir: "/var/tmp/battleref", ReadOnlyPaths: []string{"/"}},
+		{WorkDir: "/var/tmp/battleref", ReadOnlyPaths: []string{"/var/tmp/battleref/arena"}},
+		{WorkDir: "/var/tmp/battleref", HiddenPaths: []string{"/srv/battleref"}, ReadOnlyPaths: []string{"/srv/battleref/arena"}},
+	} {
+		if err := sandbox.Validate(); err == nil {
+			t.Error("expected invalid sandbox", sandbox)
+		}
+	}
+	valid := Sandbox{WorkDir: "/var/tmp/battleref", HiddenPaths: []string{"/tmp", "/var/tmp/battleref2"}}
+	t.CheckError(valid.Validate())
+}
+
+func TestPlayerName(test *testing.T) {
+	t := (*testutil.T)(test)
+	t.ExpectEqual(PlayerName("/tmp/repos/glen.git"), "glen")
+	t.ExpectEqual(PlayerName("git@localhost:glen.git"), "glen")
+	t.ExpectEqual(PlayerName("git@localhost:players/glen"), "glen")
+}
+
+func TestStagePlayers(test *testing.T) {
+	t := (*testutil.T)(test)
+	root, err := ioutil.TempDir(os.TempDir(), "stage")
+	t.CheckError(err)
+	defer os.RemoveAll(root)
+	repoDir := filepath.Join(root, "glen")
+	t.CheckError(os.MkdirAll(filepath.Join(repoDir, "src", "glen"), 0755))
+	t.CheckError(ioutil.WriteFile(filepath.Join(repoDir, "src", "glen", "RobotPlayer.java"), []byte("package glen;"), 0644))
+	for _, args := range [][]string{{"init"}, {"add", "."}, {"commit", "-m", "init commit"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		RunCommand(t, cmd)
+	}
+	cmd := exec.Command("git", "log", "-n1", "--pretty=%H")
+	cmd.Dir = repoDir
+	bs, err := cmd.Output()
+	t.CheckError(err)
+	commit := string(bytes.TrimSpace(bs))
+
+	stageDir := filepath.Join(root, "staged")
+	t.CheckError(stagePlayers(context.Background(), stageDir, MatchProperties{PlayerRepo1: repoDir, PlayerRepo2: repoDir, Commit1: commit, Commit2: commit}))
+	if _, err := os.Stat(filepath.Join(stageDir, "glen", "src", "glen", "RobotPlayer.java")); err != nil {
+		t.ErrorNow(err)
+	} else if _, err := os.Stat(filepath.Join(stageDir, "glen", ".git")); !os.IsNotExist(err) {
+		t.ErrorNow("expected git history to be removed", err)
+	}
+
+	t.CheckError(ioutil.WriteFile(filepath.Join(repoDir, "src", "glen", "RobotPlayer.java"), []byte("package glen;\nimport glen.Nav;\nimport static glen.Nav.*;\n"), 0644))
+	for _, args := range [][]string{{"add", "."}, {"commit", "-m", "second commit"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		RunCommand(t, cmd)
+	}
+	cmd = exec.Command("git", "log", "-n1", "--pretty=%H")
+	cmd.Dir = repoDir
+	bs, err = cmd.Output()
+	t.CheckError(err)
+	selfPlay := MatchProperties{PlayerRepo1: repoDir, PlayerRepo2: repoDir, Commit1: string(bytes.TrimSpace(bs)), Commit2: commit}
+	otherDir := filepath.Join(root, "other")
+	t.CheckError(stagePlayers(context.Background(), otherDir, selfPlay))
+	if _, err := os.Stat(filepath.Join(otherDir, "glen", "src", "glen", "RobotPlayer.java")); err != nil {
+		t.ErrorNow(err)
+	} else if bs, err := ioutil.ReadFile(filepath.Join(otherDir, "glen_b", "src", "glen_b", "RobotPlayer.java")); err != nil {
+		t.ErrorNow(err)
+	} else {
+		t.ExpectEqual(string(bs), "package glen_b;")
+	}
+	selfPlay.Commit1, selfPlay.Commit2 = selfPlay.Commit2, selfPlay.Commit1
+	t.CheckError(stagePlayers(context.Background(), filepath.Join(root, "reversed"), selfPlay))
+	if bs, err := ioutil.ReadFile(filepath.Join(root, "reversed", "glen_b", "src", "glen_b", "RobotPlayer.java")); err != nil {
+		t.ErrorNow(err)
+	} else {
+		t.ExpectEqual(string(bs), "package glen_b;\nimport glen_b.Nav;\nimport static glen_b.Nav.*;\n")
+	}
+}
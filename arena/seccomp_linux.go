@@ -0,0 +1,102 @@
+//go:build linux
+// +build linux
+
+package arena
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	bpfLd   = 0x00
+	bpfJmp  = 0x05
+	bpfRet  = 0x06
+	bpfW    = 0x00
+	bpfAbs  = 0x20
+	bpfJeq  = 0x10
+	bpfJge  = 0x30
+	bpfJset = 0x40
+	bpfK    = 0x00
+
+	seccompModeFilter = 2
+	seccompRetKill    = 0x80000000
+	seccompRetErrno   = 0x00050000
+	seccompRetAllow   = 0x7fff0000
+
+	// Offsets into struct seccomp_data
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+
+	// Syscall numbers at or above this belong to the x32 abi
+	x32SyscallBit = 0x40000000
+
+	// CLONE_NEWNS | CLONE_NEWCGROUP | CLONE_NEWUTS | CLONE_NEWIPC | CLONE_NEWUSER | CLONE_NEWPID | CLONE_NEWNET
+	cloneNamespaceFlags = 0x7e020000
+)
+
+type sockFilter struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+type sockFprog struct {
+	Len    uint16
+	Filter *sockFilter
+}
+
+func bpfStmt(code uint16, k uint32) sockFilter {
+	return sockFilter{code, 0, 0, k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) sockFilter {
+	return sockFilter{code | bpfJmp | bpfK, jt, jf, k}
+}
+
+// Denies syscalls which could undo the sandbox or inspect other processes.
+// clone3 reports ENOSYS so that libc falls back to clone, whose flags can be checked.
+func seccompFilter() ([]sockFilter, error) {
+	if seccompArch == 0 {
+		return nil, fmt.Errorf("No seccomp filter is available for %v", runtime.GOARCH)
+	}
+	deny := bpfStmt(bpfRet|bpfK, seccompRetErrno|uint32(syscall.EPERM))
+	filter := []sockFilter{
+		bpfStmt(bpfLd|bpfW|bpfAbs, seccompDataArch),
+		bpfJump(bpfJeq, seccompArch, 1, 0),
+		bpfStmt(bpfRet|bpfK, seccompRetKill),
+		bpfStmt(bpfLd|bpfW|bpfAbs, seccompDataNr),
+		bpfJump(bpfJge, x32SyscallBit, 0, 1),
+		deny,
+	}
+	for _, nr := range seccompDenied {
+		filter = append(filter, bpfJump(bpfJeq, nr, 0, 1), deny)
+	}
+	filter = append(filter,
+		bpfJump(bpfJeq, sysClone3, 0, 1),
+		bpfStmt(bpfRet|bpfK, seccompRetErrno|uint32(syscall.ENOSYS)),
+		bpfJump(bpfJeq, sysClone, 0, 3),
+		bpfStmt(bpfLd|bpfW|bpfAbs, seccompDataArg0),
+		bpfJump(bpfJset, cloneNamespaceFlags, 0, 1),
+		deny,
+		bpfStmt(bpfRet|bpfK, seccompRetAllow),
+	)
+	return filter, nil
+}
+
+// Applies to the calling thread and is inherited across exec, so the caller must lock its thread
+func installSeccompFilter() error {
+	if filter, err := seccompFilter(); err != nil {
+		return err
+	} else {
+		program := sockFprog{uint16(len(filter)), &filter[0]}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, seccompModeFilter, uintptr(unsafe.Pointer(&program))); errno != 0 {
+			return fmt.Errorf("Failed to install seccomp filter: %v", errno)
+		}
+		return nil
+	}
+}
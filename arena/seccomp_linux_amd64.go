@@ -0,0 +1,54 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package arena
+
+import (
+	"syscall"
+)
+
+// AUDIT_ARCH_X86_64
+const seccompArch = 0xc000003e
+
+const (
+	sysClone  = syscall.SYS_CLONE
+	sysClone3 = 435
+)
+
+var seccompDenied = []uint32{
+	syscall.SYS_PTRACE,
+	syscall.SYS_MOUNT,
+	syscall.SYS_UMOUNT2,
+	syscall.SYS_PIVOT_ROOT,
+	syscall.SYS_CHROOT,
+	syscall.SYS_UNSHARE,
+	308, // setns
+	syscall.SYS_SWAPON,
+	syscall.SYS_SWAPOFF,
+	syscall.SYS_REBOOT,
+	syscall.SYS_KEXEC_LOAD,
+	320, // kexec_file_load
+	syscall.SYS_INIT_MODULE,
+	313, // finit_module
+	syscall.SYS_DELETE_MODULE,
+	syscall.SYS_IOPL,
+	syscall.SYS_IOPERM,
+	syscall.SYS_ACCT,
+	syscall.SYS_SETTIMEOFDAY,
+	syscall.SYS_CLOCK_SETTIME,
+	syscall.SYS_ADD_KEY,
+	syscall.SYS_REQUEST_KEY,
+	syscall.SYS_KEYCTL,
+	syscall.SYS_PERF_EVENT_OPEN,
+	303, // name_to_handle_at
+	304, // open_by_handle_at
+	310, // process_vm_readv
+	311, // process_vm_writev
+	321, // bpf
+	323, // userfaultfd
+	425, // io_uring_setup
+	428, // open_tree
+	429, // move_mount
+	432, // fsmount
+	433, // fspick
+}
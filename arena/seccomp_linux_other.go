@@ -0,0 +1,13 @@
+//go:build linux && !amd64
+// +build linux,!amd64
+
+package arena
+
+// Sandboxes refuse to start without a filter for the current architecture
+const (
+	seccompArch = 0
+	sysClone    = 0
+	sysClone3   = 0
+)
+
+var seccompDenied []uint32
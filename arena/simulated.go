@@ -0,0 +1,198 @@
+package arena
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/GlenKelley/battleref/simulator/battlecode2016"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Matches closer than this margin are decided on tiebreakers instead of by destruction
+const simulatedTieMargin = 0.05
+
+// Returned by a SimulatedArena for the share of matches given by its FailureRate
+var ErrSimulatedFailure = errors.New("Simulated arena failure")
+
+// An arena which plays no code, for running the server without Java or ant.
+// The winner of a match is decided by a hash of (Seed, Commit1, Commit2, MapName), weighted by the
+// Strength of each player, so replaying a match always gives the same result. Latency, failures and
+// timeouts are random, drawn from a source seeded with Seed.
+type SimulatedArena struct {
+	Seed        int64
+	Strengths   map[string]float64
+	Latency     time.Duration
+	Jitter      time.Duration
+	FailureRate float64
+	TimeoutRate float64
+	mutex       sync.Mutex
+	random      *rand.Rand
+}
+
+func NewSimulatedArena(seed int64) *SimulatedArena {
+	return &SimulatedArena{Seed: seed, Strengths: map[string]float64{}}
+}
+
+// Reads a simulated arena from the arena_conf properties, where strengths are written as "name=1.5,other=0.5"
+func NewSimulatedArenaFromConf(conf map[string]string) (*SimulatedArena, error) {
+	a := NewSimulatedArena(0)
+	for key, value := range conf {
+		var err error
+		switch key {
+		case "seed":
+			a.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "latency":
+			a.Latency, err = time.ParseDuration(value)
+		case "jitter":
+			a.Jitter, err = time.ParseDuration(value)
+		case "failure_rate":
+			a.FailureRate, err = strconv.ParseFloat(value, 64)
+		case "timeout_rate":
+			a.TimeoutRate, err = strconv.ParseFloat(value, 64)
+		case "strengths":
+			for _, pair := range strings.Split(value, ",") {
+				if parts := strings.SplitN(strings.TrimSpace(pair), "=", 2); len(parts) != 2 {
+					err = fmt.Errorf("expected name=strength, not %v", pair)
+				} else if strength, err2 := strconv.ParseFloat(parts[1], 64); err2 != nil || strength <= 0 {
+					err = fmt.Errorf("invalid strength %v", parts[1])
+				} else {
+					a.Strengths[parts[0]] = strength
+				}
+			}
+		default:
+			err = errors.New("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid simulated arena %v: %v", key, err)
+		}
+	}
+	return a, nil
+}
+
+// The strength of a player, looked up by commit and then by player name, defaulting to 1
+func (a *SimulatedArena) Strength(repoURL, commit string) float64 {
+	if strength, ok := a.Strengths[commit]; ok {
+		return strength
+	} else if strength, ok := a.Strengths[PlayerName(repoURL)]; ok {
+		return strength
+	}
+	return 1
+}
+
+func (a *SimulatedArena) RunMatch(ctx context.Context, p MatchProperties, clock func() time.Time) (time.Time, MatchResult, error) {
+	delay, roll := a.draw()
+	select {
+	case <-ctx.Done():
+		return clock(), MatchResult{}, ctx.Err()
+	case <-time.After(delay):
+	}
+	if roll < a.FailureRate {
+		return clock(), MatchResult{}, ErrSimulatedFailure
+	} else if roll < a.FailureRate+a.TimeoutRate {
+		return clock(), MatchResult{}, ErrMatchTimeout
+	}
+	result := a.Decide(p)
+	if replay, err := simulatedReplay(p, result); err != nil {
+		return clock(), MatchResult{}, err
+	} else {
+		result.Replay = replay
+		return clock(), result, nil
+	}
+}
+
+// The random latency of the next match and a roll deciding whether it fails
+func (a *SimulatedArena) draw() (time.Duration, float64) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.random == nil {
+		a.random = rand.New(rand.NewSource(a.Seed))
+	}
+	delay := a.Latency
+	if a.Jitter > 0 {
+		delay += time.Duration(a.random.Int63n(int64(a.Jitter)))
+	}
+	return delay, a.random.Float64()
+}
+
+// The outcome of a match, which depends only on the seed, the players' strengths, the commits and the map.
+// Team A wins with probability strengthA / (strengthA + strengthB).
+func (a *SimulatedArena) Decide(p MatchProperties) MatchResult {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%v\x00%v\x00%v\x00%v", a.Seed, p.Commit1, p.Commit2, p.MapName)))
+	roll := float64(binary.BigEndian.Uint64(hash[:8])>>11) / (1 << 53)
+	strengthA := a.Strength(p.PlayerRepo1, p.Commit1)
+	chanceA := strengthA / (strengthA + a.Strength(p.PlayerRepo2, p.Commit2))
+	result := MatchResult{Winner: WinnerB, Reason: ReasonVictory, ReasonCode: ReasonCodeDestruction}
+	if roll < chanceA {
+		result.Winner = WinnerA
+	}
+	if roll > chanceA-simulatedTieMargin && roll < chanceA+simulatedTieMargin {
+		result.Reason = ReasonTie
+		result.ReasonCode = ReasonCodeArchons
+		result.TiebreakTier = 1
+	}
+	result.Rounds = 200 + int(binary.BigEndian.Uint16(hash[8:10]))%2800
+	winner := p.PlayerRepo1
+	if result.Winner == WinnerB {
+		winner = p.PlayerRepo2
+	}
+	result.Logs = MatchLogs{Engine: fmt.Sprintf("[server] simulated match on %v\n[server] %v (%v) wins (round %v)", p.MapName, PlayerName(winner), result.Winner, result.Rounds)}
+	return result
+}
+
+// A gzipped battlecode2016 replay in which each team spawns an archon and the loser's archon dies on the last round
+func simulatedReplay(p MatchProperties, result MatchResult) ([]byte, error) {
+	teamA, teamB := bc2016.Team(WinnerA), bc2016.Team(WinnerB)
+	locA, locB := bc2016.MapLoc("0,0"), bc2016.MapLoc("29,29")
+	idA, idB := bc2016.RobotId(1), bc2016.RobotId(2)
+	archon := bc2016.RobotType("ARCHON")
+	parent := bc2016.RobotId(-1)
+	replay := bc2016.Replay{
+		StoredConstants: bc2016.StoredConstants{EngineVersion: "simulated"},
+		Header: bc2016.Header{MatchCount: 1, Map: bc2016.Map{
+			Width:  30,
+			Height: 30,
+			Origin: "0,0",
+			Rounds: result.Rounds,
+			Name:   p.MapName,
+			InitialRobots: []bc2016.InitialRobot{
+				{0, 0, string(archon), teamA},
+				{29, 29, string(archon), teamB},
+			},
+		}},
+		Metadata:  bc2016.Info{"header", bc2016.Team(PlayerName(p.PlayerRepo1)), bc2016.Team(PlayerName(p.PlayerRepo2)), bc2016.StringArray(p.MapName)},
+		Round:     make([]bc2016.Round, result.Rounds),
+		GameStats: bc2016.GameStats{bc2016.Win0},
+		Footer:    bc2016.Footer{Winner: bc2016.Team(result.Winner)},
+	}
+	replay.Round[0].Signals = []bc2016.Signal{
+		{XMLName: xml.Name{Local: "sig.SpawnSignal"}, RobotId: &idA, ParentId: &parent, Loc: &locA, Type: &archon, Team: &teamA},
+		{XMLName: xml.Name{Local: "sig.SpawnSignal"}, RobotId: &idB, ParentId: &parent, Loc: &locB, Type: &archon, Team: &teamB},
+	}
+	if result.Reason == ReasonTie {
+		replay.GameStats.DominationFactor = bc2016.Win3
+	} else {
+		loser := &idB
+		if result.Winner == WinnerB {
+			loser = &idA
+		}
+		last := &replay.Round[len(replay.Round)-1]
+		last.Signals = append(last.Signals, bc2016.Signal{XMLName: xml.Name{Local: "sig.DeathSignal"}, ObjectId: loser})
+	}
+	buffer := bytes.Buffer{}
+	gz := gzip.NewWriter(&buffer)
+	if err := xml.NewEncoder(gz).Encode(replay); err != nil {
+		return nil, err
+	} else if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
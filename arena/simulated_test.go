@@ -0,0 +1,93 @@
+package arena
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/GlenKelley/battleref/simulator"
+	"github.com/GlenKelley/battleref/testing"
+	"strings"
+	"testing"
+	"time"
+)
+
+func simulatedMatch(mapName string) MatchProperties {
+	return MatchProperties{mapName, strings.NewReader(""), "battlecode2016", "/repos/glen.git", "/repos/kelley.git", "abcdef", "012345"}
+}
+
+func TestSimulatedArenaDeterministic(test *testing.T) {
+	t := (*testutil.T)(test)
+	arena := NewSimulatedArena(7)
+	for i := 0; i < 10; i++ {
+		mapName := fmt.Sprint("map", i)
+		if _, result1, err := arena.RunMatch(context.Background(), simulatedMatch(mapName), time.Now); err != nil {
+			t.ErrorNow(err)
+		} else if _, result2, err := NewSimulatedArena(7).RunMatch(context.Background(), simulatedMatch(mapName), time.Now); err != nil {
+			t.ErrorNow(err)
+		} else if result1.Winner != result2.Winner || result1.Reason != result2.Reason || result1.Rounds != result2.Rounds {
+			t.ErrorNow("expected the same result, not", result1, result2)
+		}
+	}
+}
+
+func TestSimulatedArenaStrength(test *testing.T) {
+	t := (*testutil.T)(test)
+	arena := NewSimulatedArena(7)
+	arena.Strengths["kelley"] = 20
+	wins := 0
+	for i := 0; i < 100; i++ {
+		if arena.Decide(simulatedMatch(fmt.Sprint("map", i))).Winner == WinnerB {
+			wins++
+		}
+	}
+	if wins < 85 {
+		t.ErrorNow("expected the stronger player to win most matches, not", wins)
+	}
+}
+
+func TestSimulatedArenaReplay(test *testing.T) {
+	t := (*testutil.T)(test)
+	if _, result, err := NewSimulatedArena(0).RunMatch(context.Background(), simulatedMatch("sampleMap"), time.Now); err != nil {
+		t.ErrorNow(err)
+	} else if unzipped, err := gzip.NewReader(bytes.NewReader(result.Replay)); err != nil {
+		t.ErrorNow(err)
+	} else if _, err := simulator.NewReplay(unzipped, "battlecode2016"); err != nil {
+		t.ErrorNow(err)
+	}
+}
+
+func TestSimulatedArenaFailures(test *testing.T) {
+	t := (*testutil.T)(test)
+	arena := NewSimulatedArena(0)
+	arena.FailureRate = 1
+	if _, _, err := arena.RunMatch(context.Background(), simulatedMatch("sampleMap"), time.Now); err != ErrSimulatedFailure {
+		t.ErrorNow("expected failure, not", err)
+	}
+	arena.FailureRate = 0
+	arena.TimeoutRate = 1
+	if _, _, err := arena.RunMatch(context.Background(), simulatedMatch("sampleMap"), time.Now); err != ErrMatchTimeout {
+		t.ErrorNow("expected timeout, not", err)
+	}
+	arena.TimeoutRate = 0
+	arena.Latency = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := arena.RunMatch(ctx, simulatedMatch("sampleMap"), time.Now); err != context.Canceled {
+		t.ErrorNow("expected cancellation, not", err)
+	}
+}
+
+func TestCreateSimulatedArena(test *testing.T) {
+	t := (*testutil.T)(test)
+	if arena, err := CreateArena(":simulated:", map[string]string{"seed": "3", "latency": "1s", "strengths": "glen=2, kelley=0.5"}, LocalArena{}); err != nil {
+		t.ErrorNow(err)
+	} else if simulated, ok := arena.(*SimulatedArena); !ok {
+		t.ErrorNow("expected simulated arena", arena)
+	} else if simulated.Seed != 3 || simulated.Latency != time.Second || simulated.Strength("/repos/glen.git", "abc") != 2 || simulated.Strength("/repos/kelley.git", "abc") != 0.5 {
+		t.ErrorNow("unexpected settings", simulated)
+	}
+	if _, err := CreateArena(":simulated:", map[string]string{"strengths": "glen"}, LocalArena{}); err == nil {
+		t.ErrorNow("expected invalid strength error")
+	}
+}
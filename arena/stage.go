@@ -0,0 +1,94 @@
+package arena
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Appended to the package of side B when a player plays a different commit of itself,
+// so the two commits are compiled and loaded in separate namespaces
+const SelfPlaySuffix = "_b"
+
+// The player name runMatch.sh derives from a repository url
+func PlayerName(repoURL string) string {
+	name := filepath.Base(strings.TrimSuffix(repoURL, ".git"))
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// Whether a match is between two different commits of the same player
+func (p MatchProperties) SelfPlay() bool {
+	return p.PlayerRepo1 == p.PlayerRepo2 && p.Commit1 != p.Commit2
+}
+
+// The team names runMatch.sh plays the two sides of a match as, which are also their package names
+func (p MatchProperties) PlayerNames() (string, string) {
+	name1, name2 := PlayerName(p.PlayerRepo1), PlayerName(p.PlayerRepo2)
+	if p.SelfPlay() {
+		name2 += SelfPlaySuffix
+	}
+	return name1, name2
+}
+
+// Checks out each player's commit into stageDir/<name> without its git history,
+// so a sandboxed match never needs access to the player repositories.
+func stagePlayers(ctx context.Context, stageDir string, p MatchProperties) error {
+	name1, name2 := p.PlayerNames()
+	if err := stagePlayer(ctx, p.PlayerRepo1, p.Commit1, filepath.Join(stageDir, name1)); err != nil {
+		return err
+	} else if name1 == name2 {
+		return nil
+	} else if err := stagePlayer(ctx, p.PlayerRepo2, p.Commit2, filepath.Join(stageDir, name2)); err != nil {
+		return err
+	} else if p.SelfPlay() {
+		return renamePackage(filepath.Join(stageDir, name2), PlayerName(p.PlayerRepo2), name2)
+	}
+	return nil
+}
+
+// Moves a staged player from package from to package to, rewriting its package and import declarations.
+// Fully qualified references to the player's own classes outside of imports are not rewritten.
+func renamePackage(dir, from, to string) error {
+	if _, err := os.Stat(filepath.Join(dir, "src", from)); err == nil {
+		if err := os.Rename(filepath.Join(dir, "src", from), filepath.Join(dir, "src", to)); err != nil {
+			return err
+		}
+	}
+	declaration := regexp.MustCompile(`(?m)^(\s*(?:package|import(?:\s+static)?)\s+)` + regexp.QuoteMeta(from) + `\b`)
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".java" {
+			return err
+		} else if bs, err := ioutil.ReadFile(path); err != nil {
+			return err
+		} else {
+			return ioutil.WriteFile(path, declaration.ReplaceAll(bs, []byte("${1}"+to)), info.Mode())
+		}
+	})
+}
+
+func stagePlayer(ctx context.Context, repoURL, commit, dir string) error {
+	if err := runGit(ctx, "", "clone", "--quiet", "--no-checkout", repoURL, dir); err != nil {
+		return err
+	} else if err := runGit(ctx, dir, "checkout", "--quiet", commit); err != nil {
+		return err
+	} else {
+		return os.RemoveAll(filepath.Join(dir, ".git"))
+	}
+}
+
+func runGit(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %v failed: %v %v", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
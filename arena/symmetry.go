@@ -0,0 +1,336 @@
+package arena
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/GlenKelley/battleref/simulator/battlecode2016"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The symmetries a map can have, each mapping a cell to its mirror cell
+const (
+	SymmetryRotational   = "rotational"
+	SymmetryHorizontal   = "horizontal"
+	SymmetryVertical     = "vertical"
+	SymmetryDiagonal     = "diagonal"
+	SymmetryAntiDiagonal = "anti_diagonal"
+	SymmetryNone         = "none"
+)
+
+// Rubble at or above this stops robots walking through a 2016 cell
+const RubbleObstruction = 100
+
+// The robots each team starts from
+var StartingRobotTypes = map[string]bool{
+	"HQ":     true,
+	"ARCHON": true,
+}
+
+// A map reduced to the cells the analyzer compares, indexed [y][x].
+// Void terrain of 2014 and 2015 maps is rubble which obstructs, and the cell values are parts.
+type MapLayout struct {
+	Width       int
+	Height      int
+	Rubble      [][]float64
+	Parts       [][]float64
+	Robots      []MapRobot
+	Obstruction float64
+}
+
+type MapRobot struct {
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	Type string `json:"type"`
+	Team string `json:"team"`
+}
+
+// A cell which differs from its mirror cell
+type MapAsymmetry struct {
+	Layer   string `json:"layer"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	MirrorX int    `json:"mirror_x"`
+	MirrorY int    `json:"mirror_y"`
+	Value   string `json:"value"`
+	Mirror  string `json:"mirror"`
+}
+
+// How far a team's starting robots are from the parts of a map.
+// Nearest parts is the path distance from each start to the closest parts, -1 when none can be reached.
+// Claimed parts are the parts a team can reach before the other team, shared when both are as close.
+type TeamFairness struct {
+	Starts       []MapRobot `json:"starts"`
+	NearestParts []int      `json:"nearest_parts"`
+	ClaimedParts float64    `json:"claimed_parts"`
+}
+
+// The symmetry of a map and how fairly its parts are spread between the teams.
+// Symmetries lists every symmetry the map has exactly. When it is empty, symmetry is the closest
+// one and asymmetries are the cells which break it.
+type MapAnalysis struct {
+	Width          int                     `json:"width"`
+	Height         int                     `json:"height"`
+	Symmetry       string                  `json:"symmetry"`
+	Symmetries     []string                `json:"symmetries"`
+	Asymmetries    []MapAsymmetry          `json:"asymmetries"`
+	Teams          map[string]TeamFairness `json:"teams"`
+	TotalParts     float64                 `json:"total_parts"`
+	PartsImbalance float64                 `json:"parts_imbalance"`
+}
+
+type symmetry struct {
+	name   string
+	square bool
+	mirror func(width, height, x, y int) (int, int)
+}
+
+var symmetries = []symmetry{
+	{SymmetryRotational, false, func(w, h, x, y int) (int, int) { return w - 1 - x, h - 1 - y }},
+	{SymmetryHorizontal, false, func(w, h, x, y int) (int, int) { return w - 1 - x, y }},
+	{SymmetryVertical, false, func(w, h, x, y int) (int, int) { return x, h - 1 - y }},
+	{SymmetryDiagonal, true, func(w, h, x, y int) (int, int) { return y, x }},
+	{SymmetryAntiDiagonal, true, func(w, h, x, y int) (int, int) { return w - 1 - y, h - 1 - x }},
+}
+
+// Validates a map then reports its symmetry and fairness
+func AnalyzeMap(category string, source []byte) (MapAnalysis, error) {
+	if err := ValidateMap(category, source); err != nil {
+		return MapAnalysis{}, err
+	} else if layout, err := ParseMapLayout(category, source); err != nil {
+		return MapAnalysis{}, err
+	} else {
+		return layout.Analyze(), nil
+	}
+}
+
+// Parses a map of a category into its layout
+func ParseMapLayout(category string, source []byte) (MapLayout, error) {
+	switch category {
+	case "battlecode2016":
+		var objectMap ObjectMap
+		if err := xml.Unmarshal(source, &objectMap); err != nil {
+			return MapLayout{}, err
+		}
+		m := objectMap.Map
+		layout := newMapLayout(m.Width, m.Height, RubbleObstruction)
+		for _, grid := range []struct {
+			values []bc2016.FloatArray2D
+			cells  [][]float64
+		}{{m.InitialRubble, layout.Rubble}, {m.InitialParts, layout.Parts}} {
+			for y := 0; y < m.Height && y < len(grid.values); y++ {
+				for x, value := range rowValues(grid.values[y]) {
+					if x < m.Width {
+						grid.cells[y][x], _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
+					}
+				}
+			}
+		}
+		for _, robot := range m.InitialRobots {
+			layout.Robots = append(layout.Robots, MapRobot{robot.OriginOffsetX, robot.OriginOffsetY, robot.Type, string(robot.Team)})
+		}
+		return layout, nil
+	case "battlecode2014", "battlecode2015":
+		var textMap TextMap
+		if err := xml.Unmarshal(source, &textMap); err != nil {
+			return MapLayout{}, err
+		}
+		layout := newMapLayout(textMap.Width, textMap.Height, 1)
+		symbols := map[string]MapSymbol{}
+		for _, symbol := range textMap.Symbols {
+			symbols[symbol.Character] = symbol
+		}
+		y := 0
+		for _, row := range strings.Split(textMap.Data, "\n") {
+			if row = strings.TrimSpace(row); row == "" || y >= textMap.Height {
+				continue
+			}
+			for x, cell := range strings.Fields(row) {
+				if x >= textMap.Width {
+					break
+				}
+				character := strings.TrimRight(cell, "0123456789.")
+				symbol := symbols[character]
+				layout.Parts[y][x], _ = strconv.ParseFloat(cell[len(character):], 64)
+				if symbol.Terrain == "VOID" {
+					layout.Rubble[y][x] = 1
+				}
+				if symbol.Type != "" && symbol.Type != "TERRAIN" {
+					layout.Robots = append(layout.Robots, MapRobot{x, y, symbol.Type, symbol.Team})
+				}
+			}
+			y++
+		}
+		return layout, nil
+	default:
+		return MapLayout{}, fmt.Errorf("No map layout is known for category %v", category)
+	}
+}
+
+func newMapLayout(width, height int, obstruction float64) MapLayout {
+	layout := MapLayout{width, height, make([][]float64, height), make([][]float64, height), []MapRobot{}, obstruction}
+	for y := 0; y < height; y++ {
+		layout.Rubble[y] = make([]float64, width)
+		layout.Parts[y] = make([]float64, width)
+	}
+	return layout
+}
+
+// The symmetry and fairness of a layout
+func (l MapLayout) Analyze() MapAnalysis {
+	analysis := MapAnalysis{l.Width, l.Height, SymmetryNone, []string{}, []MapAsymmetry{}, map[string]TeamFairness{}, 0, 0}
+	var closest []MapAsymmetry
+	for _, s := range symmetries {
+		if s.square && l.Width != l.Height {
+			continue
+		}
+		asymmetries := l.asymmetries(s)
+		if len(asymmetries) == 0 {
+			analysis.Symmetries = append(analysis.Symmetries, s.name)
+		}
+		if closest == nil || len(asymmetries) < len(closest) {
+			analysis.Symmetry, closest = s.name, asymmetries
+		}
+	}
+	if len(analysis.Symmetries) == 0 && closest != nil {
+		analysis.Asymmetries = closest
+	}
+
+	distances := map[string][][]int{}
+	for _, team := range []string{"A", "B"} {
+		fairness := TeamFairness{[]MapRobot{}, []int{}, 0}
+		for _, robot := range l.Robots {
+			if robot.Team == team && StartingRobotTypes[robot.Type] {
+				fairness.Starts = append(fairness.Starts, robot)
+			}
+		}
+		for _, start := range fairness.Starts {
+			nearest := -1
+			from := l.pathDistances([]MapRobot{start})
+			for y := 0; y < l.Height; y++ {
+				for x := 0; x < l.Width; x++ {
+					if d := from[y][x]; l.Parts[y][x] > 0 && d >= 0 && (nearest < 0 || d < nearest) {
+						nearest = d
+					}
+				}
+			}
+			fairness.NearestParts = append(fairness.NearestParts, nearest)
+		}
+		distances[team] = l.pathDistances(fairness.Starts)
+		analysis.Teams[team] = fairness
+	}
+
+	a, b := analysis.Teams["A"], analysis.Teams["B"]
+	for y := 0; y < l.Height; y++ {
+		for x := 0; x < l.Width; x++ {
+			parts := l.Parts[y][x]
+			if parts <= 0 {
+				continue
+			}
+			analysis.TotalParts += parts
+			da, db := distances["A"][y][x], distances["B"][y][x]
+			if da >= 0 && (db < 0 || da < db) {
+				a.ClaimedParts += parts
+			} else if db >= 0 && (da < 0 || db < da) {
+				b.ClaimedParts += parts
+			} else if da >= 0 {
+				a.ClaimedParts += parts / 2
+				b.ClaimedParts += parts / 2
+			}
+		}
+	}
+	analysis.Teams["A"], analysis.Teams["B"] = a, b
+	if analysis.TotalParts > 0 {
+		analysis.PartsImbalance = math.Abs(a.ClaimedParts-b.ClaimedParts) / analysis.TotalParts
+	}
+	return analysis
+}
+
+// The cells which differ from their mirror cells, each pair reported once
+func (l MapLayout) asymmetries(s symmetry) []MapAsymmetry {
+	robots := map[[2]int]MapRobot{}
+	for _, robot := range l.Robots {
+		robots[[2]int{robot.X, robot.Y}] = robot
+	}
+	robotAt := func(x, y int, swap bool) string {
+		if robot, ok := robots[[2]int{x, y}]; !ok {
+			return ""
+		} else if swap {
+			return robot.Type + " " + mirrorTeam(robot.Team)
+		} else {
+			return robot.Type + " " + robot.Team
+		}
+	}
+	asymmetries := []MapAsymmetry{}
+	for y := 0; y < l.Height; y++ {
+		for x := 0; x < l.Width; x++ {
+			mx, my := s.mirror(l.Width, l.Height, x, y)
+			if my*l.Width+mx < y*l.Width+x {
+				continue
+			}
+			if l.Rubble[y][x] != l.Rubble[my][mx] {
+				asymmetries = append(asymmetries, MapAsymmetry{"rubble", x, y, mx, my, formatCell(l.Rubble[y][x]), formatCell(l.Rubble[my][mx])})
+			}
+			if l.Parts[y][x] != l.Parts[my][mx] {
+				asymmetries = append(asymmetries, MapAsymmetry{"parts", x, y, mx, my, formatCell(l.Parts[y][x]), formatCell(l.Parts[my][mx])})
+			}
+			if robotAt(x, y, true) != robotAt(mx, my, false) {
+				asymmetries = append(asymmetries, MapAsymmetry{"robots", x, y, mx, my, robotAt(x, y, false), robotAt(mx, my, false)})
+			}
+		}
+	}
+	return asymmetries
+}
+
+// The team whose robots a mirrored cell should hold
+func mirrorTeam(team string) string {
+	switch team {
+	case "A":
+		return "B"
+	case "B":
+		return "A"
+	default:
+		return team
+	}
+}
+
+func formatCell(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// The number of moves from the closest start to each cell, moving in any of eight directions
+// around obstructing rubble. Cells which cannot be reached are -1.
+func (l MapLayout) pathDistances(starts []MapRobot) [][]int {
+	distances := make([][]int, l.Height)
+	for y := range distances {
+		distances[y] = make([]int, l.Width)
+		for x := range distances[y] {
+			distances[y][x] = -1
+		}
+	}
+	queue := [][2]int{}
+	for _, start := range starts {
+		if start.X >= 0 && start.X < l.Width && start.Y >= 0 && start.Y < l.Height && distances[start.Y][start.X] < 0 {
+			distances[start.Y][start.X] = 0
+			queue = append(queue, [2]int{start.X, start.Y})
+		}
+	}
+	for len(queue) > 0 {
+		x, y := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				nx, ny := x+dx, y+dy
+				if nx < 0 || nx >= l.Width || ny < 0 || ny >= l.Height || distances[ny][nx] >= 0 {
+					continue
+				} else if l.Rubble[ny][nx] >= l.Obstruction {
+					continue
+				}
+				distances[ny][nx] = distances[y][x] + 1
+				queue = append(queue, [2]int{nx, ny})
+			}
+		}
+	}
+	return distances
+}
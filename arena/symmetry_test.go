@@ -0,0 +1,63 @@
+package arena
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeSymmetricMap(test *testing.T) {
+	t := (*testutil.T)(test)
+	analysis, err := AnalyzeMap("battlecode2014", SampleMap)
+	t.CheckError(err)
+	t.ExpectEqual(strings.Join(analysis.Symmetries, ","), "rotational,horizontal")
+	t.ExpectEqual(analysis.Symmetry, SymmetryRotational)
+	t.ExpectEqual(len(analysis.Asymmetries), 0)
+	t.ExpectEqual(len(analysis.Teams["A"].Starts), 1)
+	t.ExpectEqual(len(analysis.Teams["B"].Starts), 1)
+}
+
+func TestAnalyzeAsymmetricMap(test *testing.T) {
+	t := (*testutil.T)(test)
+	// Move team B's HQ up a row, then put parts beside team A
+	rows := strings.Split(string(SampleMap), "\n")
+	rows[21] = strings.Replace(rows[21], "_0 _0 _0 _0 _0 _0 _0 _0 _0 _0 _0 _0 _0", "_0 _0 _0 _0 _0 _0 _0 _0 _0 _0 _0 _0 b0", 1)
+	rows[22] = strings.Replace(rows[22], "b0", "_0", 1)
+	source := []byte(strings.Join(rows, "\n"))
+	analysis, err := AnalyzeMap("battlecode2014", source)
+	t.CheckError(err)
+	t.ExpectEqual(len(analysis.Symmetries), 0)
+	t.ExpectEqual(analysis.Symmetry, SymmetryRotational)
+	t.ExpectEqual(len(analysis.Asymmetries), 2)
+	for _, asymmetry := range analysis.Asymmetries {
+		t.ExpectEqual(asymmetry.Layer, "robots")
+	}
+
+	rows[23] = strings.Replace(rows[23], "_0 _0 _0 _0 _0 _0 _0 _0", "_0 _0 _0 _0 _0 _0 _0 _5", 1)
+	layout, err := ParseMapLayout("battlecode2014", []byte(strings.Join(rows, "\n")))
+	t.CheckError(err)
+	analysis = layout.Analyze()
+	t.ExpectEqual(analysis.TotalParts, 5.0)
+	t.ExpectEqual(analysis.Teams["A"].ClaimedParts, 5.0)
+	t.ExpectEqual(analysis.Teams["B"].ClaimedParts, 0.0)
+	t.ExpectEqual(analysis.PartsImbalance, 1.0)
+	t.ExpectEqual(analysis.Teams["A"].NearestParts[0], 1)
+	t.ExpectEqual(analysis.Teams["B"].NearestParts[0], 5)
+}
+
+func TestAnalyzeDefaultMaps(test *testing.T) {
+	t := (*testutil.T)(test)
+	files, err := filepath.Glob(filepath.Join("internal", "categories", "battlecode2016", "maps", "*.xml"))
+	t.CheckError(err)
+	for _, file := range files {
+		source, err := ioutil.ReadFile(file)
+		t.CheckError(err)
+		if analysis, err := AnalyzeMap("battlecode2016", source); err != nil {
+			t.ErrorNow(file, err)
+		} else if analysis.TotalParts > 0 && len(analysis.Symmetries) > 0 && analysis.PartsImbalance > 0.5 {
+			t.ErrorNow(file, "symmetric map claims most parts for one team", analysis.PartsImbalance)
+		}
+	}
+}
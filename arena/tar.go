@@ -0,0 +1,86 @@
+package arena
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Writes the regular files and directories below dir as a tar stream, skipping anything else
+func writeTar(w io.Writer, dir string) error {
+	archive := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if path == dir || !(info.Mode().IsRegular() || info.IsDir()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		} else if info.IsDir() {
+			return nil
+		} else if file, err := os.Open(path); err != nil {
+			return err
+		} else {
+			defer file.Close()
+			_, err := io.Copy(archive, file)
+			return err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// Extracts a tar stream written by writeTar into dir, refusing entries which would escape it
+func extractTar(r io.Reader, dir string) error {
+	archive := tar.NewReader(r)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("Invalid path in archive %v", header.Name)
+		}
+		path := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			} else if file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0755); err != nil {
+				return err
+			} else if _, err := io.Copy(file, archive); err != nil {
+				file.Close()
+				return err
+			} else if err := file.Close(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Unsupported entry in archive %v", header.Name)
+		}
+	}
+}
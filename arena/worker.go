@@ -0,0 +1,217 @@
+package arena
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GlenKelley/battleref/web"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How long an idle worker waits before asking for another job
+const DefaultPollInterval = 5 * time.Second
+
+type RemoteRegistration struct {
+	Worker       RemoteWorker `json:"worker"`
+	LeaseSeconds float64      `json:"lease_seconds"`
+}
+
+// Plays matches for a server running a RemoteArena, using a LocalArena on this machine.
+// Token is the server's worker token, sent with every request.
+type Worker struct {
+	ServerURL    string
+	Name         string
+	Token        string
+	Arena        LocalArena
+	PollInterval time.Duration
+	id           string
+	lease        time.Duration
+}
+
+func NewWorker(serverURL, name, token string, arena LocalArena) *Worker {
+	return &Worker{
+		ServerURL:    strings.TrimSuffix(serverURL, "/"),
+		Name:         name,
+		Token:        token,
+		Arena:        arena,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Leases and plays jobs until the context ends
+func (w *Worker) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		if w.id == "" {
+			if err := w.register(); err != nil {
+				log.Println("Failed to register worker:", err)
+				w.sleep(ctx)
+			}
+		} else if job, err := w.leaseJob(); isConflict(err) {
+			w.id = ""
+		} else if err != nil {
+			log.Println("Failed to lease job:", err)
+			w.sleep(ctx)
+		} else if job == nil {
+			w.sleep(ctx)
+		} else {
+			w.play(ctx, job)
+		}
+	}
+	return ctx.Err()
+}
+
+func (w *Worker) sleep(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(w.PollInterval):
+	}
+}
+
+func (w *Worker) register() error {
+	var registration RemoteRegistration
+	response := web.Json{Data: &registration}
+	if err := w.post("/worker/register", map[string]string{"name": w.Name}, &response); err != nil {
+		return err
+	} else if registration.Worker.Id == "" {
+		return errors.New("Server did not assign a worker id")
+	} else {
+		w.id = registration.Worker.Id
+		w.lease = time.Duration(registration.LeaseSeconds * float64(time.Second))
+		if w.lease <= 0 {
+			w.lease = DefaultLeaseDuration
+		}
+		log.Printf("Registered worker %v as %v\n", w.Name, w.id)
+		return nil
+	}
+}
+
+func (w *Worker) leaseJob() (*RemoteJob, error) {
+	var lease struct {
+		Job *RemoteJob `json:"job"`
+	}
+	response := web.Json{Data: &lease}
+	err := w.post("/worker/lease", map[string]string{"worker": w.id}, &response)
+	return lease.Job, err
+}
+
+func (w *Worker) play(ctx context.Context, job *RemoteJob) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go w.heartbeat(jobCtx, cancel, job.Id)
+	log.Printf("Playing job %v: %v vs %v on %v\n", job.Id, job.Player1, job.Player2, job.MapName)
+	properties := MatchProperties{
+		job.MapName,
+		strings.NewReader(job.MapSource),
+		job.Category,
+		job.Player1,
+		job.Player2,
+		job.Commit1,
+		job.Commit2,
+	}
+	_, result, err := w.Arena.RunStagedMatch(jobCtx, properties, w.stager(job.Id), time.Now)
+	if jobCtx.Err() != nil {
+		log.Printf("Abandoned job %v: %v\n", job.Id, jobCtx.Err())
+		return
+	}
+	remote := RemoteResult{Result: result, Replay: result.Replay}
+	if err == ErrMatchTimeout {
+		remote.Timeout = true
+	} else if buildErr, ok := err.(*BuildError); ok {
+		remote.BuildPlayer = buildErr.Name
+		remote.Error = buildErr.Err.Error()
+	} else if err != nil {
+		remote.Error = err.Error()
+	}
+	body := struct {
+		Worker string       `json:"worker"`
+		Job    string       `json:"job"`
+		Result RemoteResult `json:"result"`
+	}{w.id, job.Id, remote}
+	if err := w.post("/worker/complete", body, &web.Json{}); err != nil {
+		log.Printf("Failed to complete job %v: %v\n", job.Id, err)
+	}
+}
+
+// Keeps the lease on a job alive, cancelling the job if the server hands it to another worker
+func (w *Worker) heartbeat(ctx context.Context, cancel context.CancelFunc, jobId string) {
+	ticker := time.NewTicker(w.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			body := map[string]string{"worker": w.id, "job": jobId}
+			if err := w.post("/worker/heartbeat", body, &web.Json{}); isConflict(err) {
+				log.Printf("Lost lease on job %v\n", jobId)
+				cancel()
+				return
+			} else if err != nil {
+				log.Println("Failed to send heartbeat:", err)
+			}
+		}
+	}
+}
+
+// Downloads the players' sources from the server instead of cloning their repositories
+func (w *Worker) stager(jobId string) Stager {
+	return func(ctx context.Context, stageDir string, p MatchProperties) error {
+		name1, name2 := p.PlayerNames()
+		if err := w.download(ctx, jobId, 1, filepath.Join(stageDir, name1)); err != nil {
+			return err
+		} else if name1 == name2 {
+			return nil
+		} else if err := w.download(ctx, jobId, 2, filepath.Join(stageDir, name2)); err != nil {
+			return err
+		} else if p.SelfPlay() {
+			return renamePackage(filepath.Join(stageDir, name2), PlayerName(p.PlayerRepo2), name2)
+		}
+		return nil
+	}
+}
+
+func (w *Worker) download(ctx context.Context, jobId string, player int, dir string) error {
+	query := url.Values{}
+	query.Set("worker", w.id)
+	query.Set("job", jobId)
+	query.Set("player", fmt.Sprint(player))
+	req, err := http.NewRequest("GET", w.ServerURL+"/worker/source?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.Token)
+	if resp, err := http.DefaultClient.Do(req.WithContext(ctx)); err != nil {
+		return err
+	} else {
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return web.NewHttpResponseError(resp)
+		}
+		return extractTar(resp.Body, dir)
+	}
+}
+
+// Posts a JSON body to the server with the worker token
+func (w *Worker) post(path string, body interface{}, response interface{}) error {
+	if bs, err := json.Marshal(body); err != nil {
+		return err
+	} else if req, err := http.NewRequest("POST", w.ServerURL+path, bytes.NewReader(bs)); err != nil {
+		return err
+	} else {
+		req.Header.Set(web.HeaderContentType, web.ContentTypeJson)
+		req.Header.Set("Authorization", "Bearer "+w.Token)
+		return web.RoundTripJson(req, response)
+	}
+}
+
+func isConflict(err error) bool {
+	httpErr, ok := err.(*web.HttpResponseError)
+	return ok && httpErr.StatusCode == http.StatusConflict
+}
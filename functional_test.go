@@ -29,11 +29,12 @@ func TestInitToRun2016(test *testing.T) {
 
 func initToRun(t *testutil.T, port string, category tournament.TournamentCategory) {
 	if webserver, err := CreateServer(server.Properties{
-		":memory:",
-		port,
-		":temp:",
-		nil,
-		".",
+		DatabaseURL:   ":memory:",
+		ServerPort:    port,
+		GitServerType: ":temp:",
+		ResourcePath:  ".",
+		MatchWorkers:  1,
+		MatchAttempts: 1,
 	}); err != nil {
 		t.FailNow()
 	} else {
@@ -51,8 +52,15 @@ func initToRun(t *testutil.T, port string, category tournament.TournamentCategor
 			t.ErrorNow(err)
 		} else if len(maps) == 0 {
 			t.ErrorNowf("No default maps")
+		} else if id, err := RunMatch(port, "playerFoo", "playerFoo", commit, commit, maps[0], category); err != nil {
+			t.ErrorNow(err)
 		} else {
-			t.CheckError(RunMatch(port, "playerFoo", "playerFoo", commit, commit, maps[0], category))
+			webserver.Tournament.Queue.Wait()
+			if result, err := webserver.Tournament.GetMatchResult(id); err != nil {
+				t.ErrorNow(err)
+			} else if result == tournament.MatchResultError {
+				t.ErrorNowf("Match %v failed", id)
+			}
 		}
 	}
 }
@@ -89,8 +97,12 @@ func GetMaps(port string, category tournament.TournamentCategory) ([]string, err
 	}
 }
 
-func RunMatch(port, name, name2, commit, commit2, mapName string, category tournament.TournamentCategory) error {
-	response := struct{}{}
+func RunMatch(port, name, name2, commit, commit2, mapName string, category tournament.TournamentCategory) (int64, error) {
+	var response struct {
+		Data struct {
+			Id int64 `json:"id"`
+		} `json:"data"`
+	}
 	if err := web.SendPostJson("http://localhost:"+port+"/match/run", web.JsonBody{
 		"player1":  name,
 		"player2":  name2,
@@ -99,8 +111,8 @@ func RunMatch(port, name, name2, commit, commit2, mapName string, category tourn
 		"category": string(category),
 		"map":      mapName,
 	}, &response); err != nil {
-		return err
+		return 0, err
 	} else {
-		return nil
+		return response.Data.Id, nil
 	}
 }
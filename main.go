@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/GlenKelley/battleref/arena"
 	"github.com/GlenKelley/battleref/git"
 	"github.com/GlenKelley/battleref/server"
 	"github.com/GlenKelley/battleref/tournament"
 	"log"
+	"os"
 )
 
 func main() {
+	arena.SandboxInit()
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runWorker(os.Args[2:])
+		return
+	}
 	var environment string
 	var resourcePath string
 	var clear bool
@@ -59,13 +66,78 @@ func CreateServer(properties server.Properties) (*server.ServerState, error) {
 		return nil, err
 	} else if err := host.Validate(); err != nil {
 		return nil, err
+	} else if timeouts, err := properties.ArenaTimeouts(); err != nil {
+		return nil, err
+	} else if sandbox, err := properties.Sandbox(); err != nil {
+		return nil, err
+	} else if cache, err := properties.BuildCache(); err != nil {
+		return nil, err
+	} else if retry, err := properties.RetryPolicy(); err != nil {
+		return nil, err
+	} else if ratings, err := properties.Ratings(); err != nil {
+		return nil, err
+	} else if scoring, err := properties.Scoring(); err != nil {
+		return nil, err
+	} else if matchArena, err := arena.CreateArena(properties.ArenaType, properties.ArenaConf, arena.NewArena(properties.ArenaResourcePath(), timeouts, sandbox, cache)); err != nil {
+		return nil, err
 	} else {
-		matchArena := arena.NewArena(properties.ArenaResourcePath())
 		remote := git.TempRemote{}
 		bootstrap := arena.MinimalBootstrap{properties.ArenaResourcePath()}
 		tm := tournament.NewTournament(database, matchArena, bootstrap, host, remote)
+		tm.Retry = retry
+		tm.RatingModels = ratings
+		tm.Scoring = scoring
+		if properties.ScrimmageQuota > 0 {
+			tm.ScrimmageQuota = properties.ScrimmageQuota
+		}
+		if err := tm.StartMatchQueue(properties.MatchWorkers, tournament.SystemClock()); err != nil {
+			return nil, err
+		}
 		webserver := server.NewServer(tm, properties)
 		return webserver, nil
 	}
 
 }
+
+// Plays matches for a server with a remote arena
+func runWorker(args []string) {
+	var serverURL string
+	var name string
+	var environment string
+	var resourcePath string
+	var token string
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	flags.StringVar(&serverURL, "s", "", "url of the battleref server to play matches for")
+	flags.StringVar(&name, "n", hostname, "name of this worker")
+	flags.StringVar(&environment, "e", "", "environment parameters for the arena timeouts, sandbox and build cache")
+	flags.StringVar(&resourcePath, "r", ".", "root directory for resource files")
+	flags.StringVar(&token, "t", "", "worker token of the server, the environment's worker_token by default")
+	flags.Parse(args)
+	if serverURL == "" {
+		flags.Usage()
+		log.Fatal("You must define a server url")
+	}
+
+	properties := server.Properties{ResourcePath: resourcePath, DatabaseURL: ":memory:"}
+	if environment != "" {
+		if p, err := server.ReadProperties(environment, resourcePath); err != nil {
+			log.Fatal(err)
+		} else {
+			properties = p
+		}
+	}
+	if timeouts, err := properties.ArenaTimeouts(); err != nil {
+		log.Fatal(err)
+	} else if sandbox, err := properties.Sandbox(); err != nil {
+		log.Fatal(err)
+	} else if cache, err := properties.BuildCache(); err != nil {
+		log.Fatal(err)
+	} else {
+		if token == "" {
+			token = properties.WorkerToken
+		}
+		worker := arena.NewWorker(serverURL, name, token, arena.LocalArena{properties.ArenaResourcePath(), timeouts, sandbox, cache})
+		log.Fatal(worker.Run(context.Background()))
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/GlenKelley/battleref/tournament"
+	"net/http"
+	"strings"
+)
+
+// Who made a request, either a registered player or an admin holding the server's admin token
+type Caller struct {
+	Name  string
+	Admin bool
+}
+
+// The token of a request from an "Authorization: Bearer" header, falling back to a token form field
+func requestToken(r *http.Request, token string) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return token
+}
+
+// Identifies the caller from the request's token
+func authenticate(r *http.Request, token string, s *ServerState) (Caller, error) {
+	if token = requestToken(r, token); token == "" {
+		return Caller{}, errors.New("Missing token")
+	} else if admin := s.Properties.AdminToken; admin != "" && subtle.ConstantTimeCompare([]byte(token), []byte(admin)) == 1 {
+		return Caller{"", true}, nil
+	} else if name, err := s.Tournament.GetTokenUser(token); err != nil {
+		return Caller{}, err
+	} else {
+		return Caller{name, false}, nil
+	}
+}
+
+// Checks that a request holds the server's worker token or admin token, which remote workers use to
+// lease matches, download player sources and report results
+func authenticateWorker(r *http.Request, token string, s *ServerState) error {
+	if token = requestToken(r, token); token == "" {
+		return errors.New("Missing token")
+	}
+	for _, valid := range []string{s.Properties.WorkerToken, s.Properties.AdminToken} {
+		if valid != "" && subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1 {
+			return nil
+		}
+	}
+	return errors.New("Invalid worker token")
+}
+
+// Players see the engine output and their own team's output, admins see everything
+func (c Caller) CanSeeLog(match tournament.Match, stream string) bool {
+	switch stream {
+	case tournament.LogEngine:
+		return true
+	case tournament.LogPlayer1:
+		return c.Admin || c.Name == match.Player1
+	case tournament.LogPlayer2:
+		return c.Admin || c.Name == match.Player2
+	default:
+		return c.Admin
+	}
+}
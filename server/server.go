@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	//	"sort"
 	"code.google.com/p/go.net/websocket"
 	"encoding/json"
+	"github.com/GlenKelley/battleref/arena"
 	"github.com/GlenKelley/battleref/git"
 	"github.com/GlenKelley/battleref/tournament"
 	"github.com/GlenKelley/battleref/web"
@@ -28,6 +30,9 @@ import (
 
 type JSONResponse map[string]interface{}
 
+// The most maps one request may generate
+const MaxGeneratedMaps = 50
+
 var (
 	NameRegex       = regexp.MustCompile("^[\\w\\d-]+$")     //valid tournament usernames
 	CommitHashRegex = regexp.MustCompile("^[0-9a-f]{5,40}$") //git hash
@@ -45,6 +50,7 @@ type ServerState struct {
 	HttpServer *http.Server
 	Listener   net.Listener
 	Routes     map[string]Route
+	Previews   *arena.MapPreviews
 }
 
 func NewServer(tournament *tournament.Tournament, properties Properties) *ServerState {
@@ -55,24 +61,66 @@ func NewServer(tournament *tournament.Tournament, properties Properties) *Server
 		WriteTimeout:   10 * time.Minute,
 		MaxHeaderBytes: 1 << 20,
 	}
-	s := ServerState{tournament, properties, httpServer, nil, make(map[string]Route)}
+	s := ServerState{tournament, properties, httpServer, nil, make(map[string]Route), arena.NewMapPreviews(properties.SpritePath())}
 	s.HandleFunc("GET", "/version", version, "The code version running this server.")
 	s.HandleFunc("GET", "/api", api, "API documentation.")
 	s.HandleFunc("GET", "/players", players, "List all registered players.")
 	s.HandleFunc("GET", "/categories", categories, "List all tournament categories.")
 	s.HandleFunc("GET", "/maps", maps, "List all maps.")
 	s.HandleFunc("GET", "/commits", commits, "A list of submitted commits for a player in a category.")
+	s.HandleFunc("GET", "/commit/status", commitStatus, "Whether a submitted commit was accepted, with the output of its compile check.")
 	s.HandleFunc("GET", "/map/source", mapSource, "")
+	s.HandleFunc("GET", "/map/preview", mapPreview, "A PNG of a battlecode2016 map's rubble, parts and initial robots.")
+	s.HandleFunc("GET", "/map/versions", mapVersions, "Every version of a map, including the versions of a deleted map.")
+	s.HandleFunc("GET", "/pools", mapPools, "List the map pools of a category.")
+	s.HandleFunc("GET", "/pool", mapPool, "The maps of a map pool.")
 	s.HandleFunc("POST", "/shutdown", shutdown, "Turn off the server.")
 	s.HandleFunc("POST", "/register", register, "Registers a player name to a public key.")
-	s.HandleFunc("POST", "/map/create", createMap, "Create a map.")
+	s.HandleFunc("POST", "/map/create", createMap, "Create a map after checking the engine can play it, with its symmetry and fairness.")
+	s.HandleFunc("POST", "/map/update", updateMap, "Add a version of a map after checking the engine can play it. Matches keep the version they were played on. Admin only.")
+	s.HandleFunc("POST", "/map/delete", deleteMap, "Delete a map so it is no longer listed or played. Admin only.")
+	s.HandleFunc("POST", "/pool/set", setMapPool, "Create or replace a named pool of maps which matches and phases can be played on. Admin only.")
+	s.HandleFunc("POST", "/map/analyze", analyzeMap, "The symmetry of a map source or created map, the cells which break it, and how close each team starts to the parts.")
 	s.HandleFunc("POST", "/submit", submit, "Register a commit for a player into a category.")
-	s.HandleFunc("POST", "/match/run", runMatch, "Run a single match between two submissions.")
-	s.HandleFunc("POST", "/match/run/latest", runLatestMatches, "Run matches between all recent submissions.")
+	s.HandleFunc("POST", "/match/run", runMatch, "Queue a single match between two submissions.")
+	s.HandleFunc("POST", "/match/run/latest", runLatestMatches, "Queue the matches between all recent submissions which are missing or failed, on the maps of a pool or every map.")
+	s.HandleFunc("GET", "/match/plan", matchPlan, "The matches /match/run/latest would queue, without queueing them.")
+	s.HandleFunc("GET", "/match/status", matchStatus, "The result of a single match, InProgress until it has been played.")
 	s.HandleFunc("GET", "/matches", matches, "List all matches")
 	s.HandleFunc("GET", "/replay", replay, "The replay log of a single match")
+	s.HandleFunc("POST", "/match/rerun", rerunMatch, "Queue a finished match to be played again. Admin only.")
+	s.HandleFunc("GET", "/match/attempts", matchAttempts, "Every time a match was played, with the result and error of each attempt.")
+	s.HandleFunc("GET", "/match/logs", matchLogs, "The engine output of a single match and the output of the caller's team. Admins see every team.")
 	s.WebsocketHandle("/replay/stream", replayStream, "The replay log of a single match")
 	s.HandleFunc("GET", "/leaderboard", leaderboard, "Lists the player rankings for a tournament category.")
+	s.HandleFunc("GET", "/leaderboard/history", leaderboardHistory, "A player's rank and score after each recalculation of the leaderboard, with the commit they were ranked with.")
+	s.HandleFunc("GET", "/stats/headtohead", headToHead, "The wins, ties and losses of each current submission against each other. Name, from and to limit a player to a range of their commits.")
+	s.HandleFunc("GET", "/stats/maps", mapStats, "The wins, ties, losses and win rate of each current submission on each map. Name, from and to limit a player to a range of their commits.")
+	s.HandleFunc("POST", "/bracket/create", createBracket, "Create a single or double elimination bracket seeded from the leaderboard. Admin only.")
+	s.HandleFunc("GET", "/brackets", brackets, "List the brackets of a tournament category.")
+	s.HandleFunc("GET", "/bracket", bracket, "A bracket with every series, its players, matches and where its winner and loser go next.")
+	s.HandleFunc("POST", "/swiss/create", createSwiss, "Create a Swiss tournament between every player of a category, seeded from the leaderboard. Admin only.")
+	s.HandleFunc("GET", "/swiss/list", swissList, "List the Swiss tournaments of a tournament category.")
+	s.HandleFunc("GET", "/swiss", swiss, "A Swiss tournament with the pairings of every round and the standings with their tiebreakers.")
+	s.HandleFunc("POST", "/scrimmage/request", requestScrimmage, "Challenge another player's latest submission to unranked matches on chosen maps, or on count random maps. Limited to a daily quota of matches.")
+	s.HandleFunc("GET", "/scrimmages", scrimmages, "List the scrimmages a player requested or was challenged to in a category.")
+	s.HandleFunc("GET", "/scrimmage", scrimmage, "A scrimmage with the result of each of its matches.")
+	s.HandleFunc("POST", "/regression/request", requestRegression, "Play two of your accepted commits against each other on both sides of chosen maps, or of every map. Counts towards the scrimmage quota.")
+	s.HandleFunc("GET", "/regression", regression, "The win rate of a candidate commit against a baseline commit of the same player on each map.")
+	s.HandleFunc("POST", "/season/create", createSeason, "Create a season of tournament phases. Admin only.")
+	s.HandleFunc("GET", "/seasons", seasons, "List every season.")
+	s.HandleFunc("GET", "/season", season, "A season with each of its phases and their leaderboards.")
+	s.HandleFunc("POST", "/phase/create", createPhase, "Add a phase to a season, with RFC 3339 start and freeze times, played on its maps or the maps of a pool when it starts. Submissions to its category are rejected from the freeze until it finishes. Admin only.")
+	s.HandleFunc("POST", "/phase/start", startPhase, "Play a phase between the latest submissions once its submissions have frozen. Admin only.")
+	s.HandleFunc("POST", "/phase/finish", finishPhase, "Finish a phase once its matches have been played, keeping a snapshot of its leaderboard. Admin only.")
+	s.HandleFunc("POST", "/phase/maps/generate", generatePhaseMaps, "Generate count battlecode2016 maps named name_1 onwards from JSON map parameters, seeded from their seed, and add them to a phase's maps before it starts. Admin only.")
+	s.HandleFunc("GET", "/phase", phase, "A phase with its players and, once finished, its leaderboard.")
+	s.HandleFunc("GET", "/workers", workers, "List the remote workers which have registered with this server. Workers and admins only.")
+	s.HandleFunc("POST", "/worker/register", registerWorker, "Registers a remote worker, returning its id. Every /worker endpoint requires the worker token or the admin token.")
+	s.HandleFunc("POST", "/worker/lease", leaseJob, "Leases the next queued match to a remote worker.")
+	s.HandleFunc("POST", "/worker/heartbeat", jobHeartbeat, "Extends a remote worker's lease on a match.")
+	s.HandleFunc("GET", "/worker/source", jobSource, "A tar of a player's source for a leased match.")
+	s.HandleFunc("POST", "/worker/complete", completeJob, "Uploads the result and replay of a leased match.")
 	return &s
 }
 
@@ -109,17 +157,134 @@ func (s *ServerState) WebsocketHandle(pattern string, handler func(*websocket.Co
 
 // Environment variables
 type Properties struct {
-	DatabaseURL   string            `json:"database_url"`
-	ServerPort    string            `json:"server_port"`
-	GitServerType string            `json:"git_server"`
-	GitServerConf map[string]string `json:"git_server_conf"`
-	ResourcePath  string            `json:"resource_path"`
+	DatabaseURL     string                             `json:"database_url"`
+	ServerPort      string                             `json:"server_port"`
+	GitServerType   string                             `json:"git_server"`
+	GitServerConf   map[string]string                  `json:"git_server_conf"`
+	ResourcePath    string                             `json:"resource_path"`
+	MatchWorkers    int                                `json:"match_workers"`
+	MatchTimeouts   map[string]string                  `json:"match_timeouts"`
+	MatchAttempts   int                                `json:"match_attempts"`
+	MatchBackoff    string                             `json:"match_backoff"`
+	ArenaSandbox    *arena.Sandbox                     `json:"arena_sandbox"`
+	ArenaType       string                             `json:"arena_type"`
+	ArenaConf       map[string]string                  `json:"arena_conf"`
+	ArenaBuildCache *arena.BuildCache                  `json:"arena_build_cache"`
+	AdminToken      string                             `json:"admin_token"`
+	WorkerToken     string                             `json:"worker_token"`
+	RatingModels    map[string]string                  `json:"rating_models"`
+	ScoringRules    map[string]tournament.ScoringRules `json:"scoring_rules"`
+	ScrimmageQuota  int                                `json:"scrimmage_quota"`
 }
 
 func (p Properties) ArenaResourcePath() string {
 	return filepath.Join(p.ResourcePath, "arena", "internal", "categories")
 }
 
+// The robot sprites of the replay viewer, which map previews are drawn with
+func (p Properties) SpritePath() string {
+	return filepath.Join(p.ResourcePath, "internal", "web", "images")
+}
+
+// The wall-clock limit of a match in each category, written as durations such as "20m"
+func (p Properties) ArenaTimeouts() (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for category, value := range p.MatchTimeouts {
+		if timeout, err := time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("Invalid match timeout for %v: %v", category, err)
+		} else {
+			timeouts[category] = timeout
+		}
+	}
+	return timeouts, nil
+}
+
+// How often a match which fails because of the arena is played, and the wait before the first retry
+func (p Properties) RetryPolicy() (tournament.RetryPolicy, error) {
+	policy := tournament.DefaultRetryPolicy
+	if p.MatchAttempts > 0 {
+		policy.MaxAttempts = p.MatchAttempts
+	}
+	if p.MatchBackoff != "" {
+		if backoff, err := time.ParseDuration(p.MatchBackoff); err != nil {
+			return policy, fmt.Errorf("Invalid match backoff: %v", err)
+		} else {
+			policy.Backoff = backoff
+		}
+	}
+	return policy, nil
+}
+
+// The rating model of each category which does not use the default, such as "glicko2" or "trueskill"
+func (p Properties) Ratings() (map[tournament.TournamentCategory]string, error) {
+	models := map[tournament.TournamentCategory]string{}
+	for category, name := range p.RatingModels {
+		if _, err := tournament.NewRatingModel(name); err != nil {
+			return nil, err
+		}
+		models[tournament.TournamentCategory(category)] = name
+	}
+	return models, nil
+}
+
+// The scoring rules of each category which does not use the defaults
+func (p Properties) Scoring() (map[tournament.TournamentCategory]tournament.ScoringRules, error) {
+	scoring := map[tournament.TournamentCategory]tournament.ScoringRules{}
+	for category, rules := range p.ScoringRules {
+		if err := rules.Validate(); err != nil {
+			return nil, fmt.Errorf("Invalid scoring rules for %v: %v", category, err)
+		}
+		scoring[tournament.TournamentCategory(category)] = rules
+	}
+	return scoring, nil
+}
+
+// The sandbox for player code, or nil when matches run unsandboxed.
+// The arena resources are always read only, and the database directory, temp directory and ssh keys are hidden,
+// so the database must be kept apart from the arena resources and work directory.
+func (p Properties) Sandbox() (*arena.Sandbox, error) {
+	if p.ArenaSandbox == nil {
+		return nil, nil
+	}
+	sandbox := *p.ArenaSandbox
+	hidden := []string{os.TempDir()}
+	if home := os.Getenv("HOME"); home != "" {
+		hidden = append(hidden, filepath.Join(home, ".ssh"))
+	}
+	if p.DatabaseURL != ":memory:" {
+		if database, err := filepath.Abs(p.DatabaseURL); err != nil {
+			return nil, err
+		} else {
+			hidden = append(hidden, filepath.Dir(database))
+		}
+	}
+	if p.ArenaBuildCache != nil {
+		hidden = append(hidden, p.ArenaBuildCache.Dir)
+	}
+	sandbox.HiddenPaths = append(hidden, sandbox.HiddenPaths...)
+	if resources, err := filepath.Abs(p.ArenaResourcePath()); err != nil {
+		return nil, err
+	} else {
+		sandbox.ReadOnlyPaths = append([]string{resources}, sandbox.ReadOnlyPaths...)
+	}
+	if err := sandbox.Validate(); err != nil {
+		return nil, err
+	}
+	return &sandbox, nil
+}
+
+// The cache of compiled players, or nil when players are compiled for every match
+func (p Properties) BuildCache() (*arena.BuildCache, error) {
+	if p.ArenaBuildCache == nil {
+		return nil, nil
+	}
+	cache := arena.NewBuildCache(p.ArenaBuildCache.Dir, p.ArenaBuildCache.MaxBytes)
+	if err := cache.Validate(); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
 func ReadProperties(env, resourcePath string) (Properties, error) {
 	propertiesFilename := filepath.Join(resourcePath, "env", fmt.Sprintf("server.%s.properties", env))
 	var properties Properties
@@ -299,6 +464,8 @@ func register(w http.ResponseWriter, r *http.Request, s *ServerState) {
 		web.WriteJsonError(w, err)
 	} else if err := s.Tournament.SubmitCommit(form.Name, form.Category, commitHash, time.Now()); err != nil {
 		web.WriteJsonError(w, err)
+	} else if token, err := s.Tournament.CreateUserToken(form.Name); err != nil {
+		web.WriteJsonError(w, err)
 	} else {
 		web.WriteJson(w, struct {
 			Name      string                        `json:"name"`
@@ -306,12 +473,14 @@ func register(w http.ResponseWriter, r *http.Request, s *ServerState) {
 			PublicKey string                        `json:"public_key"`
 			RepoUrl   string                        `json:"repo_url"`
 			Commit    string                        `json:"commit_hash"`
+			Token     string                        `json:"token"`
 		}{
 			form.Name,
 			form.Category,
 			form.PublicKey,
 			s.Tournament.GitHost.ExternalRepositoryURL(form.Name),
 			commitHash,
+			token,
 		})
 	}
 }
@@ -339,10 +508,60 @@ func createMap(w http.ResponseWriter, r *http.Request, s *ServerState) {
 		web.WriteJsonWebError(w, err)
 	} else if !NameRegex.MatchString(form.Name) {
 		web.WriteJsonError(w, errors.New("Invalid Name"))
+	} else if analysis, err := arena.AnalyzeMap(string(form.Category), []byte(form.Source)); err != nil {
+		writeMapError(w, err)
 	} else if err := s.Tournament.CreateMap(form.Name, form.Source, form.Category); err != nil {
 		web.WriteJsonError(w, err)
 	} else {
-		web.WriteJson(w, form)
+		web.WriteJson(w, struct {
+			Name     string                        `json:"name"`
+			Category tournament.TournamentCategory `json:"category"`
+			Source   string                        `json:"source"`
+			Analysis arena.MapAnalysis             `json:"analysis"`
+		}{
+			form.Name,
+			form.Category,
+			form.Source,
+			analysis,
+		})
+	}
+}
+
+func analyzeMap(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `json:"name" form:"name"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Source   string                        `json:"source" form:"source"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if form.Source == "" && form.Name == "" {
+		web.WriteJsonErrorWithCode(w, errors.New("Either a map name or source is required"), http.StatusBadRequest)
+	} else if form.Source == "" {
+		if source, err := s.Tournament.GetMapSource(form.Name, form.Category); err != nil {
+			web.WriteJsonError(w, err)
+		} else if analysis, err := arena.AnalyzeMap(string(form.Category), []byte(source)); err != nil {
+			writeMapError(w, err)
+		} else {
+			web.WriteJson(w, JSONResponse{"analysis": analysis})
+		}
+	} else if analysis, err := arena.AnalyzeMap(string(form.Category), []byte(form.Source)); err != nil {
+		writeMapError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"analysis": analysis})
+	}
+}
+
+// Reports each problem with an uploaded map as an error item
+func writeMapError(w http.ResponseWriter, err error) {
+	if mapErr, ok := err.(*arena.MapError); ok {
+		werr := web.NewError(http.StatusBadRequest, "Invalid map")
+		for _, problem := range mapErr.Problems {
+			werr.AddError(problem)
+		}
+		web.WriteJsonWebError(w, werr)
+	} else {
+		web.WriteJsonErrorWithCode(w, err, http.StatusBadRequest)
 	}
 }
 
@@ -363,9 +582,16 @@ func mapSource(w http.ResponseWriter, r *http.Request, s *ServerState) {
 	var form struct {
 		Name     string                        `form:"name" validate:"required"`
 		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Version  int64                         `json:"version" form:"version"`
 	}
 	if err := parseForm(r, &form); err != nil {
 		web.WriteJsonWebError(w, err)
+	} else if form.Version != 0 {
+		if m, err := s.Tournament.GetMapVersion(form.Name, form.Category, int(form.Version)); err != nil {
+			web.WriteJsonError(w, err)
+		} else {
+			web.WriteXml(w, []byte(m.Source))
+		}
 	} else if source, err := s.Tournament.GetMapSource(form.Name, form.Category); err != nil {
 		web.WriteJsonError(w, err)
 	} else {
@@ -373,6 +599,128 @@ func mapSource(w http.ResponseWriter, r *http.Request, s *ServerState) {
 	}
 }
 
+func mapPreview(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if source, err := s.Tournament.GetMapSource(form.Name, form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else if preview, err := s.Previews.Preview(string(form.Category), []byte(source)); err != nil {
+		writeMapError(w, err)
+	} else {
+		web.WritePng(w, preview)
+	}
+}
+
+func mapVersions(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if versions, err := s.Tournament.ListMapVersions(form.Name, form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"versions": versions})
+	}
+}
+
+func updateMap(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `json:"name" form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Source   string                        `json:"source" form:"source" validate:"required"`
+		Token    string                        `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may update maps"), http.StatusForbidden)
+	} else if analysis, err := arena.AnalyzeMap(string(form.Category), []byte(form.Source)); err != nil {
+		writeMapError(w, err)
+	} else if version, err := s.Tournament.UpdateMap(form.Name, form.Source, form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"name": form.Name, "category": form.Category, "version": version, "analysis": analysis})
+	}
+}
+
+func deleteMap(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `json:"name" form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Token    string                        `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may delete maps"), http.StatusForbidden)
+	} else if err := s.Tournament.DeleteMap(form.Name, form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{})
+	}
+}
+
+func setMapPool(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `json:"name" form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Maps     string                        `json:"maps" form:"maps" validate:"required"`
+		Token    string                        `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may set map pools"), http.StatusForbidden)
+	} else if !NameRegex.MatchString(form.Name) {
+		web.WriteJsonErrorWithCode(w, errors.New("Invalid Name"), http.StatusBadRequest)
+	} else if err := s.Tournament.SetMapPool(form.Name, form.Category, splitList(form.Maps), time.Now()); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusBadRequest)
+	} else if pool, err := s.Tournament.GetMapPool(form.Name, form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, pool)
+	}
+}
+
+func mapPools(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if pools, err := s.Tournament.ListMapPools(form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"pools": pools})
+	}
+}
+
+func mapPool(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if pool, err := s.Tournament.GetMapPool(form.Name, form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, pool)
+	}
+}
+
 func submit(w http.ResponseWriter, r *http.Request, s *ServerState) {
 	var form struct {
 		Name       string                        `json:"name" form:"name" validate:"required"`
@@ -389,8 +737,37 @@ func submit(w http.ResponseWriter, r *http.Request, s *ServerState) {
 		web.WriteJsonError(w, errors.New("Invalid commit hash"))
 	} else if err := s.Tournament.SubmitCommit(form.Name, form.Category, form.CommitHash, time.Now()); err != nil {
 		web.WriteJsonError(w, err)
+	} else if status, err := s.Tournament.GetCommitStatus(form.Name, form.Category, form.CommitHash); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, struct {
+			Name       string                        `json:"name"`
+			CommitHash string                        `json:"commit_hash"`
+			Category   tournament.TournamentCategory `json:"category"`
+			Status     string                        `json:"status"`
+			Output     string                        `json:"output"`
+		}{
+			form.Name,
+			form.CommitHash,
+			form.Category,
+			status.Status,
+			status.Output,
+		})
+	}
+}
+
+func commitStatus(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name       string                        `json:"name" form:"name" validate:"required"`
+		CommitHash string                        `json:"commit_hash" form:"commit_hash" validate:"required"`
+		Category   tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if status, err := s.Tournament.GetCommitStatus(form.Name, form.Category, form.CommitHash); err != nil {
+		web.WriteJsonError(w, err)
 	} else {
-		web.WriteJson(w, form)
+		web.WriteJson(w, status)
 	}
 }
 
@@ -452,13 +829,85 @@ func runMatch(w http.ResponseWriter, r *http.Request, s *ServerState) {
 		web.WriteJsonError(w, errors.New("Invalid commit hash 1"))
 	} else if !CommitHashRegex.MatchString(form.Commit2) {
 		web.WriteJsonError(w, errors.New("Invalid commit hash 2"))
-	} else if id, result, err := s.Tournament.RunMatch(form.Category, form.Map, tournament.Submission{form.Player1, form.Commit1}, tournament.Submission{form.Player2, form.Commit2}, tournament.SystemClock()); err != nil {
+	} else if id, err := s.Tournament.EnqueueMatch(form.Category, form.Map, tournament.Submission{form.Player1, form.Commit1}, tournament.Submission{form.Player2, form.Commit2}, tournament.SystemClock()); err != nil {
+		web.WriteJsonError(w, err)
+	} else if result, err := s.Tournament.GetMatchResult(id); err != nil {
 		web.WriteJsonError(w, err)
 	} else {
 		web.WriteJson(w, JSONResponse{"id": id, "result": result})
 	}
 }
 
+func matchStatus(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if result, err := s.Tournament.GetMatchResult(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"id": form.Id, "result": result})
+	}
+}
+
+func rerunMatch(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id    int64  `json:"id" form:"id" validate:"required,nonzero"`
+		Token string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may rerun matches"), http.StatusForbidden)
+	} else if err := s.Tournament.RerunMatch(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"id": form.Id})
+	}
+}
+
+func matchAttempts(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if attempts, err := s.Tournament.ListMatchAttempts(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"id": form.Id, "attempts": attempts})
+	}
+}
+
+func matchLogs(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id    int64  `json:"id" form:"id" validate:"required,nonzero"`
+		Token string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if match, err := s.Tournament.GetMatch(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else if !caller.Admin && caller.Name != match.Player1 && caller.Name != match.Player2 {
+		web.WriteJsonErrorWithCode(w, errors.New("Only the players in a match may see its logs"), http.StatusForbidden)
+	} else if logs, err := s.Tournament.GetMatchLogs(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		visible := JSONResponse{}
+		for stream, log := range logs {
+			if caller.CanSeeLog(match, stream) {
+				visible[stream] = log
+			}
+		}
+		web.WriteJson(w, JSONResponse{"id": form.Id, "logs": visible})
+	}
+}
+
 func replay(w http.ResponseWriter, r *http.Request, s *ServerState) {
 	var form struct {
 		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
@@ -509,22 +958,471 @@ func leaderboard(w http.ResponseWriter, r *http.Request, s *ServerState) {
 		web.WriteJsonWebError(w, err)
 	} else if ranks, matches, err := s.Tournament.GetLeaderboard(form.Category); err != nil {
 		web.WriteJsonError(w, err)
+	} else if ratings, err := s.Tournament.GetRatings(form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else if ranking, err := s.Tournament.LeaderboardRanking(form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		model, _ := s.Tournament.RatingModel(form.Category)
+		web.WriteJson(w, JSONResponse{"ranks": ranks, "matches": matches, "ratings": ratings, "rating_model": model, "ranking": ranking})
+	}
+}
+
+func leaderboardHistory(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Name     string                        `json:"name" form:"name" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if history, err := s.Tournament.LeaderboardHistory(form.Category, form.Name); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"history": history})
+	}
+}
+
+// The category and optional commit range of a stats request
+type statsForm struct {
+	Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	Name     string                        `json:"name" form:"name"`
+	From     string                        `json:"from" form:"from"`
+	To       string                        `json:"to" form:"to"`
+}
+
+func headToHead(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form statsForm
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if stats, err := s.Tournament.HeadToHead(form.Category, tournament.StatsFilter{form.Name, form.From, form.To}); err != nil {
+		web.WriteJsonError(w, err)
 	} else {
-		web.WriteJson(w, JSONResponse{"ranks": ranks, "matches": matches})
+		web.WriteJson(w, JSONResponse{"headtohead": stats})
 	}
 }
 
+func mapStats(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form statsForm
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if stats, err := s.Tournament.MapStats(form.Category, tournament.StatsFilter{form.Name, form.From, form.To}); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"maps": stats})
+	}
+}
+
+func createBracket(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `json:"name" form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Format   string                        `json:"format" form:"format" validate:"required"`
+		BestOf   int64                         `json:"best_of" form:"best_of"`
+		Maps     string                        `json:"maps" form:"maps"`
+		Size     int64                         `json:"size" form:"size"`
+		Token    string                        `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may create brackets"), http.StatusForbidden)
+	} else {
+		if form.BestOf == 0 {
+			form.BestOf = 1
+		}
+		if id, err := s.Tournament.CreateBracket(form.Name, form.Category, form.Format, int(form.BestOf), splitList(form.Maps), int(form.Size), time.Now()); err != nil {
+			web.WriteJsonError(w, err)
+		} else if bracket, err := s.Tournament.GetBracket(id); err != nil {
+			web.WriteJsonError(w, err)
+		} else {
+			web.WriteJson(w, bracket)
+		}
+	}
+}
+
+func brackets(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if brackets, err := s.Tournament.ListBrackets(form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"brackets": brackets})
+	}
+}
+
+func bracket(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if bracket, err := s.Tournament.GetBracket(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, bracket)
+	}
+}
+
+func createSwiss(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `json:"name" form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Rounds   int64                         `json:"rounds" form:"rounds"`
+		Maps     string                        `json:"maps" form:"maps"`
+		Token    string                        `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may create Swiss tournaments"), http.StatusForbidden)
+	} else if id, err := s.Tournament.CreateSwiss(form.Name, form.Category, int(form.Rounds), splitList(form.Maps), time.Now()); err != nil {
+		web.WriteJsonError(w, err)
+	} else if swiss, err := s.Tournament.GetSwiss(id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"swiss": swiss, "standings": swiss.Standings()})
+	}
+}
+
+func swissList(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if tournaments, err := s.Tournament.ListSwiss(form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"swiss": tournaments})
+	}
+}
+
+func swiss(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if swiss, err := s.Tournament.GetSwiss(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"swiss": swiss, "standings": swiss.Standings()})
+	}
+}
+
+func requestScrimmage(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Opponent string                        `json:"opponent" form:"opponent" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Maps     string                        `json:"maps" form:"maps"`
+		Count    int64                         `json:"count" form:"count"`
+		Token    string                        `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only players may request scrimmages"), http.StatusForbidden)
+	} else {
+		if form.Count == 0 {
+			form.Count = 1
+		}
+		if id, err := s.Tournament.RequestScrimmage(caller.Name, form.Opponent, form.Category, splitList(form.Maps), int(form.Count), time.Now()); err != nil {
+			web.WriteJsonError(w, err)
+		} else if scrimmage, err := s.Tournament.GetScrimmage(id); err != nil {
+			web.WriteJsonError(w, err)
+		} else {
+			web.WriteJson(w, scrimmage)
+		}
+	}
+}
+
+func scrimmages(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name     string                        `json:"name" form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if scrimmages, err := s.Tournament.ListScrimmages(form.Name, form.Category); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"scrimmages": scrimmages})
+	}
+}
+
+func scrimmage(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if scrimmage, err := s.Tournament.GetScrimmage(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, scrimmage)
+	}
+}
+
+func requestRegression(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Category  tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Baseline  string                        `json:"baseline" form:"baseline" validate:"required"`
+		Candidate string                        `json:"candidate" form:"candidate" validate:"required"`
+		Maps      string                        `json:"maps" form:"maps"`
+		Token     string                        `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only players may request regressions"), http.StatusForbidden)
+	} else if id, err := s.Tournament.RequestRegression(caller.Name, form.Category, form.Baseline, form.Candidate, splitList(form.Maps), time.Now()); err != nil {
+		web.WriteJsonError(w, err)
+	} else if scrimmage, err := s.Tournament.GetScrimmage(id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, scrimmage)
+	}
+}
+
+func regression(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name      string                        `json:"name" form:"name" validate:"required"`
+		Category  tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Baseline  string                        `json:"baseline" form:"baseline" validate:"required"`
+		Candidate string                        `json:"candidate" form:"candidate" validate:"required"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if regression, err := s.Tournament.Regression(form.Name, form.Category, form.Baseline, form.Candidate); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"regression": regression})
+	}
+}
+
+func createSeason(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name  string `json:"name" form:"name" validate:"required"`
+		Token string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may create seasons"), http.StatusForbidden)
+	} else if id, err := s.Tournament.CreateSeason(form.Name, time.Now()); err != nil {
+		web.WriteJsonError(w, err)
+	} else if season, err := s.Tournament.GetSeason(id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, season)
+	}
+}
+
+func seasons(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	if seasons, err := s.Tournament.ListSeasons(); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"seasons": seasons})
+	}
+}
+
+func season(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if season, err := s.Tournament.GetSeason(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, season)
+	}
+}
+
+func createPhase(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		SeasonId int64                         `json:"season_id" form:"season_id" validate:"required,nonzero"`
+		Name     string                        `json:"name" form:"name" validate:"required"`
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Format   string                        `json:"format" form:"format" validate:"required"`
+		Maps     string                        `json:"maps" form:"maps"`
+		Pool     string                        `json:"pool" form:"pool"`
+		Start    string                        `json:"start" form:"start" validate:"required"`
+		Freeze   string                        `json:"freeze" form:"freeze" validate:"required"`
+		Scoring  string                        `json:"scoring" form:"scoring"`
+		Token    string                        `json:"token" form:"token"`
+	}
+	var scoring *tournament.ScoringRules
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may create phases"), http.StatusForbidden)
+	} else if start, err := time.Parse(time.RFC3339, form.Start); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusBadRequest)
+	} else if freeze, err := time.Parse(time.RFC3339, form.Freeze); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusBadRequest)
+	} else if err := parseScoring(form.Scoring, &scoring); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusBadRequest)
+	} else if id, err := s.Tournament.AddPhase(form.SeasonId, form.Name, form.Category, form.Format, splitList(form.Maps), form.Pool, start, freeze, scoring); err != nil {
+		web.WriteJsonError(w, err)
+	} else if phase, err := s.Tournament.GetPhase(id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, phase)
+	}
+}
+
+// Reads scoring rules written as JSON, leaving scoring nil when value is empty
+func parseScoring(value string, scoring **tournament.ScoringRules) error {
+	if value == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(value), scoring)
+}
+
+func startPhase(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	updatePhase(w, r, s, func(id int64) error {
+		return s.Tournament.StartPhase(id, time.Now())
+	})
+}
+
+func finishPhase(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	updatePhase(w, r, s, s.Tournament.FinishPhase)
+}
+
+// Applies an admin's change to a phase and writes the updated phase
+func updatePhase(w http.ResponseWriter, r *http.Request, s *ServerState, update func(int64) error) {
+	var form struct {
+		Id    int64  `json:"id" form:"id" validate:"required,nonzero"`
+		Token string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may run phases"), http.StatusForbidden)
+	} else if err := update(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else if phase, err := s.Tournament.GetPhase(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, phase)
+	}
+}
+
+func generatePhaseMaps(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id         int64  `json:"id" form:"id" validate:"required,nonzero"`
+		Name       string `json:"name" form:"name" validate:"required"`
+		Count      int64  `json:"count" form:"count" validate:"required,nonzero"`
+		Parameters string `json:"parameters" form:"parameters"`
+		Token      string `json:"token" form:"token"`
+	}
+	parameters := arena.DefaultMapParameters
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if caller, err := authenticate(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if !caller.Admin {
+		web.WriteJsonErrorWithCode(w, errors.New("Only admins may generate maps"), http.StatusForbidden)
+	} else if !NameRegex.MatchString(form.Name) {
+		web.WriteJsonErrorWithCode(w, errors.New("Invalid Name"), http.StatusBadRequest)
+	} else if form.Count < 1 || form.Count > MaxGeneratedMaps {
+		web.WriteJsonErrorWithCode(w, fmt.Errorf("Between 1 and %v maps can be generated at once", MaxGeneratedMaps), http.StatusBadRequest)
+	} else if form.Parameters != "" && json.Unmarshal([]byte(form.Parameters), &parameters) != nil {
+		web.WriteJsonErrorWithCode(w, errors.New("Invalid map parameters"), http.StatusBadRequest)
+	} else if phase, err := s.Tournament.GetPhase(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else if phase.Category != tournament.CategoryBattlecode2016 {
+		web.WriteJsonErrorWithCode(w, fmt.Errorf("Maps can only be generated for %v", tournament.CategoryBattlecode2016), http.StatusBadRequest)
+	} else {
+		maps := map[string]string{}
+		for i := int64(0); i < form.Count; i++ {
+			name := fmt.Sprintf("%v_%v", form.Name, i+1)
+			p := parameters
+			p.Seed += i
+			if source, err := arena.GenerateMap(name, p); err != nil {
+				web.WriteJsonErrorWithCode(w, err, http.StatusBadRequest)
+				return
+			} else {
+				maps[name] = string(source)
+			}
+		}
+		if err := s.Tournament.AddPhaseMaps(form.Id, maps); err != nil {
+			web.WriteJsonError(w, err)
+		} else if phase, err := s.Tournament.GetPhase(form.Id); err != nil {
+			web.WriteJsonError(w, err)
+		} else {
+			web.WriteJson(w, phase)
+		}
+	}
+}
+
+func phase(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Id int64 `json:"id" form:"id" validate:"required,nonzero"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if phase, err := s.Tournament.GetPhase(form.Id); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, phase)
+	}
+}
+
+// The non-empty items of a comma separated form value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func runLatestMatches(w http.ResponseWriter, r *http.Request, s *ServerState) {
 	var form struct {
 		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Pool     string                        `json:"pool" form:"pool"`
 	}
 	if err := parseForm(r, &form); err != nil {
 		web.WriteJsonWebError(w, err)
-	} else if err := s.Tournament.RunLatestMatches(form.Category); err != nil {
+	} else if plan, err := s.Tournament.PlanLatestMatches(form.Category, form.Pool); err != nil {
 		web.WriteJsonError(w, err)
-	} else if err := s.Tournament.CalculateLeaderboard(form.Category); err != nil {
+	} else {
+		plan = s.Tournament.EnqueuePlan(plan)
+		web.WriteJson(w, JSONResponse{"ids": plan.Scheduled(), "plan": plan})
+	}
+}
+
+func matchPlan(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Category tournament.TournamentCategory `json:"category" form:"category" validate:"required"`
+		Pool     string                        `json:"pool" form:"pool"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if plan, err := s.Tournament.PlanLatestMatches(form.Category, form.Pool); err != nil {
 		web.WriteJsonError(w, err)
 	} else {
-		web.WriteJson(w, JSONResponse{"success": true})
+		web.WriteJson(w, JSONResponse{"plan": plan})
 	}
 }
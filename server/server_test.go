@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -39,7 +40,7 @@ func ServerTest(test *testing.T, f func(*testutil.T, *ServerState)) {
 		if replay, err := ioutil.ReadFile("../simulator/" + string(tournament.CategoryBattlecode2015) + "/replay.xml.gz"); err != nil {
 			t.ErrorNow()
 		} else {
-			dummyArena := arena.DummyArena{time.Now(), arena.MatchResult{arena.WinnerA, arena.ReasonVictory, replay}, nil}
+			dummyArena := arena.DummyArena{time.Now(), arena.MatchResult{arena.WinnerA, arena.ReasonVictory, arena.ReasonCodeDestruction, 1, 0, replay, arena.MatchLogs{"EngineFoo", "TeamAFoo", "TeamBFoo", "StderrFoo"}}, nil}
 			remote := &git.TempRemote{}
 			bootstrap := &arena.MinimalBootstrap{"../arena/internal/categories"}
 			if database, err := tournament.NewInMemoryDatabase(); err != nil {
@@ -47,15 +48,19 @@ func ServerTest(test *testing.T, f func(*testutil.T, *ServerState)) {
 			} else if err = database.MigrateSchema(); err != nil {
 				t.ErrorNow(err)
 			} else {
-				tournament := tournament.NewTournament(database, dummyArena, bootstrap, host, remote)
+				tm := tournament.NewTournament(database, dummyArena, bootstrap, host, remote)
+				t.CheckError(tm.StartMatchQueue(1, tournament.SystemClock()))
+				defer tm.Queue.Stop()
 				properties := Properties{
-					":memory:",
-					"8081",
-					":temp:",
-					nil,
-					"../arena",
+					DatabaseURL:   ":memory:",
+					ServerPort:    "8081",
+					GitServerType: ":temp:",
+					ResourcePath:  "..",
+					MatchWorkers:  1,
+					AdminToken:    "AdminFoo",
+					WorkerToken:   "WorkerFoo",
 				}
-				server := NewServer(tournament, properties)
+				server := NewServer(tm, properties)
 				f(t, server)
 			}
 		}
@@ -130,6 +135,20 @@ func sendJSONPostExpectStatus(t *testutil.T, server *ServerState, expectedCode i
 	}
 }
 
+// The source of a map shipped with a category, which passes validation
+func sampleMap(t *testutil.T, category tournament.TournamentCategory) string {
+	if files, err := filepath.Glob(filepath.Join("..", "arena", "internal", "categories", string(category), "maps", "*.xml")); err != nil {
+		t.ErrorNow(err)
+	} else if len(files) == 0 {
+		t.ErrorNow("no maps for", category)
+	} else if bs, err := ioutil.ReadFile(files[0]); err != nil {
+		t.ErrorNow(err)
+	} else {
+		return string(bs)
+	}
+	return ""
+}
+
 func sendRawRequest(t *testutil.T, server *ServerState, expectedCode int, req *http.Request) *bytes.Buffer {
 	resp := httptest.NewRecorder()
 	server.HttpServer.Handler.ServeHTTP(resp, req)
@@ -201,6 +220,18 @@ func TestParseForm(test *testing.T) {
 	}
 }
 
+func TestSandboxProperties(test *testing.T) {
+	t := (*testutil.T)(test)
+	properties := Properties{DatabaseURL: "/var/lib/battleref/battleref.sqlite3", ResourcePath: "/srv/battleref", ArenaSandbox: &arena.Sandbox{WorkDir: "/var/tmp/battleref"}}
+	if _, err := properties.Sandbox(); err != nil {
+		t.ErrorNow(err)
+	}
+	properties.DatabaseURL = "/srv/battleref/battleref.sqlite3"
+	if _, err := properties.Sandbox(); err == nil {
+		t.ErrorNow("Expected an error for a database beside the arena resources")
+	}
+}
+
 func TestParseFormJSON(test *testing.T) {
 	t := (*testutil.T)(test)
 	if req, err := http.NewRequest("POST", "/", strings.NewReader("{\"foo\":\"x\",\"bar\":\"y\"}")); err != nil {
@@ -437,18 +468,70 @@ func TestMaps(t *testing.T) {
 			t.Error("expected no maps", r)
 			t.FailNow()
 		}
-		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameFoo", "source": "SourceFoo", "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
 		if r := sendGet(t, server, "/maps?category="+string(tournament.CategoryTest)); !compareStrings(Json(t, r).Key("data").Key("maps").Array(), []string{"NameFoo"}) {
 			t.Error("expected single player NameFoo", r)
 			t.FailNow()
 		}
-		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameBar", "source": "SourceBar", "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameBar", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
 		if r := sendGet(t, server, "/maps?category="+string(tournament.CategoryTest)); !compareStringsUnordered(Json(t, r).Key("data").Key("maps").Array(), []string{"NameFoo", "NameBar"}) {
 			t.ErrorNow("expected two maps NameFoo, NameBar", r)
 		}
 	})
 }
 
+func TestCreateInvalidMap(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		source := strings.Replace(sampleMap(t, tournament.CategoryBattlecode2016), `team="B"`, `team="NEUTRAL"`, -1)
+		r := sendJSONPostExpectStatus(t, server, http.StatusBadRequest, "/map/create", map[string]string{"name": "MapFoo", "source": source, "category": string(tournament.CategoryBattlecode2016)})
+		if errors := Json(t, r).Key("error").Key("errors"); errors.Len() != 1 {
+			t.ErrorNow("expected one error item", r)
+		} else if reason := errors.At(0).Key("Reason").String(); reason != "Missing robots" {
+			t.ErrorNow("expected missing robots", reason)
+		}
+		sendJSONPostExpectStatus(t, server, http.StatusBadRequest, "/map/create", map[string]string{"name": "MapFoo", "source": "SourceFoo", "category": string(tournament.CategoryTest)})
+		if r := sendGet(t, server, "/maps?category="+string(tournament.CategoryBattlecode2016)); Json(t, r).Key("data").Key("maps").Len() > 0 {
+			t.ErrorNow("expected no maps", r)
+		}
+	})
+}
+
+func TestAnalyzeMap(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		source := sampleMap(t, tournament.CategoryTest)
+		r := sendJSONPost(t, server, "/map/analyze", map[string]string{"source": source, "category": string(tournament.CategoryTest)})
+		symmetry := Json(t, r).Key("data").Key("analysis").Key("symmetry").String()
+		if Json(t, r).Key("data").Key("analysis").Key("teams").Key("A").Key("starts").Len() != 1 {
+			t.ErrorNow("expected team A to start from its HQ", r)
+		}
+		r = sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": source, "category": string(tournament.CategoryTest)})
+		if s := Json(t, r).Key("data").Key("analysis").Key("symmetry").String(); s != symmetry {
+			t.ErrorNow("expected map creation to report symmetry", symmetry, r)
+		}
+		r = sendJSONPost(t, server, "/map/analyze", map[string]string{"name": "MapFoo", "category": string(tournament.CategoryTest)})
+		if s := Json(t, r).Key("data").Key("analysis").Key("symmetry").String(); s != symmetry {
+			t.ErrorNow("expected the created map to be analyzed", symmetry, r)
+		}
+		sendJSONPostExpectStatus(t, server, http.StatusBadRequest, "/map/analyze", map[string]string{"category": string(tournament.CategoryTest)})
+		sendJSONPostExpectStatus(t, server, http.StatusBadRequest, "/map/analyze", map[string]string{"source": "SourceFoo", "category": string(tournament.CategoryTest)})
+	})
+}
+
+func TestMapPreview(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryBattlecode2016), "category": string(tournament.CategoryBattlecode2016)})
+		preview := sendRawGet(t, server, "/map/preview?name=MapFoo&category="+string(tournament.CategoryBattlecode2016))
+		if !bytes.HasPrefix(preview, []byte("\x89PNG")) {
+			t.ErrorNow("expected a PNG preview")
+		}
+		if cached := sendRawGet(t, server, "/map/preview?name=MapFoo&category="+string(tournament.CategoryBattlecode2016)); !bytes.Equal(cached, preview) {
+			t.ErrorNow("expected the same preview again")
+		}
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		sendGetExpectStatus(t, server, http.StatusBadRequest, "/map/preview?name=MapFoo&category="+string(tournament.CategoryTest))
+	})
+}
+
 func TestSubmitHash(test *testing.T) {
 	t := (*testutil.T)(test)
 	if !CommitHashRegex.MatchString(SampleCommitHash) {
@@ -474,6 +557,18 @@ func TestSubmit(t *testing.T) {
 	})
 }
 
+func TestCommitStatus(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		if r := sendJSONPost(t, server, "/submit", map[string]string{"name": "NameFoo", "category": string(tournament.CategoryTest), "commit_hash": SampleCommitHash}); Json(t, r).Key("data").Key("status").String() != tournament.SubmissionAccepted {
+			t.ErrorNow(r, " expected ", tournament.SubmissionAccepted)
+		}
+		if r := sendGet(t, server, fmt.Sprintf("/commit/status?name=NameFoo&category=%v&commit_hash=%v", tournament.CategoryTest, SampleCommitHash)); Json(t, r).Key("data").Key("status").String() != tournament.SubmissionAccepted {
+			t.ErrorNow(r, " expected ", tournament.SubmissionAccepted)
+		}
+	})
+}
+
 func TestSubmitPlayerNameError(t *testing.T) {
 	ServerTest(t, func(t *testutil.T, server *ServerState) {
 		if r := sendJSONPostExpectStatus(t, server, http.StatusInternalServerError, "/submit", map[string]string{"name": "NameFoo", "category": string(tournament.CategoryTest), "commit_hash": SampleCommitHash}); Json(t, r).Key("error").Key("message").String() != "Unknown player" {
@@ -519,15 +614,70 @@ func TestCommits(t *testing.T) {
 func TestReplay(t *testing.T) {
 	ServerTest(t, func(t *testutil.T, server *ServerState) {
 		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
-		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameBar", "source": "SourceBar", "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameBar", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
 		r := sendGet(t, server, "/commits?name=NameFoo&category="+string(tournament.CategoryTest))
 		commit := Json(t, r).Key("data").Key("commits").At(0).String()
 		r = sendJSONPost(t, server, "/match/run", map[string]string{"player1": "NameFoo", "player2": "NameFoo", "category": string(tournament.CategoryTest), "commit1": commit, "commit2": commit, "map": "NameBar"})
 		id := Json(t, r).Key("data").Key("id").Int()
+		server.Tournament.Queue.Wait()
 		sendRawGet(t, server, "/replay?id="+strconv.Itoa(id))
 	})
 }
 
+func TestMatchLogs(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		r := sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		fooToken := Json(t, r).Key("data").Key("token").String()
+		r = sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		barToken := Json(t, r).Key("data").Key("token").String()
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		r = sendGet(t, server, "/commits?name=NameFoo&category="+string(tournament.CategoryTest))
+		commit := Json(t, r).Key("data").Key("commits").At(0).String()
+		r = sendJSONPost(t, server, "/match/run", map[string]string{"player1": "NameFoo", "player2": "NameFoo", "category": string(tournament.CategoryTest), "commit1": commit, "commit2": commit, "map": "MapFoo"})
+		id := Json(t, r).Key("data").Key("id").Int()
+		server.Tournament.Queue.Wait()
+
+		r = sendGet(t, server, fmt.Sprintf("/match/logs?id=%v&token=%v", id, fooToken))
+		if logs := Json(t, r).Key("data").Key("logs").Node.(map[string]interface{}); len(logs) != 3 || logs["player1"] != "TeamAFoo" || logs["player2"] != "TeamBFoo" || logs["engine"] != "EngineFoo" {
+			t.ErrorNow("expected engine and team logs", r)
+		}
+		if req, err := http.NewRequest("GET", fmt.Sprintf("/match/logs?id=%v", id), nil); err != nil {
+			t.ErrorNow(err)
+		} else {
+			req.Header.Set("Authorization", "Bearer AdminFoo")
+			r = sendRequest(t, server, http.StatusOK, req)
+			if logs := Json(t, r).Key("data").Key("logs").Node.(map[string]interface{}); len(logs) != 4 || logs["stderr"] != "StderrFoo" {
+				t.ErrorNow("expected all logs", r)
+			}
+		}
+		sendGetExpectStatus(t, server, http.StatusForbidden, fmt.Sprintf("/match/logs?id=%v&token=%v", id, barToken))
+		sendGetExpectStatus(t, server, http.StatusUnauthorized, fmt.Sprintf("/match/logs?id=%v", id))
+		sendGetExpectStatus(t, server, http.StatusUnauthorized, fmt.Sprintf("/match/logs?id=%v&token=unknown", id))
+	})
+}
+
+func TestRerunMatch(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		r := sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		token := Json(t, r).Key("data").Key("token").String()
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		r = sendGet(t, server, "/commits?name=NameFoo&category="+string(tournament.CategoryTest))
+		commit := Json(t, r).Key("data").Key("commits").At(0).String()
+		r = sendJSONPost(t, server, "/match/run", map[string]string{"player1": "NameFoo", "player2": "NameFoo", "category": string(tournament.CategoryTest), "commit1": commit, "commit2": commit, "map": "MapFoo"})
+		id := Json(t, r).Key("data").Key("id").Int()
+		server.Tournament.Queue.Wait()
+
+		sendJSONPostExpectStatus(t, server, http.StatusForbidden, "/match/rerun", map[string]interface{}{"id": id, "token": token})
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/match/rerun", map[string]interface{}{"id": id})
+		sendJSONPost(t, server, "/match/rerun", map[string]interface{}{"id": id, "token": "AdminFoo"})
+		server.Tournament.Queue.Wait()
+		r = sendGet(t, server, fmt.Sprintf("/match/attempts?id=%v", id))
+		if attempts := Json(t, r).Key("data").Key("attempts").Array(); len(attempts) != 2 {
+			t.ErrorNow("expected 2 attempts", r)
+		}
+	})
+}
+
 func TestReplayStream(test *testing.T) {
 	ServerTest(test, func(t *testutil.T, server *ServerState) {
 		go server.Serve()
@@ -535,11 +685,12 @@ func TestReplayStream(test *testing.T) {
 		time.Sleep(time.Microsecond)
 		defer sendPost(t, server, "/shutdown", nil)
 		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryBattlecode2016)})
-		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameBar", "source": "SourceBar", "category": string(tournament.CategoryBattlecode2016)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "NameBar", "source": sampleMap(t, tournament.CategoryBattlecode2016), "category": string(tournament.CategoryBattlecode2016)})
 		r := sendGet(t, server, "/commits?name=NameFoo&category="+string(tournament.CategoryBattlecode2016))
 		commit := Json(t, r).Key("data").Key("commits").At(0).String()
 		r = sendJSONPost(t, server, "/match/run", map[string]string{"player1": "NameFoo", "player2": "NameFoo", "category": string(tournament.CategoryBattlecode2016), "commit1": commit, "commit2": commit, "map": "NameBar"})
 		id := Json(t, r).Key("data").Key("id").Int()
+		server.Tournament.Queue.Wait()
 		msg := make([]byte, 4096)
 		if ws, err := websocket.Dial(fmt.Sprintf("ws://localhost:8081/replay/stream?id=%v", id), "", "http://localhost"); err != nil {
 			t.ErrorNow(err)
@@ -555,3 +706,330 @@ func TestReplayStream(test *testing.T) {
 		}
 	})
 }
+
+func TestRunMatchQueued(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapBar", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		r := sendJSONPost(t, server, "/match/run/latest", map[string]string{"category": string(tournament.CategoryTest)})
+		ids := Json(t, r).Key("data").Key("ids").Array()
+		if len(ids) != 4 {
+			t.ErrorNow("expected 4 queued matches", r)
+		}
+		server.Tournament.Queue.Wait()
+		for _, id := range ids {
+			r = sendGet(t, server, fmt.Sprintf("/match/status?id=%v", id))
+			if result := Json(t, r).Key("data").Key("result").String(); result != tournament.MatchResultWinA {
+				t.ErrorNow("expected", tournament.MatchResultWinA, "not", result)
+			}
+		}
+		if r := sendGet(t, server, "/leaderboard?category="+string(tournament.CategoryTest)); len(Json(t, r).Key("data").Key("ranks").Node.(map[string]interface{})) != 2 {
+			t.ErrorNow("expected 2 ranks", r)
+		} else if len(Json(t, r).Key("data").Key("ratings").Node.(map[string]interface{})) != 2 {
+			t.ErrorNow("expected 2 ratings", r)
+		} else if model := Json(t, r).Key("data").Key("rating_model").String(); model != tournament.DefaultRatingModel {
+			t.ErrorNow("expected the default rating model, not", model)
+		} else if order := Json(t, r).Key("data").Key("ranking").Key("order").Array(); len(order) != 2 {
+			t.ErrorNow("expected both players to be ranked", r)
+		} else if rule := Json(t, r).Key("data").Key("ranking").Key("steps").At(0).Key("rule").String(); rule != tournament.RankByPoints {
+			t.ErrorNow("expected the players to be ordered by points first", r)
+		}
+	})
+}
+
+func TestBracket(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		r := sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		token := Json(t, r).Key("data").Key("token").String()
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapBar", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapBaz", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		form := map[string]interface{}{"name": "Finals", "category": string(tournament.CategoryTest), "format": tournament.BracketDoubleElimination, "best_of": 3, "maps": "MapFoo,MapBar,MapBaz"}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/bracket/create", form)
+		form["token"] = token
+		sendJSONPostExpectStatus(t, server, http.StatusForbidden, "/bracket/create", form)
+		form["token"] = "AdminFoo"
+		r = sendJSONPost(t, server, "/bracket/create", form)
+		id := Json(t, r).Key("data").Key("id").Int()
+		server.Tournament.Queue.Wait()
+
+		r = sendGet(t, server, fmt.Sprintf("/bracket?id=%v", id))
+		if series := Json(t, r).Key("data").Key("series").Array(); len(series) != 3 {
+			t.ErrorNow("expected a winners series, a final and a reset final", r)
+		} else if champion := Json(t, r).Key("data").Key("champion").String(); champion == "" {
+			t.ErrorNow("expected a champion", r)
+		}
+		r = sendGet(t, server, "/brackets?category="+string(tournament.CategoryTest))
+		if brackets := Json(t, r).Key("data").Key("brackets").Array(); len(brackets) != 1 {
+			t.ErrorNow("expected 1 bracket", r)
+		}
+	})
+}
+
+func TestSwiss(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		form := map[string]interface{}{"name": "Qualifier", "category": string(tournament.CategoryTest)}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/swiss/create", form)
+		form["token"] = "AdminFoo"
+		r := sendJSONPost(t, server, "/swiss/create", form)
+		id := Json(t, r).Key("data").Key("swiss").Key("id").Int()
+		server.Tournament.Queue.Wait()
+
+		r = sendGet(t, server, fmt.Sprintf("/swiss?id=%v", id))
+		if Json(t, r).Key("data").Key("swiss").Key("finished").Node != true {
+			t.ErrorNow("expected the tournament to finish after 1 round", r)
+		} else if standings := Json(t, r).Key("data").Key("standings").Array(); len(standings) != 2 {
+			t.ErrorNow("expected 2 standings", r)
+		}
+		r = sendGet(t, server, "/swiss/list?category="+string(tournament.CategoryTest))
+		if tournaments := Json(t, r).Key("data").Key("swiss").Array(); len(tournaments) != 1 {
+			t.ErrorNow("expected 1 Swiss tournament", r)
+		}
+	})
+}
+
+func TestMatchPlan(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		r := sendGet(t, server, "/match/plan?category="+string(tournament.CategoryTest))
+		if matches := Json(t, r).Key("data").Key("plan").Key("matches").Array(); len(matches) != 2 {
+			t.ErrorNow("expected 2 planned matches", r)
+		}
+		r = sendGet(t, server, "/matches?category="+string(tournament.CategoryTest))
+		if matches := Json(t, r).Key("data").Key("matches"); matches.Node != nil && matches.Len() != 0 {
+			t.ErrorNow("expected the plan not to queue matches", r)
+		}
+		r = sendJSONPost(t, server, "/match/run/latest", map[string]string{"category": string(tournament.CategoryTest)})
+		if ids := Json(t, r).Key("data").Key("ids").Array(); len(ids) != 2 {
+			t.ErrorNow("expected 2 queued matches", r)
+		}
+		server.Tournament.Queue.Wait()
+		r = sendGet(t, server, "/match/plan?category="+string(tournament.CategoryTest))
+		if matches := Json(t, r).Key("data").Key("plan").Key("matches").Array(); len(matches) != 0 {
+			t.ErrorNow("expected nothing left to plan", r)
+		} else if played := Json(t, r).Key("data").Key("plan").Key("played").Int(); played != 2 {
+			t.ErrorNow("expected 2 played matches", r)
+		}
+	})
+}
+
+func TestSeasonPhase(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		form := map[string]interface{}{"name": "Season"}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/season/create", form)
+		form["token"] = "AdminFoo"
+		r := sendJSONPost(t, server, "/season/create", form)
+		seasonId := Json(t, r).Key("data").Key("id").Int()
+
+		freeze := time.Now().Add(-time.Minute).Format(time.RFC3339)
+		r = sendJSONPost(t, server, "/phase/create", map[string]interface{}{"season_id": seasonId, "name": "Qualifier", "category": string(tournament.CategoryTest), "format": tournament.PhaseRoundRobin, "start": freeze, "freeze": freeze, "scoring": `{"victory":1,"tiebreakers":["total_wins"]}`, "token": "AdminFoo"})
+		id := Json(t, r).Key("data").Key("id").Int()
+		sendJSONPostExpectStatus(t, server, http.StatusInternalServerError, "/submit", map[string]string{"name": "NameFoo", "category": string(tournament.CategoryTest), "commit_hash": SampleCommitHash})
+
+		sendJSONPost(t, server, "/phase/start", map[string]interface{}{"id": id, "token": "AdminFoo"})
+		server.Tournament.Queue.Wait()
+		r = sendJSONPost(t, server, "/phase/finish", map[string]interface{}{"id": id, "token": "AdminFoo"})
+		if Json(t, r).Key("data").Key("finished").Node != true {
+			t.ErrorNow("expected the phase to finish", r)
+		} else if leaderboard := Json(t, r).Key("data").Key("leaderboard").Array(); len(leaderboard) != 2 {
+			t.ErrorNow("expected a leaderboard of 2 players", r)
+		} else if score := Json(t, r).Key("data").Key("leaderboard").At(0).Key("score").Int(); score != 1 {
+			t.ErrorNow("expected the phase to be scored with its own rules", r)
+		}
+		sendJSONPost(t, server, "/submit", map[string]string{"name": "NameFoo", "category": string(tournament.CategoryTest), "commit_hash": SampleCommitHash})
+		r = sendGet(t, server, fmt.Sprintf("/season?id=%v", seasonId))
+		if phases := Json(t, r).Key("data").Key("phases").Array(); len(phases) != 1 {
+			t.ErrorNow("expected 1 phase", r)
+		}
+		r = sendGet(t, server, "/seasons")
+		if seasons := Json(t, r).Key("data").Key("seasons").Array(); len(seasons) != 1 {
+			t.ErrorNow("expected 1 season", r)
+		}
+	})
+}
+
+func TestGeneratePhaseMaps(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryBattlecode2016), "category": string(tournament.CategoryBattlecode2016)})
+		r := sendJSONPost(t, server, "/season/create", map[string]interface{}{"name": "Season", "token": "AdminFoo"})
+		seasonId := Json(t, r).Key("data").Key("id").Int()
+		start := time.Now().Add(time.Hour).Format(time.RFC3339)
+		r = sendJSONPost(t, server, "/phase/create", map[string]interface{}{"season_id": seasonId, "name": "Qualifier", "category": string(tournament.CategoryBattlecode2016), "format": tournament.PhaseRoundRobin, "maps": "MapFoo", "start": start, "freeze": start, "token": "AdminFoo"})
+		id := Json(t, r).Key("data").Key("id").Int()
+
+		form := map[string]interface{}{"id": id, "name": "Gen", "count": 2, "parameters": `{"width":30,"height":30,"symmetry":"vertical","seed":5}`}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/phase/maps/generate", form)
+		form["token"] = "AdminFoo"
+		r = sendJSONPost(t, server, "/phase/maps/generate", form)
+		if maps := Json(t, r).Key("data").Key("maps"); maps.Len() != 3 || maps.At(1).String() != "Gen_1" || maps.At(2).String() != "Gen_2" {
+			t.ErrorNow("expected two generated maps in the phase", r)
+		}
+		r = sendJSONPost(t, server, "/map/analyze", map[string]string{"name": "Gen_2", "category": string(tournament.CategoryBattlecode2016)})
+		if symmetries := Json(t, r).Key("data").Key("analysis").Key("symmetries"); symmetries.Len() == 0 {
+			t.ErrorNow("expected a symmetric map", r)
+		}
+		form["name"], form["parameters"] = "Bad", `{"symmetry":"spiral"}`
+		sendJSONPostExpectStatus(t, server, http.StatusBadRequest, "/phase/maps/generate", form)
+	})
+}
+
+func TestUpdateAndDeleteMap(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		category := string(tournament.CategoryTest)
+		source := sampleMap(t, tournament.CategoryTest)
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": source, "category": category})
+		form := map[string]interface{}{"name": "MapFoo", "source": source, "category": category}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/map/update", form)
+		form["token"] = "AdminFoo"
+		r := sendJSONPost(t, server, "/map/update", form)
+		if version := Json(t, r).Key("data").Key("version").Int(); version != 2 {
+			t.ErrorNow("expected a second version", r)
+		}
+		form["source"] = "SourceFoo"
+		sendJSONPostExpectStatus(t, server, http.StatusBadRequest, "/map/update", form)
+
+		sendJSONPost(t, server, "/map/delete", map[string]string{"name": "MapFoo", "category": category, "token": "AdminFoo"})
+		r = sendGet(t, server, "/maps?category="+category)
+		if maps := Json(t, r).Key("data").Key("maps"); maps.Len() != 0 {
+			t.ErrorNow("expected a deleted map not to be listed", r)
+		}
+		r = sendGet(t, server, "/map/versions?name=MapFoo&category="+category)
+		if versions := Json(t, r).Key("data").Key("versions"); versions.Len() != 2 || versions.At(1).Key("version").Int() != 2 {
+			t.ErrorNow("expected both versions of the deleted map", r)
+		}
+	})
+}
+
+func TestMapPools(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		category := string(tournament.CategoryTest)
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": category})
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": category})
+		for _, name := range []string{"MapFoo", "MapBar"} {
+			sendJSONPost(t, server, "/map/create", map[string]string{"name": name, "source": sampleMap(t, tournament.CategoryTest), "category": category})
+		}
+		form := map[string]interface{}{"name": "PoolFoo", "category": category, "maps": "MapFoo, MapBaz"}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/pool/set", form)
+		form["token"] = "AdminFoo"
+		sendJSONPostExpectStatus(t, server, http.StatusBadRequest, "/pool/set", form)
+		form["maps"] = "MapFoo"
+		sendJSONPost(t, server, "/pool/set", form)
+
+		r := sendGet(t, server, "/pool?name=PoolFoo&category="+category)
+		if maps := Json(t, r).Key("data").Key("maps"); maps.Len() != 1 || maps.At(0).String() != "MapFoo" {
+			t.ErrorNow("expected the pool's maps", r)
+		}
+		r = sendGet(t, server, "/pools?category="+category)
+		if pools := Json(t, r).Key("data").Key("pools"); pools.Len() != 1 {
+			t.ErrorNow("expected 1 pool", r)
+		}
+		r = sendGet(t, server, "/match/plan?pool=PoolFoo&category="+category)
+		if matches := Json(t, r).Key("data").Key("plan").Key("matches").Array(); len(matches) != 2 {
+			t.ErrorNow("expected 2 planned matches on the pool's map", r)
+		}
+		r = sendGet(t, server, "/match/plan?category="+category)
+		if matches := Json(t, r).Key("data").Key("plan").Key("matches").Array(); len(matches) != 4 {
+			t.ErrorNow("expected 4 planned matches on every map", r)
+		}
+	})
+}
+
+func TestScrimmage(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		r := sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		token := Json(t, r).Key("data").Key("token").String()
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		form := map[string]interface{}{"opponent": "NameBar", "category": string(tournament.CategoryTest)}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/scrimmage/request", form)
+		form["token"] = "AdminFoo"
+		sendJSONPostExpectStatus(t, server, http.StatusForbidden, "/scrimmage/request", form)
+		form["token"] = token
+		r = sendJSONPost(t, server, "/scrimmage/request", form)
+		id := Json(t, r).Key("data").Key("id").Int()
+		server.Tournament.Queue.Wait()
+
+		r = sendGet(t, server, fmt.Sprintf("/scrimmage?id=%v", id))
+		if games := Json(t, r).Key("data").Key("games").Array(); len(games) != 1 {
+			t.ErrorNow("expected 1 game on a random map", r)
+		} else if result := Json(t, r).Key("data").Key("games").At(0).Key("result").String(); result != tournament.MatchResultWinA {
+			t.ErrorNow("expected the scrimmage to be played", r)
+		}
+		r = sendGet(t, server, "/scrimmages?name=NameBar&category="+string(tournament.CategoryTest))
+		if scrimmages := Json(t, r).Key("data").Key("scrimmages").Array(); len(scrimmages) != 1 {
+			t.ErrorNow("expected 1 scrimmage", r)
+		}
+	})
+}
+
+func TestRegression(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		r := sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		token := Json(t, r).Key("data").Key("token").String()
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		commits, err := server.Tournament.ListCommits("NameFoo", tournament.CategoryTest)
+		t.CheckError(err)
+		t.CheckError(server.Tournament.SubmitCommit("NameFoo", tournament.CategoryTest, "candidate", time.Now()))
+		form := map[string]interface{}{"category": string(tournament.CategoryTest), "baseline": commits[0], "candidate": "candidate"}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/regression/request", form)
+		form["token"] = token
+		r = sendJSONPost(t, server, "/regression/request", form)
+		if games := Json(t, r).Key("data").Key("games").Array(); len(games) != 2 {
+			t.ErrorNow("expected the commits to play both sides of the map", r)
+		}
+		server.Tournament.Queue.Wait()
+
+		r = sendGet(t, server, fmt.Sprintf("/regression?name=NameFoo&category=%v&baseline=%v&candidate=candidate", tournament.CategoryTest, commits[0]))
+		if record := Json(t, r).Key("data").Key("regression").Key("maps").Key("MapFoo"); record.Key("wins").Int() != 1 || record.Key("losses").Int() != 1 {
+			t.ErrorNow("expected the candidate to win as team A", r)
+		}
+	})
+}
+
+func TestMatchStats(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/match/run/latest", map[string]string{"category": string(tournament.CategoryTest)})
+		server.Tournament.Queue.Wait()
+
+		r := sendGet(t, server, "/stats/headtohead?category="+string(tournament.CategoryTest))
+		if wins := Json(t, r).Key("data").Key("headtohead").Key("records").Key("NameFoo").Key("NameBar").Key("wins").Int(); wins != 1 {
+			t.ErrorNow("expected 1 win as team A", r)
+		}
+		r = sendGet(t, server, "/stats/maps?category="+string(tournament.CategoryTest))
+		if played := Json(t, r).Key("data").Key("maps").Key("records").Key("NameBar").Key("MapFoo").Key("losses").Int(); played != 1 {
+			t.ErrorNow("expected 1 loss as team B", r)
+		}
+		sendGetExpectStatus(t, server, http.StatusInternalServerError, "/stats/maps?category="+string(tournament.CategoryTest)+"&name=NameFoo&from=unknown")
+	})
+}
+
+func TestLeaderboardHistory(t *testing.T) {
+	ServerTest(t, func(t *testutil.T, server *ServerState) {
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, tournament.CategoryTest), "category": string(tournament.CategoryTest)})
+		sendJSONPost(t, server, "/match/run/latest", map[string]string{"category": string(tournament.CategoryTest)})
+		server.Tournament.Queue.Wait()
+
+		r := sendGet(t, server, "/leaderboard/history?name=NameFoo&category="+string(tournament.CategoryTest))
+		if history := Json(t, r).Key("data").Key("history").Array(); len(history) == 0 {
+			t.ErrorNow("expected a snapshot after the matches were played", r)
+		} else if rank := Json(t, r).Key("data").Key("history").At(len(history) - 1).Key("rank").Int(); rank != 1 {
+			t.ErrorNow("expected the players to tie for first", r)
+		}
+	})
+}
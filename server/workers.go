@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"github.com/GlenKelley/battleref/arena"
+	"github.com/GlenKelley/battleref/web"
+	"net/http"
+)
+
+func remoteArena(s *ServerState) (*arena.RemoteArena, error) {
+	if remote, ok := s.Tournament.Arena.(*arena.RemoteArena); ok {
+		return remote, nil
+	} else {
+		return nil, errors.New("Server is not configured for remote workers")
+	}
+}
+
+// Lost leases and unknown workers are conflicts, which tell a worker to abandon its job or register again
+func writeWorkerError(w http.ResponseWriter, err error) {
+	if err == arena.ErrLeaseLost || err == arena.ErrUnknownWorker {
+		web.WriteJsonErrorWithCode(w, err, http.StatusConflict)
+	} else {
+		web.WriteJsonError(w, err)
+	}
+}
+
+func workers(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Token string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if err := authenticateWorker(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if remote, err := remoteArena(s); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"workers": remote.Workers()})
+	}
+}
+
+func registerWorker(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Name  string `json:"name" form:"name" validate:"required"`
+		Token string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if err := authenticateWorker(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if remote, err := remoteArena(s); err != nil {
+		web.WriteJsonError(w, err)
+	} else if worker, err := remote.Register(form.Name); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		web.WriteJson(w, arena.RemoteRegistration{worker, remote.LeaseDuration.Seconds()})
+	}
+}
+
+func leaseJob(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Worker string `json:"worker" form:"worker" validate:"required"`
+		Token  string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if err := authenticateWorker(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if remote, err := remoteArena(s); err != nil {
+		web.WriteJsonError(w, err)
+	} else if job, err := remote.Lease(form.Worker); err != nil {
+		writeWorkerError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"job": job})
+	}
+}
+
+func jobHeartbeat(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Worker string `json:"worker" form:"worker" validate:"required"`
+		Job    string `json:"job" form:"job" validate:"required"`
+		Token  string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if err := authenticateWorker(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if remote, err := remoteArena(s); err != nil {
+		web.WriteJsonError(w, err)
+	} else if err := remote.Heartbeat(form.Worker, form.Job); err != nil {
+		writeWorkerError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"job": form.Job})
+	}
+}
+
+func jobSource(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Worker string `json:"worker" form:"worker" validate:"required"`
+		Job    string `json:"job" form:"job" validate:"required"`
+		Player int64  `json:"player" form:"player" validate:"required,nonzero"`
+		Token  string `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if err := authenticateWorker(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if remote, err := remoteArena(s); err != nil {
+		web.WriteJsonError(w, err)
+	} else {
+		// The archive is buffered so that a failure can still be reported as an error response
+		buffer := &bytes.Buffer{}
+		if err := remote.WriteSource(r.Context(), form.Worker, form.Job, int(form.Player), buffer); err != nil {
+			writeWorkerError(w, err)
+		} else {
+			w.Header().Add(web.HeaderContentType, "application/x-tar")
+			w.Write(buffer.Bytes())
+		}
+	}
+}
+
+func completeJob(w http.ResponseWriter, r *http.Request, s *ServerState) {
+	var form struct {
+		Worker string             `json:"worker" form:"worker" validate:"required"`
+		Job    string             `json:"job" form:"job" validate:"required"`
+		Result arena.RemoteResult `json:"result"`
+		Token  string             `json:"token" form:"token"`
+	}
+	if err := parseForm(r, &form); err != nil {
+		web.WriteJsonWebError(w, err)
+	} else if err := authenticateWorker(r, form.Token, s); err != nil {
+		web.WriteJsonErrorWithCode(w, err, http.StatusUnauthorized)
+	} else if remote, err := remoteArena(s); err != nil {
+		web.WriteJsonError(w, err)
+	} else if err := remote.Complete(form.Worker, form.Job, form.Result); err != nil {
+		writeWorkerError(w, err)
+	} else {
+		web.WriteJson(w, JSONResponse{"job": form.Job})
+	}
+}
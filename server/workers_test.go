@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/GlenKelley/battleref/arena"
+	"github.com/GlenKelley/battleref/testing"
+	"github.com/GlenKelley/battleref/tournament"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A runMatch.sh which checks the staged sources and reports a tiebreak win for team B
+const workerRunMatch = `#! /bin/bash
+set -e
+while getopts "r:d:p:P:c:C:m:M:s:" opt; do
+  case $opt in
+    d) DIR="$OPTARG" ;;
+    p) PLAYER1="$OPTARG" ;;
+    P) PLAYER2="$OPTARG" ;;
+    s) STAGED="$OPTARG" ;;
+  esac
+done
+test -n "$(ls "$STAGED/$PLAYER1")"
+test -n "$(ls "$STAGED/$PLAYER2")"
+cp %q "$DIR/replay.xml.gz"
+echo "     [java] [server]          team3 (B) wins (round 2000)" > "$DIR/output.log"
+echo "     [java] [server] Reason: The winning team won on tiebreakers (more towers remaining)." >> "$DIR/output.log"
+`
+
+func TestRemoteWorker(test *testing.T) {
+	ServerTest(test, func(t *testutil.T, server *ServerState) {
+		resourceDir, err := ioutil.TempDir(os.TempDir(), "workerArena")
+		t.CheckError(err)
+		defer os.RemoveAll(resourceDir)
+		category := tournament.CategoryBattlecode2015
+		replay, err := filepath.Abs("../simulator/battlecode2015/replay.xml.gz")
+		t.CheckError(err)
+		t.CheckError(os.Mkdir(filepath.Join(resourceDir, string(category)), 0755))
+		t.CheckError(ioutil.WriteFile(filepath.Join(resourceDir, string(category), "runMatch.sh"), []byte(fmt.Sprintf(workerRunMatch, replay)), 0755))
+
+		server.Tournament.Arena = arena.NewRemoteArena(time.Minute)
+		httpServer := httptest.NewServer(server.HttpServer.Handler)
+		defer httpServer.Close()
+		worker := arena.NewWorker(httpServer.URL, "localhost", "WorkerFoo", arena.LocalArena{resourceDir, nil, nil, nil})
+		worker.PollInterval = 10 * time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go worker.Run(ctx)
+
+		r := sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(category)})
+		commit1 := Json(t, r).Key("data").Key("commit_hash").String()
+		r = sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(category)})
+		commit2 := Json(t, r).Key("data").Key("commit_hash").String()
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, category), "category": string(category)})
+		r = sendJSONPost(t, server, "/match/run", map[string]string{"player1": "NameFoo", "player2": "NameBar", "commit1": commit1, "commit2": commit2, "category": string(category), "map": "MapFoo"})
+		id := Json(t, r).Key("data").Key("id").Int()
+		server.Tournament.Queue.Wait()
+
+		r = sendGet(t, server, fmt.Sprintf("/match/status?id=%v", id))
+		if result := Json(t, r).Key("data").Key("result").String(); result != tournament.MatchResultTieB {
+			t.ErrorNow("expected", tournament.MatchResultTieB, "not", result)
+		}
+		sendGetExpectStatus(t, server, http.StatusUnauthorized, "/workers")
+		r = sendGet(t, server, "/workers?token=WorkerFoo")
+		if workers := Json(t, r).Key("data").Key("workers").Array(); len(workers) != 1 {
+			t.ErrorNow("expected 1 registered worker", r)
+		}
+	})
+}
+
+func TestWorkerAuthentication(test *testing.T) {
+	ServerTest(test, func(t *testutil.T, server *ServerState) {
+		category := tournament.CategoryBattlecode2015
+		replay, err := ioutil.ReadFile("../simulator/battlecode2015/replay.xml.gz")
+		t.CheckError(err)
+		server.Tournament.Arena = arena.NewRemoteArena(time.Minute)
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/worker/register", map[string]string{"name": "WorkerA"})
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/worker/register", map[string]string{"name": "WorkerA", "token": "TokenFoo"})
+		r := sendJSONPost(t, server, "/worker/register", map[string]string{"name": "WorkerA", "token": "WorkerFoo"})
+		workerA := Json(t, r).Key("data").Key("worker").Key("id").String()
+		r = sendJSONPost(t, server, "/worker/register", map[string]string{"name": "WorkerB", "token": "AdminFoo"})
+		workerB := Json(t, r).Key("data").Key("worker").Key("id").String()
+
+		r = sendJSONPost(t, server, "/register", map[string]string{"name": "NameFoo", "public_key": SamplePublicKey, "category": string(category)})
+		commit1, token := Json(t, r).Key("data").Key("commit_hash").String(), Json(t, r).Key("data").Key("token").String()
+		r = sendJSONPost(t, server, "/register", map[string]string{"name": "NameBar", "public_key": SamplePublicKey2, "category": string(category)})
+		commit2 := Json(t, r).Key("data").Key("commit_hash").String()
+		sendJSONPost(t, server, "/map/create", map[string]string{"name": "MapFoo", "source": sampleMap(t, category), "category": string(category)})
+		r = sendJSONPost(t, server, "/match/run", map[string]string{"player1": "NameFoo", "player2": "NameBar", "commit1": commit1, "commit2": commit2, "category": string(category), "map": "MapFoo"})
+		id := Json(t, r).Key("data").Key("id").Int()
+
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/worker/lease", map[string]string{"worker": workerA, "token": token})
+		var job string
+		for i := 0; i < 500 && job == ""; i++ {
+			r = sendJSONPost(t, server, "/worker/lease", map[string]string{"worker": workerA, "token": "WorkerFoo"})
+			if node := Json(t, r).Key("data").Key("job"); node.Node != nil {
+				job = node.Key("id").String()
+			} else {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		if job == "" {
+			t.ErrorNow("expected a job to be leased")
+		}
+		sendGetExpectStatus(t, server, http.StatusUnauthorized, fmt.Sprintf("/worker/source?worker=%v&job=%v&player=1", workerA, job))
+		result := arena.RemoteResult{Result: arena.MatchResult{Winner: arena.WinnerB, Reason: arena.ReasonTie}, Replay: replay}
+		form := map[string]interface{}{"worker": workerA, "job": job, "result": result}
+		sendJSONPostExpectStatus(t, server, http.StatusUnauthorized, "/worker/complete", form)
+		form["worker"], form["token"] = workerB, "WorkerFoo"
+		sendJSONPostExpectStatus(t, server, http.StatusConflict, "/worker/complete", form)
+		form["worker"] = workerA
+		sendJSONPost(t, server, "/worker/complete", form)
+		server.Tournament.Queue.Wait()
+
+		r = sendGet(t, server, fmt.Sprintf("/match/status?id=%v", id))
+		if result := Json(t, r).Key("data").Key("result").String(); result != tournament.MatchResultTieB {
+			t.ErrorNow("expected the leasing worker's result", result)
+		}
+	})
+}
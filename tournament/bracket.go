@@ -0,0 +1,465 @@
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	BracketSingleElimination = "single"
+	BracketDoubleElimination = "double"
+)
+
+// The parts of a bracket. A double elimination bracket ends with a final between the winners of the
+// winners and losers brackets, and a reset final which is only played if the player from the losers bracket wins.
+const (
+	BracketWinners = "winners"
+	BracketLosers  = "losers"
+	BracketFinal   = "final"
+	BracketReset   = "reset"
+)
+
+// Serialises bracket advancement, so a series is never given the same game twice
+var bracketMutex sync.Mutex
+
+// A seeded elimination bracket where each series is best of BestOf matches, played over Maps in turn
+type Bracket struct {
+	Id       int64              `json:"id"`
+	Name     string             `json:"name"`
+	Category TournamentCategory `json:"category"`
+	Format   string             `json:"format"`
+	BestOf   int                `json:"best_of"`
+	Maps     []string           `json:"maps"`
+	Seeds    []Submission       `json:"seeds"`
+	Champion string             `json:"champion"`
+	Created  time.Time          `json:"created"`
+	Series   []BracketSeries    `json:"series"`
+}
+
+// A place in a series. A ready slot without a name is a bye.
+type BracketSlot struct {
+	Name   string `json:"name"`
+	Commit string `json:"commit"`
+	Seed   int    `json:"seed"`
+	Ready  bool   `json:"ready"`
+}
+
+// One match of a series, Player1 is the player who played as team A
+type SeriesGame struct {
+	MatchId int64       `json:"match_id"`
+	Map     string      `json:"map"`
+	Player1 string      `json:"player1"`
+	Result  MatchResult `json:"result"`
+}
+
+// A best-of series between two players. The winner and loser move on to the slots given by NextWinner
+// and NextLoser, which are -1 when the player leaves the bracket.
+type BracketSeries struct {
+	Id             int            `json:"id"`
+	Side           string         `json:"side"`
+	Round          int            `json:"round"`
+	Position       int            `json:"position"`
+	Players        [2]BracketSlot `json:"players"`
+	Wins           [2]int         `json:"wins"`
+	Winner         string         `json:"winner"`
+	Done           bool           `json:"done"`
+	Games          []SeriesGame   `json:"games"`
+	NextWinner     int            `json:"next_winner"`
+	NextWinnerSlot int            `json:"next_winner_slot"`
+	NextLoser      int            `json:"next_loser"`
+	NextLoserSlot  int            `json:"next_loser_slot"`
+}
+
+// Lays out a bracket for players in seed order, the top seeds are given byes when the
+// number of players is not a power of two
+func NewBracket(name string, category TournamentCategory, format string, bestOf int, maps []string, seeds []Submission) (Bracket, error) {
+	if format != BracketSingleElimination && format != BracketDoubleElimination {
+		return Bracket{}, fmt.Errorf("Unknown bracket format %v", format)
+	} else if bestOf < 1 || bestOf%2 == 0 {
+		return Bracket{}, errors.New("Series must be best of an odd number of matches")
+	} else if len(maps) == 0 {
+		return Bracket{}, errors.New("A bracket needs at least one map")
+	} else if bestOf > seriesRotation(len(maps)) {
+		return Bracket{}, fmt.Errorf("A series of %v matches would replay a match on %v maps", bestOf, len(maps))
+	} else if len(seeds) < 2 {
+		return Bracket{}, errors.New("A bracket needs at least two players")
+	}
+	b := Bracket{0, name, category, format, bestOf, maps, seeds, "", time.Time{}, []BracketSeries{}}
+	size, rounds := 2, 1
+	for size < len(seeds) {
+		size *= 2
+		rounds++
+	}
+	winners := make([][]int, rounds)
+	for r := range winners {
+		for p := 0; p < size>>uint(r+1); p++ {
+			winners[r] = append(winners[r], b.addSeries(BracketWinners, r, p))
+		}
+	}
+	for r := 0; r+1 < rounds; r++ {
+		for p, id := range winners[r] {
+			b.Series[id].NextWinner, b.Series[id].NextWinnerSlot = winners[r+1][p/2], p%2
+		}
+	}
+	for i, seed := range seedOrder(size) {
+		slot := &b.Series[winners[0][i/2]].Players[i%2]
+		slot.Seed, slot.Ready = seed, true
+		if seed <= len(seeds) {
+			slot.Name, slot.Commit = seeds[seed-1].Name, seeds[seed-1].CommitHash
+		}
+	}
+	if format == BracketDoubleElimination {
+		// Each even losers round plays off the survivors, each odd round adds the losers of the next winners round
+		losers := make([][]int, 2*(rounds-1))
+		for r := range losers {
+			for p := 0; p < size/4>>uint(r/2); p++ {
+				id := b.addSeries(BracketLosers, r, p)
+				losers[r] = append(losers[r], id)
+				if r == 0 {
+					b.Series[winners[0][2*p]].NextLoser, b.Series[winners[0][2*p]].NextLoserSlot = id, 0
+					b.Series[winners[0][2*p+1]].NextLoser, b.Series[winners[0][2*p+1]].NextLoserSlot = id, 1
+				} else if r%2 == 1 {
+					b.Series[losers[r-1][p]].NextWinner, b.Series[losers[r-1][p]].NextWinnerSlot = id, 0
+					b.Series[winners[(r+1)/2][p]].NextLoser, b.Series[winners[(r+1)/2][p]].NextLoserSlot = id, 1
+				} else {
+					b.Series[losers[r-1][2*p]].NextWinner, b.Series[losers[r-1][2*p]].NextWinnerSlot = id, 0
+					b.Series[losers[r-1][2*p+1]].NextWinner, b.Series[losers[r-1][2*p+1]].NextWinnerSlot = id, 1
+				}
+			}
+		}
+		final := b.addSeries(BracketFinal, 0, 0)
+		b.addSeries(BracketReset, 0, 0)
+		last := winners[rounds-1][0]
+		b.Series[last].NextWinner, b.Series[last].NextWinnerSlot = final, 0
+		if len(losers) == 0 {
+			b.Series[last].NextLoser, b.Series[last].NextLoserSlot = final, 1
+		} else {
+			last = losers[len(losers)-1][0]
+			b.Series[last].NextWinner, b.Series[last].NextWinnerSlot = final, 1
+		}
+	}
+	return b, nil
+}
+
+// The number of games before a series plays the same map with the same sides again.
+// Game g is played on map g%maps with the players swapping sides each game.
+func seriesRotation(maps int) int {
+	if maps%2 == 0 {
+		return maps
+	}
+	return 2 * maps
+}
+
+func (b *Bracket) addSeries(side string, round, position int) int {
+	id := len(b.Series)
+	b.Series = append(b.Series, BracketSeries{Id: id, Side: side, Round: round, Position: position, Games: []SeriesGame{}, NextWinner: -1, NextLoser: -1})
+	return id
+}
+
+// The seeds of the first round slots in order, so the top seeds meet as late as possible
+func seedOrder(size int) []int {
+	order := []int{1}
+	for n := 2; n <= size; n *= 2 {
+		next := make([]int, 0, n)
+		for _, seed := range order {
+			next = append(next, seed, n+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// Counts the wins of each player, returning the number of games which have not been played
+func (s *BracketSeries) tally() int {
+	var pending int
+	s.Wins, pending = countWins(s.Games, s.Players[0].Name)
+	return pending
+}
+
+// The games won by player and their opponent, and the number of games which have not been played.
+// Ties are won by the team which won on tiebreakers. A game which ended in an error or timeout
+// has not been played until it is rerun.
+func countWins(games []SeriesGame, player string) ([2]int, int) {
+	wins, pending := [2]int{}, 0
+	for _, game := range games {
+		teamA := 0
+		if game.Player1 != player {
+			teamA = 1
+		}
+		switch game.Result {
+		case MatchResultWinA, MatchResultTieA:
+			wins[teamA]++
+		case MatchResultWinB, MatchResultTieB:
+			wins[1-teamA]++
+		default:
+			pending++
+		}
+	}
+	return wins, pending
+}
+
+func (s *BracketSeries) hasMatch(id int64) bool {
+	for _, game := range s.Games {
+		if game.MatchId == id {
+			return true
+		}
+	}
+	return false
+}
+
+// The latest accepted commit of each player, ordered by rating, then leaderboard score, then name.
+// Players who are not on the leaderboard yet are seeded last.
+func (t *Tournament) Seeds(category TournamentCategory) ([]Submission, error) {
+	if seeds, err := t.LatestCommits(category); err != nil {
+		return nil, err
+	} else if ranks, _, err := t.GetLeaderboard(category); err != nil {
+		return nil, err
+	} else if ratings, err := t.GetRatings(category); err != nil {
+		return nil, err
+	} else {
+		sort.SliceStable(seeds, func(i, j int) bool {
+			a, b := seeds[i].Name, seeds[j].Name
+			_, rankedA := ranks[a]
+			_, rankedB := ranks[b]
+			if rankedA != rankedB {
+				return rankedA
+			} else if ratings[a].Rating != ratings[b].Rating {
+				return ratings[a].Rating > ratings[b].Rating
+			} else if ranks[a].Score != ranks[b].Score {
+				return ranks[a].Score > ranks[b].Score
+			}
+			return a < b
+		})
+		return seeds, nil
+	}
+}
+
+// The maps an event is played on, every map of the category when none are chosen
+func (t *Tournament) eventMaps(category TournamentCategory, maps []string) ([]string, error) {
+	if len(maps) == 0 {
+		return t.ListMaps(category)
+	}
+	for _, mapName := range maps {
+		if exists, err := t.MapExists(mapName, category); err != nil {
+			return nil, err
+		} else if !exists {
+			return nil, fmt.Errorf("Unknown map %v", mapName)
+		}
+	}
+	return maps, nil
+}
+
+// Creates a bracket for the top size players of a category, or every player when size is 0,
+// and queues its first matches. Series are played on every map of the category when maps is empty.
+func (t *Tournament) CreateBracket(name string, category TournamentCategory, format string, bestOf int, maps []string, size int, created time.Time) (int64, error) {
+	if t.Queue == nil {
+		return 0, errors.New("Match queue is not running")
+	}
+	maps, err := t.eventMaps(category, maps)
+	if err != nil {
+		return 0, err
+	}
+	seeds, err := t.Seeds(category)
+	if err != nil {
+		return 0, err
+	} else if size > 0 && size < len(seeds) {
+		seeds = seeds[:size]
+	}
+	bracket, err := NewBracket(name, category, format, bestOf, maps, seeds)
+	if err != nil {
+		return 0, err
+	}
+	bracket.Created = created
+	var id int64
+	if err := t.Database.TransactionBlock(func(tx Statements) error {
+		id, err = tx.CreateBracket(bracket)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return id, t.AdvanceBracket(id)
+}
+
+// A bracket with the wins of each series
+func (t *Tournament) GetBracket(id int64) (Bracket, error) {
+	if bracket, err := t.Database.GetBracket(id); err != nil {
+		return Bracket{}, err
+	} else {
+		for i := range bracket.Series {
+			bracket.Series[i].tally()
+		}
+		return bracket, nil
+	}
+}
+
+// The brackets of a category without their series
+func (t *Tournament) ListBrackets(category TournamentCategory) ([]Bracket, error) {
+	brackets, err := t.Database.ListBrackets(category)
+	return brackets, err
+}
+
+// Moves a bracket on as far as its finished matches allow. Byes are advanced, the players of decided
+// series move on, and undecided series are given the matches they still need.
+func (t *Tournament) AdvanceBracket(id int64) error {
+	bracketMutex.Lock()
+	defer bracketMutex.Unlock()
+	return t.advanceBracket(id)
+}
+
+func (t *Tournament) advanceBracket(id int64) error {
+	bracket, err := t.GetBracket(id)
+	if err != nil {
+		return err
+	}
+	for progress := true; progress && bracket.Champion == ""; {
+		progress = false
+		for i := range bracket.Series {
+			series := &bracket.Series[i]
+			if series.Done || !series.Players[0].Ready || !series.Players[1].Ready {
+				continue
+			} else if winner, ok, err := t.playSeries(&bracket, series); err != nil {
+				return err
+			} else if ok {
+				if err := t.finishSeries(&bracket, series, winner); err != nil {
+					return err
+				}
+				progress = true
+			}
+		}
+	}
+	return nil
+}
+
+// Advances every bracket which has not finished, for brackets whose matches finished while the queue was stopped
+func (t *Tournament) AdvanceBrackets() error {
+	bracketMutex.Lock()
+	defer bracketMutex.Unlock()
+	if ids, err := t.Database.ListOpenBrackets(); err != nil {
+		return err
+	} else {
+		for _, id := range ids {
+			if err := t.advanceBracket(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Advances the brackets a finished match belongs to. The lookup is made under the lock, so a match
+// which finishes while its bracket is still recording it is not missed.
+func (t *Tournament) advanceMatchBrackets(matchId int64) {
+	bracketMutex.Lock()
+	defer bracketMutex.Unlock()
+	if ids, err := t.Database.ListMatchBrackets(matchId); err != nil {
+		log.Println(err)
+	} else {
+		for _, id := range ids {
+			if err := t.advanceBracket(id); err != nil {
+				log.Printf("Failed to advance bracket %v: %v\n", id, err)
+			}
+		}
+	}
+}
+
+// The slot which won a series, queueing the games an undecided series needs. Players swap sides each game.
+// A series waits while a game which failed could still decide it, until that match is rerun.
+func (t *Tournament) playSeries(bracket *Bracket, series *BracketSeries) (int, bool, error) {
+	if series.Players[0].Name == "" {
+		return 1, true, nil
+	} else if series.Players[1].Name == "" {
+		return 0, true, nil
+	}
+	needed := bracket.BestOf/2 + 1
+	for {
+		pending := series.tally()
+		if series.Wins[0] >= needed {
+			return 0, true, nil
+		} else if series.Wins[1] >= needed {
+			return 1, true, nil
+		} else if series.Wins[0]+pending >= needed || series.Wins[1]+pending >= needed {
+			return 0, false, nil
+		}
+		game := len(series.Games)
+		player1, player2 := series.Players[game%2], series.Players[1-game%2]
+		mapName := bracket.Maps[game%len(bracket.Maps)]
+		if id, err := t.enqueueSeriesMatch(bracket, series, mapName, Submission{player1.Name, player1.Commit}, Submission{player2.Name, player2.Commit}); err != nil {
+			return 0, false, err
+		} else if result, err := t.GetMatchResult(id); err != nil {
+			return 0, false, err
+		} else if series.hasMatch(id) && result != MatchResultWinA && result != MatchResultWinB && result != MatchResultTieA && result != MatchResultTieB {
+			return 0, false, nil
+		} else if err := t.Database.AddSeriesGame(bracket.Id, series.Id, game, id); err != nil {
+			return 0, false, err
+		} else {
+			series.Games = append(series.Games, SeriesGame{id, mapName, player1.Name, result})
+		}
+	}
+}
+
+// Creates a match for a game of a series and queues it if it has not been played. Each series has
+// its own matches, so players who meet again in a bracket replay their games.
+func (t *Tournament) enqueueSeriesMatch(bracket *Bracket, series *BracketSeries, mapName string, player1, player2 Submission) (int64, error) {
+	if t.Queue == nil {
+		return 0, errors.New("Match queue is not running")
+	} else if id, err := t.Database.CreateBracketMatch(bracket.Id, series.Id, bracket.Category, mapName, player1, player2, SystemClock().Now()); err != nil {
+		return 0, err
+	} else if result, err := t.GetMatchResult(id); err != nil {
+		return id, err
+	} else {
+		if result == MatchResultInProgress {
+			t.Queue.Push(id)
+		}
+		return id, nil
+	}
+}
+
+// Records the winner of a series and moves both players on
+func (t *Tournament) finishSeries(bracket *Bracket, series *BracketSeries, winner int) error {
+	series.Done = true
+	series.Winner = series.Players[winner].Name
+	if err := t.Database.UpdateBracketSeries(bracket.Id, *series); err != nil {
+		return err
+	} else if err := t.moveToSlot(bracket, series.Players[winner], series.NextWinner, series.NextWinnerSlot); err != nil {
+		return err
+	} else if err := t.moveToSlot(bracket, series.Players[1-winner], series.NextLoser, series.NextLoserSlot); err != nil {
+		return err
+	} else if series.Side != BracketFinal {
+		if series.NextWinner < 0 {
+			bracket.Champion = series.Winner
+			return t.Database.SetBracketChampion(bracket.Id, series.Winner)
+		}
+		return nil
+	}
+	for i := range bracket.Series {
+		if reset := &bracket.Series[i]; reset.Side == BracketReset {
+			if winner == 1 {
+				if err := t.moveToSlot(bracket, series.Players[0], i, 0); err != nil {
+					return err
+				}
+				return t.moveToSlot(bracket, series.Players[1], i, 1)
+			}
+			reset.Done = true
+			reset.Winner = series.Winner
+			if err := t.Database.UpdateBracketSeries(bracket.Id, *reset); err != nil {
+				return err
+			}
+		}
+	}
+	bracket.Champion = series.Winner
+	return t.Database.SetBracketChampion(bracket.Id, series.Winner)
+}
+
+func (t *Tournament) moveToSlot(bracket *Bracket, player BracketSlot, id, slot int) error {
+	if id < 0 {
+		return nil
+	}
+	series := &bracket.Series[id]
+	series.Players[slot] = player
+	series.Players[slot].Ready = true
+	return t.Database.UpdateBracketSeries(bracket.Id, *series)
+}
@@ -0,0 +1,190 @@
+package tournament
+
+import (
+	"context"
+	"fmt"
+	"github.com/GlenKelley/battleref/arena"
+	"github.com/GlenKelley/battleref/testing"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Team A wins every match except the upsets, which are keyed by "commit1 commit2"
+type upsetArena struct {
+	arena.Arena
+	upsets map[string]bool
+}
+
+func (a upsetArena) RunMatch(ctx context.Context, p arena.MatchProperties, clock func() time.Time) (time.Time, arena.MatchResult, error) {
+	finished, result, err := a.Arena.RunMatch(ctx, p, clock)
+	if a.upsets[p.Commit1+" "+p.Commit2] {
+		result.Winner = arena.WinnerB
+	}
+	return finished, result, err
+}
+
+// Team A wins every match except the upsets, which are keyed by "commit1 commit2" and list whether each play is an upset
+type replayUpsetArena struct {
+	arena.Arena
+	upsets map[string][]bool
+}
+
+func (a replayUpsetArena) RunMatch(ctx context.Context, p arena.MatchProperties, clock func() time.Time) (time.Time, arena.MatchResult, error) {
+	finished, result, err := a.Arena.RunMatch(ctx, p, clock)
+	if plays := a.upsets[p.Commit1+" "+p.Commit2]; len(plays) > 0 {
+		a.upsets[p.Commit1+" "+p.Commit2] = plays[1:]
+		if plays[0] {
+			result.Winner = arena.WinnerB
+		}
+	}
+	return finished, result, err
+}
+
+func createBracket(t *testutil.T, tm *Tournament, format string, bestOf int, maps []string, players int) Bracket {
+	t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+	for _, mapName := range maps {
+		t.CheckError(tm.CreateMap(mapName, "MapSource", CategoryTest))
+	}
+	for i := 1; i <= players; i++ {
+		t.CheckError(tm.SubmitCommit(fmt.Sprintf("Name%v", i), CategoryTest, fmt.Sprintf("c%v", i), time.Now()))
+	}
+	if id, err := tm.CreateBracket("Finals", CategoryTest, format, bestOf, maps, 0, time.Now()); err != nil {
+		t.ErrorNow(err)
+	} else {
+		tm.Queue.Wait()
+		if bracket, err := tm.GetBracket(id); err != nil {
+			t.ErrorNow(err)
+		} else {
+			return bracket
+		}
+	}
+	return Bracket{}
+}
+
+func TestSeedOrder(test *testing.T) {
+	t := (*testutil.T)(test)
+	if order := seedOrder(8); !reflect.DeepEqual(order, []int{1, 8, 4, 5, 2, 7, 3, 6}) {
+		t.ErrorNow("Unexpected seed order", order)
+	}
+}
+
+func TestNewBracketLayout(test *testing.T) {
+	t := (*testutil.T)(test)
+	seeds := []Submission{{"p1", "c1"}, {"p2", "c2"}, {"p3", "c3"}, {"p4", "c4"}}
+	if _, err := NewBracket("Finals", CategoryTest, BracketDoubleElimination, 2, []string{"Map1"}, seeds); err == nil {
+		t.ErrorNow("Expected an error for an even series length")
+	} else if _, err := NewBracket("Finals", CategoryTest, BracketSingleElimination, 1, []string{"Map1"}, seeds[:1]); err == nil {
+		t.ErrorNow("Expected an error for a single player")
+	} else if _, err := NewBracket("Finals", CategoryTest, BracketSingleElimination, 3, []string{"Map1"}, seeds); err == nil {
+		t.ErrorNow("Expected an error for a series which would replay a match")
+	} else if _, err := NewBracket("Finals", CategoryTest, BracketSingleElimination, 3, []string{"Map1", "Map2"}, seeds); err == nil {
+		t.ErrorNow("Expected an error for a series which would replay a match with the same sides")
+	} else if _, err := NewBracket("Finals", CategoryTest, BracketSingleElimination, 5, []string{"Map1", "Map2", "Map3"}, seeds); err != nil {
+		t.ErrorNow(err)
+	} else if bracket, err := NewBracket("Finals", CategoryTest, BracketDoubleElimination, 1, []string{"Map1"}, seeds); err != nil {
+		t.ErrorNow(err)
+	} else {
+		sides := []string{}
+		for _, series := range bracket.Series {
+			sides = append(sides, series.Side)
+		}
+		if expected := []string{BracketWinners, BracketWinners, BracketWinners, BracketLosers, BracketLosers, BracketFinal, BracketReset}; !reflect.DeepEqual(sides, expected) {
+			t.ErrorNow("Unexpected series", sides)
+		} else if first := bracket.Series[0]; first.Players[0].Name != "p1" || first.Players[1].Name != "p4" {
+			t.ErrorNow("Expected the first seed to play the last", first.Players)
+		} else if first.NextWinner != 2 || first.NextLoser != 3 || first.NextLoserSlot != 0 {
+			t.ErrorNow("Unexpected links", first)
+		} else if final := bracket.Series[2]; final.NextWinner != 5 || final.NextLoser != 4 || final.NextLoserSlot != 1 {
+			t.ErrorNow("Expected the winners final to feed the final and the losers final", final)
+		} else if losersFinal := bracket.Series[4]; losersFinal.NextWinner != 5 || losersFinal.NextWinnerSlot != 1 {
+			t.ErrorNow("Expected the losers final to feed the final", losersFinal)
+		}
+	}
+}
+
+func TestSingleEliminationBracket(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		defer func() {
+			if tm.Queue != nil {
+				tm.Queue.Stop()
+			}
+		}()
+		bracket := createBracket(t, tm, BracketSingleElimination, 3, []string{"Map1", "Map2", "Map3"}, 5)
+		if len(bracket.Series) != 7 {
+			t.ErrorNow("Expected 7 series for 5 players", len(bracket.Series))
+		} else if bracket.Champion != "Name1" {
+			t.ErrorNow("Expected the top seed to win not", bracket.Champion)
+		}
+		// The only first round series without a bye is 4 against 5, who win as team A
+		played := bracket.Series[1]
+		if played.Players[0].Name != "Name4" || played.Players[1].Name != "Name5" {
+			t.ErrorNow("Unexpected players", played.Players)
+		} else if len(played.Games) != 3 || played.Wins != [2]int{2, 1} || played.Winner != "Name4" {
+			t.ErrorNow("Unexpected series", played)
+		} else if played.Games[2].Map != "Map3" || played.Games[2].MatchId == played.Games[0].MatchId {
+			t.ErrorNow("Expected the third game to be played on the third map", played.Games)
+		} else if bye := bracket.Series[0]; !bye.Done || len(bye.Games) != 0 || bye.Winner != "Name1" {
+			t.ErrorNow("Expected the top seed to have a bye", bye)
+		}
+	})
+}
+
+func TestDoubleEliminationBracketReset(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		defer func() {
+			if tm.Queue != nil {
+				tm.Queue.Stop()
+			}
+		}()
+		tm.Arena = upsetArena{tm.Arena, map[string]bool{"c4 c3": true, "c1 c3": true}}
+		bracket := createBracket(t, tm, BracketDoubleElimination, 1, []string{"Map1"}, 4)
+		winners := []string{}
+		for _, series := range bracket.Series {
+			winners = append(winners, series.Winner)
+		}
+		if expected := []string{"Name1", "Name2", "Name1", "Name3", "Name3", "Name3", "Name3"}; !reflect.DeepEqual(winners, expected) {
+			t.ErrorNow("Unexpected winners", winners)
+		} else if bracket.Champion != "Name3" {
+			t.ErrorNow("Expected the losers bracket winner to win the reset final, not", bracket.Champion)
+		} else if final, reset := bracket.Series[5], bracket.Series[6]; len(reset.Games) != 1 || reset.Games[0].MatchId == final.Games[0].MatchId {
+			t.ErrorNow("Expected the reset final to play its own match", final.Games, reset.Games)
+		}
+		if brackets, err := tm.ListBrackets(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(brackets) != 1 || brackets[0].Champion != "Name3" {
+			t.ErrorNow("Unexpected brackets", brackets)
+		}
+	})
+}
+
+func TestDoubleEliminationResetReplaysFinal(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		defer func() {
+			if tm.Queue != nil {
+				tm.Queue.Stop()
+			}
+		}()
+		// Name1 and Name2 meet in the winners final, the final and the reset final, Name2 only wins the final
+		tm.Arena = replayUpsetArena{tm.Arena, map[string][]bool{"c1 c2": {false, true, false}}}
+		bracket := createBracket(t, tm, BracketDoubleElimination, 1, []string{"Map1"}, 2)
+		winners := []string{}
+		for _, series := range bracket.Series {
+			winners = append(winners, series.Winner)
+		}
+		if expected := []string{"Name1", "Name2", "Name1"}; !reflect.DeepEqual(winners, expected) {
+			t.ErrorNow("Unexpected winners", winners)
+		} else if bracket.Champion != "Name1" {
+			t.ErrorNow("Expected the winners bracket winner to win the reset final, not", bracket.Champion)
+		}
+		ids := map[int64]bool{}
+		for _, series := range bracket.Series {
+			for _, game := range series.Games {
+				ids[game.MatchId] = true
+			}
+		}
+		if len(ids) != 3 {
+			t.ErrorNow("Expected each series to play its own match", bracket.Series)
+		}
+	})
+}
@@ -38,6 +38,9 @@ func OpenDatabase(filename string) (Database, error) {
 	if db, err := sql.Open("sqlite3", filename); err != nil {
 		return nil, err
 	} else {
+		// Match workers share the database, sqlite only supports a single writer
+		// and each in-memory connection would otherwise be a separate database
+		db.SetMaxOpenConns(1)
 		return &SQLiteDatabase{Commands{db}, db}, nil
 	}
 }
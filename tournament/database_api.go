@@ -1,6 +1,10 @@
 package tournament
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -12,22 +16,84 @@ type Statements interface {
 	CreateUser(name, publicKey string) error
 	DeleteUser(name string) error
 	UserExists(name string) (bool, error)
+	SetUserToken(name, tokenHash string) error
+	GetTokenUser(tokenHash string) (string, error)
 	ListUsers() ([]string, error)
 	CreateMap(name, source string, category TournamentCategory) error
 	GetMapSource(name string, category TournamentCategory) (string, error)
 	ListMaps(category TournamentCategory) ([]string, error)
+	MapVersions(category TournamentCategory) (map[string]int, error)
+	UpdateMap(name, source string, category TournamentCategory) (int, error)
+	DeleteMap(name string, category TournamentCategory) error
+	GetMap(name string, category TournamentCategory) (MapVersion, error)
+	GetMapVersion(name string, category TournamentCategory, version int) (MapVersion, error)
+	ListMapVersions(name string, category TournamentCategory) ([]MapVersion, error)
+	SetMapPool(pool MapPool) error
+	GetMapPool(name string, category TournamentCategory) (MapPool, error)
+	ListMapPools(category TournamentCategory) ([]MapPool, error)
 	ListMatches(category TournamentCategory) ([]Match, error)
 	LatestCommits(category TournamentCategory) ([]Submission, error)
 	MapExists(name string, category TournamentCategory) (bool, error)
 	CreateCommit(userName string, category TournamentCategory, commit string, time time.Time) error
 	ListCommits(name string, category TournamentCategory) ([]string, error)
+	UpdateCommitStatus(name string, category TournamentCategory, commit string, status SubmissionStatus) error
+	GetCommitStatus(name string, category TournamentCategory, commit string) (SubmissionStatus, error)
 	SchemaVersion() (string, error)
 	CreateMatch(category TournamentCategory, mapName string, player1, player2 Submission, created time.Time) (int64, error)
 	UpdateMatch(category TournamentCategory, mapName string, player1, player2 Submission, finished time.Time, result MatchResult, replay []byte) error
 	GetMatchResult(id int64) (MatchResult, error)
+	GetMatch(id int64) (Match, error)
+	SetMatchMapVersion(id int64, version int) error
+	ListMatchIds(result MatchResult, scrimmage bool) ([]int64, error)
+	UpdateMatchResult(id int64, finished time.Time, result MatchResult, replay []byte) error
+	MatchScrimmage(id int64) (int64, error)
+	ListSelfPlayMatches(name string, category TournamentCategory) ([]Match, error)
 	GetMatchReplay(id int64) ([]byte, TournamentCategory, error)
-	UpdateLeaderboard(category TournamentCategory, stats map[string]LeaderboardStats, commits map[string]string) error
+	UpdateMatchLog(id int64, stream, log string) error
+	GetMatchLogs(id int64) (map[string]string, error)
+	ResetMatch(id int64) error
+	CreateMatchAttempt(id int64, started, finished time.Time, result MatchResult, message string) error
+	ListMatchAttempts(id int64) ([]MatchAttempt, error)
+	MatchFailures(id int64) (int, error)
+	UpdateLeaderboard(category TournamentCategory, stats map[string]LeaderboardStats, commits map[string]string, ratings map[string]Rating) error
 	GetLeaderboard(category TournamentCategory) (map[string]LeaderboardStats, []Match, error)
+	UpdateRatingHistory(category TournamentCategory, history map[string][]RatingPoint) error
+	CreateLeaderboardSnapshot(category TournamentCategory, created time.Time, points []LeaderboardPoint, ranking Ranking) error
+	GetLeaderboardRanking(category TournamentCategory) (Ranking, error)
+	GetLeaderboardHistory(category TournamentCategory, name string) ([]LeaderboardPoint, error)
+	GetRatings(category TournamentCategory) (map[string]PlayerRating, error)
+	CreateBracket(bracket Bracket) (int64, error)
+	GetBracket(id int64) (Bracket, error)
+	ListBrackets(category TournamentCategory) ([]Bracket, error)
+	ListOpenBrackets() ([]int64, error)
+	ListMatchBrackets(matchId int64) ([]int64, error)
+	UpdateBracketSeries(bracketId int64, series BracketSeries) error
+	AddSeriesGame(bracketId int64, seriesId, game int, matchId int64) error
+	CreateBracketMatch(bracketId int64, seriesId int, category TournamentCategory, mapName string, player1, player2 Submission, created time.Time) (int64, error)
+	SetBracketChampion(id int64, champion string) error
+	CreateSwiss(swiss SwissTournament) (int64, error)
+	GetSwiss(id int64) (SwissTournament, error)
+	ListSwiss(category TournamentCategory) ([]SwissTournament, error)
+	ListOpenSwiss() ([]int64, error)
+	ListMatchSwiss(matchId int64) ([]int64, error)
+	CreateSwissPairing(swissId int64, pairing SwissPairing) error
+	SetSwissRound(id int64, round int) error
+	FinishSwiss(id int64) error
+	CreateSeason(season Season) (int64, error)
+	GetSeason(id int64) (Season, error)
+	ListSeasons() ([]Season, error)
+	CreatePhase(phase Phase) (int64, error)
+	GetPhase(id int64) (Phase, error)
+	ListCategoryPhases(category TournamentCategory) ([]Phase, error)
+	StartPhase(id int64, players []Submission, eventId int64) error
+	SetPhaseMaps(id int64, maps []string) error
+	FinishPhase(id int64, standings []PhaseStanding, matchIds []int64) error
+	IsPhaseMatch(matchId int64) (bool, error)
+	MatchesVersion(category TournamentCategory) (string, error)
+	CreateScrimmage(scrimmage Scrimmage) (int64, error)
+	CreateScrimmageMatch(scrimmageId int64, category TournamentCategory, mapName string, player1, player2 Submission, created time.Time) (int64, error)
+	GetScrimmage(id int64) (Scrimmage, error)
+	ListScrimmages(name string, category TournamentCategory) ([]Scrimmage, error)
 }
 
 // An implementation of statements which uses an abstracted sql connection
@@ -70,6 +136,7 @@ func (c *Commands) ListKeys() (map[int64]string, error) {
 	if rows, err := c.tx.Query("select id, key from pkey"); err != nil {
 		return nil, err
 	} else {
+		defer rows.Close()
 		keys := make(map[int64]string)
 		for rows.Next() {
 			var id int64
@@ -80,6 +147,9 @@ func (c *Commands) ListKeys() (map[int64]string, error) {
 				keys[id] = public_key
 			}
 		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 		return keys, nil
 	}
 }
@@ -88,6 +158,7 @@ func (c *Commands) PlayerKeys() (map[string]int64, error) {
 	if rows, err := c.tx.Query("select name, public_key from user"); err != nil {
 		return nil, err
 	} else {
+		defer rows.Close()
 		playerKeys := make(map[string]int64)
 		for rows.Next() {
 			var name string
@@ -98,6 +169,9 @@ func (c *Commands) PlayerKeys() (map[string]int64, error) {
 				playerKeys[name] = id
 			}
 		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 		return playerKeys, nil
 	}
 }
@@ -122,10 +196,22 @@ func (c *Commands) UserExists(name string) (bool, error) {
 	return exists, err
 }
 
+func (c *Commands) SetUserToken(name, tokenHash string) error {
+	_, err := c.tx.Exec("update user set token = ? where name = ?", tokenHash, name)
+	return err
+}
+
+func (c *Commands) GetTokenUser(tokenHash string) (string, error) {
+	var name string
+	err := c.tx.QueryRow("select name from user where token = ? and token != ''", tokenHash).Scan(&name)
+	return name, err
+}
+
 func queryStrings(db dbcon, query string, args ...interface{}) ([]string, error) {
 	if rows, err := db.Query(query, args...); err != nil {
 		return nil, err
 	} else {
+		defer rows.Close()
 		var values []string
 		for rows.Next() {
 			var value string
@@ -135,6 +221,9 @@ func queryStrings(db dbcon, query string, args ...interface{}) ([]string, error)
 				values = append(values, value)
 			}
 		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 		if values == nil {
 			return []string{}, nil
 		} else {
@@ -148,43 +237,217 @@ func (c *Commands) ListUsers() ([]string, error) {
 	return users, err
 }
 
+// Creates the first version of a map, or a new version of a map which was deleted
 func (c *Commands) CreateMap(name, source string, category TournamentCategory) error {
-	_, err := c.tx.Exec("insert into map(name, category, source) values (?,?,?)", name, string(category), source)
-	return err
+	if exists, err := c.MapExists(name, category); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("Map %v already exists", name)
+	} else {
+		_, err := c.insertMapVersion(name, source, category)
+		return err
+	}
+}
+
+// Adds a version of a map which has not been deleted, returning the new version
+func (c *Commands) UpdateMap(name, source string, category TournamentCategory) (int, error) {
+	if exists, err := c.MapExists(name, category); err != nil {
+		return 0, err
+	} else if !exists {
+		return 0, sql.ErrNoRows
+	} else {
+		return c.insertMapVersion(name, source, category)
+	}
+}
+
+// The latest version of a map which has not been deleted, or 0 for an unknown map
+func (c *Commands) latestMapVersion(name string, category TournamentCategory) (int, error) {
+	var version int
+	err := c.tx.QueryRow("select ifnull(max(version), 0) from map where name = ? and category = ? and deleted = 0", name, string(category)).Scan(&version)
+	return version, err
+}
+
+func (c *Commands) insertMapVersion(name, source string, category TournamentCategory) (int, error) {
+	var version int
+	if err := c.tx.QueryRow("select ifnull(max(version), 0) + 1 from map where name = ? and category = ?", name, string(category)).Scan(&version); err != nil {
+		return 0, err
+	} else if _, err := c.tx.Exec("insert into map(name, category, version, source) values (?,?,?,?)", name, string(category), version, source); err != nil {
+		return 0, err
+	} else {
+		return version, nil
+	}
+}
+
+// Hides every version of a map, the versions are kept for the matches played on them
+func (c *Commands) DeleteMap(name string, category TournamentCategory) error {
+	if result, err := c.tx.Exec("update map set deleted = 1 where name = ? and category = ? and deleted = 0", name, string(category)); err != nil {
+		return err
+	} else if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	} else {
+		return nil
+	}
 }
 
 func (c *Commands) MapExists(name string, category TournamentCategory) (bool, error) {
 	var exists bool
-	err := c.tx.QueryRow("select count(name) > 0 from map where name = ? and category = ?", name, string(category)).Scan(&exists)
+	err := c.tx.QueryRow("select count(name) > 0 from map where name = ? and category = ? and deleted = 0", name, string(category)).Scan(&exists)
 	return exists, err
 }
 
+// The source of the latest version of a map
 func (c *Commands) GetMapSource(name string, category TournamentCategory) (string, error) {
-	var source string
-	err := c.tx.QueryRow("select source from map where name = ? and category = ?", name, string(category)).Scan(&source)
-	return source, err
+	m, err := c.GetMap(name, category)
+	return m.Source, err
+}
+
+// The latest version of a map which has not been deleted
+func (c *Commands) GetMap(name string, category TournamentCategory) (MapVersion, error) {
+	if versions, err := c.queryMapVersions("where name = ? and category = ? and deleted = 0 order by version desc limit 1", name, string(category)); err != nil {
+		return MapVersion{}, err
+	} else if len(versions) == 0 {
+		return MapVersion{}, sql.ErrNoRows
+	} else {
+		return versions[0], nil
+	}
+}
+
+// A version of a map, including versions of deleted maps
+func (c *Commands) GetMapVersion(name string, category TournamentCategory, version int) (MapVersion, error) {
+	if versions, err := c.queryMapVersions("where name = ? and category = ? and version = ?", name, string(category), version); err != nil {
+		return MapVersion{}, err
+	} else if len(versions) == 0 {
+		return MapVersion{}, sql.ErrNoRows
+	} else {
+		return versions[0], nil
+	}
+}
+
+// Every version of a map, oldest first
+func (c *Commands) ListMapVersions(name string, category TournamentCategory) ([]MapVersion, error) {
+	versions, err := c.queryMapVersions("where name = ? and category = ? order by version", name, string(category))
+	return versions, err
+}
+
+func (c *Commands) queryMapVersions(where string, args ...interface{}) ([]MapVersion, error) {
+	if rows, err := c.tx.Query("select name, category, version, source, deleted, created from map "+where, args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		versions := []MapVersion{}
+		for rows.Next() {
+			var version MapVersion
+			var category string
+			if err := rows.Scan(&version.Name, &category, &version.Version, &version.Source, &version.Deleted, &version.Created); err != nil {
+				return nil, err
+			}
+			version.Category = TournamentCategory(category)
+			versions = append(versions, version)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return versions, nil
+	}
 }
 
 func (c *Commands) ListMaps(category TournamentCategory) ([]string, error) {
-	maps, err := queryStrings(c.tx, "select name from map where category = ?", string(category))
+	maps, err := queryStrings(c.tx, "select distinct name from map where category = ? and deleted = 0 order by name", string(category))
 	return maps, err
 }
 
+// The latest version of every map of a category, including maps which have been deleted
+func (c *Commands) MapVersions(category TournamentCategory) (map[string]int, error) {
+	if rows, err := c.tx.Query("select name, max(version) from map where category = ? group by name", string(category)); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		versions := map[string]int{}
+		for rows.Next() {
+			var name string
+			var version int
+			if err := rows.Scan(&name, &version); err != nil {
+				return nil, err
+			}
+			versions[name] = version
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return versions, nil
+	}
+}
+
+// Creates or replaces a named list of maps
+func (c *Commands) SetMapPool(pool MapPool) error {
+	if maps, err := json.Marshal(pool.Maps); err != nil {
+		return err
+	} else {
+		_, err := c.tx.Exec("insert or replace into map_pool (name, category, maps, created) values (?,?,?,?)", pool.Name, string(pool.Category), string(maps), pool.Created)
+		return err
+	}
+}
+
+func (c *Commands) GetMapPool(name string, category TournamentCategory) (MapPool, error) {
+	if pools, err := c.queryMapPools("where name = ? and category = ?", name, string(category)); err != nil {
+		return MapPool{}, err
+	} else if len(pools) == 0 {
+		return MapPool{}, sql.ErrNoRows
+	} else {
+		return pools[0], nil
+	}
+}
+
+func (c *Commands) ListMapPools(category TournamentCategory) ([]MapPool, error) {
+	pools, err := c.queryMapPools("where category = ? order by name", string(category))
+	return pools, err
+}
+
+func (c *Commands) queryMapPools(where string, args ...interface{}) ([]MapPool, error) {
+	if rows, err := c.tx.Query("select name, category, maps, created from map_pool "+where, args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		pools := []MapPool{}
+		for rows.Next() {
+			var pool MapPool
+			var category, maps string
+			if err := rows.Scan(&pool.Name, &category, &maps, &pool.Created); err != nil {
+				return nil, err
+			} else if err := json.Unmarshal([]byte(maps), &pool.Maps); err != nil {
+				return nil, err
+			}
+			pool.Category = TournamentCategory(category)
+			pools = append(pools, pool)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return pools, nil
+	}
+}
+
 func (c *Commands) ListMatches(category TournamentCategory) ([]Match, error) {
-	if rows, err := c.tx.Query("select id, player1, player2, commit1, commit2, map, category, result, updated from match where category = ?", string(category)); err != nil {
+	if rows, err := c.tx.Query("select id, player1, player2, commit1, commit2, map, category, result, updated, map_version from match where category = ? and scrimmage = 0 and bracket = 0", string(category)); err != nil {
 		return nil, err
 	} else {
+		defer rows.Close()
 		var values []Match
 		for rows.Next() {
 			var match Match
 			var result string
-			if err2 := rows.Scan(&match.Id, &match.Player1, &match.Player2, &match.Commit1, &match.Commit2, &match.Map, &match.Category, &result, &match.Time); err2 != nil {
+			if err2 := rows.Scan(&match.Id, &match.Player1, &match.Player2, &match.Commit1, &match.Commit2, &match.Map, &match.Category, &result, &match.Time, &match.MapVersion); err2 != nil {
 				return nil, err2
 			} else {
 				match.Result = MatchResult(result)
 				values = append(values, match)
 			}
 		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 		if values == nil {
 			return []Match{}, nil
 		} else {
@@ -194,9 +457,10 @@ func (c *Commands) ListMatches(category TournamentCategory) ([]Match, error) {
 }
 
 func (c *Commands) LatestCommits(category TournamentCategory) ([]Submission, error) {
-	if rows, err := c.tx.Query("select s1.name, s1.commithash from submission s1 left join submission s2 on s1.name = s2.name and s1.category = s2.category and s1.date_created < s2.date_created where s2.name is null and s1.category = ?", string(category)); err != nil {
+	if rows, err := c.tx.Query("select s1.name, s1.commithash from submission s1 left join submission s2 on s1.name = s2.name and s1.category = s2.category and s1.date_created < s2.date_created and s2.status = ? where s2.name is null and s1.category = ? and s1.status = ?", SubmissionAccepted, string(category), SubmissionAccepted); err != nil {
 		return nil, err
 	} else {
+		defer rows.Close()
 		var latestCommits []Submission
 		for rows.Next() {
 			var name, commit string
@@ -206,30 +470,47 @@ func (c *Commands) LatestCommits(category TournamentCategory) ([]Submission, err
 				latestCommits = append(latestCommits, Submission{name, commit})
 			}
 		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 		return latestCommits, nil
 	}
 }
 
 func (c *Commands) CreateCommit(playerName string, category TournamentCategory, commitHash string, time time.Time) error {
-	_, err := c.tx.Exec("insert into submission(commitHash, name, category, date_created) values (?,?,?,?)", commitHash, playerName, string(category), time)
+	_, err := c.tx.Exec("insert into submission(commitHash, name, category, date_created, status) values (?,?,?,?,?)", commitHash, playerName, string(category), time, SubmissionPending)
 	return err
 }
 
 func (c *Commands) ListCommits(name string, category TournamentCategory) ([]string, error) {
-	commits, err := queryStrings(c.tx, "select commitHash from submission where name = ? and category = ?", name, string(category))
+	commits, err := queryStrings(c.tx, "select commitHash from submission where name = ? and category = ? order by date_created, rowid", name, string(category))
 	return commits, err
 }
 
+func (c *Commands) UpdateCommitStatus(name string, category TournamentCategory, commit string, status SubmissionStatus) error {
+	_, err := c.tx.Exec("update submission set status = ?, output = ? where name = ? and category = ? and commithash = ?", status.Status, status.Output, name, string(category), commit)
+	return err
+}
+
+func (c *Commands) GetCommitStatus(name string, category TournamentCategory, commit string) (SubmissionStatus, error) {
+	var status SubmissionStatus
+	err := c.tx.QueryRow("select status, output from submission where name = ? and category = ? and commithash = ?", name, string(category), commit).Scan(&status.Status, &status.Output)
+	return status, err
+}
+
+// Creates a match on the latest version of a map, or returns the match which already exists on that version
 func (c *Commands) CreateMatch(category TournamentCategory, mapName string, player1, player2 Submission, created time.Time) (int64, error) {
 	var exists bool
 	var id int64
-	if err := c.tx.QueryRow("select count(*) > 0, ifnull(max(id),0) as id from match where player1 = ? and player2 = ? and commit1 = ? and commit2 = ? and map = ? and category = ?", player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, mapName, string(category)).Scan(&exists, &id); err != nil {
+	if version, err := c.latestMapVersion(mapName, category); err != nil {
+		return 0, err
+	} else if err := c.tx.QueryRow("select count(*) > 0, ifnull(max(id),0) as id from match where player1 = ? and player2 = ? and commit1 = ? and commit2 = ? and map = ? and map_version = ? and category = ? and scrimmage = 0 and bracket = 0", player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, mapName, version, string(category)).Scan(&exists, &id); err != nil {
 		return 0, err
 	} else if exists {
 		return id, nil
-	} else if _, err := c.tx.Exec("insert into match(category, map, player1, player2, commit1, commit2, created, updated, result) values (?, ?, ?, ?, ?, ?, ?, ?, ?)", string(category), mapName, player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, created, created, MatchResultInProgress); err != nil {
+	} else if _, err := c.tx.Exec("insert into match(category, map, map_version, player1, player2, commit1, commit2, created, updated, result) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", string(category), mapName, version, player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, created, created, MatchResultInProgress); err != nil {
 		return 0, nil
-	} else if err := c.tx.QueryRow("select id as id from match where player1 = ? and player2 = ? and commit1 = ? and commit2 = ? and map = ? and category = ?", player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, mapName, string(category)).Scan(&id); err != nil {
+	} else if err := c.tx.QueryRow("select id as id from match where player1 = ? and player2 = ? and commit1 = ? and commit2 = ? and map = ? and map_version = ? and category = ? and scrimmage = 0 and bracket = 0", player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, mapName, version, string(category)).Scan(&id); err != nil {
 		return 0, err
 	} else {
 		return id, nil
@@ -237,10 +518,63 @@ func (c *Commands) CreateMatch(category TournamentCategory, mapName string, play
 }
 
 func (c *Commands) UpdateMatch(category TournamentCategory, mapName string, player1, player2 Submission, finished time.Time, result MatchResult, replay []byte) error {
-	_, err := c.tx.Exec("update match set updated = ?, result = ?, replay = ? where category = ? and map = ? and player1 = ? and player2 = ? and commit1 = ? and commit2 = ?", finished, string(result), replay, string(category), mapName, player1.Name, player2.Name, player1.CommitHash, player2.CommitHash)
+	if version, err := c.latestMapVersion(mapName, category); err != nil {
+		return err
+	} else {
+		_, err := c.tx.Exec("update match set updated = ?, result = ?, replay = ? where category = ? and map = ? and map_version = ? and player1 = ? and player2 = ? and commit1 = ? and commit2 = ? and scrimmage = 0 and bracket = 0", finished, string(result), replay, string(category), mapName, version, player1.Name, player2.Name, player1.CommitHash, player2.CommitHash)
+		return err
+	}
+}
+
+func (c *Commands) UpdateMatchResult(id int64, finished time.Time, result MatchResult, replay []byte) error {
+	_, err := c.tx.Exec("update match set updated = ?, result = ?, replay = ? where id = ?", finished, string(result), replay, id)
 	return err
 }
 
+// The scrimmage a match was played for, 0 for a ranked match
+func (c *Commands) MatchScrimmage(id int64) (int64, error) {
+	var scrimmage int64
+	err := c.tx.QueryRow("select scrimmage from match where id = ?", id).Scan(&scrimmage)
+	return scrimmage, err
+}
+
+// The matches a player played against another of their own commits, which are never ranked
+func (c *Commands) ListSelfPlayMatches(name string, category TournamentCategory) ([]Match, error) {
+	if rows, err := c.tx.Query("select id, player1, player2, commit1, commit2, map, category, result, updated, map_version from match where category = ? and player1 = ? and player2 = ? and commit1 != commit2", string(category), name, name); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		values := []Match{}
+		for rows.Next() {
+			var match Match
+			var result string
+			if err := rows.Scan(&match.Id, &match.Player1, &match.Player2, &match.Commit1, &match.Commit2, &match.Map, &match.Category, &result, &match.Time, &match.MapVersion); err != nil {
+				return nil, err
+			} else {
+				match.Result = MatchResult(result)
+				values = append(values, match)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+}
+
+// Changes whenever a ranked match of a category is created, finished or reset, or a map is created, updated or deleted
+func (c *Commands) MatchesVersion(category TournamentCategory) (string, error) {
+	var count, finished int64
+	var updated string
+	var versions, deleted int64
+	if err := c.tx.QueryRow("select count(*), ifnull(sum(result != ?), 0), ifnull(max(updated), '') from match where category = ? and scrimmage = 0 and bracket = 0", MatchResultInProgress, string(category)).Scan(&count, &finished, &updated); err != nil {
+		return "", err
+	} else if err := c.tx.QueryRow("select count(*), ifnull(sum(deleted), 0) from map where category = ?", string(category)).Scan(&versions, &deleted); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v:%v:%v:%v:%v", count, finished, updated, versions, deleted), nil
+}
+
 func (c *Commands) GetMatchResult(id int64) (MatchResult, error) {
 	var result string
 	err := c.tx.QueryRow("select result from match where id = ?", id).Scan(&result)
@@ -251,6 +585,42 @@ func (c *Commands) GetMatchResult(id int64) (MatchResult, error) {
 	}
 }
 
+func (c *Commands) GetMatch(id int64) (Match, error) {
+	var match Match
+	var result string
+	err := c.tx.QueryRow("select id, player1, player2, commit1, commit2, map, category, result, updated, map_version from match where id = ?", id).Scan(&match.Id, &match.Player1, &match.Player2, &match.Commit1, &match.Commit2, &match.Map, &match.Category, &result, &match.Time, &match.MapVersion)
+	match.Result = MatchResult(result)
+	return match, err
+}
+
+// Records the version of the map a match is played on, for matches created before maps were versioned
+func (c *Commands) SetMatchMapVersion(id int64, version int) error {
+	_, err := c.tx.Exec("update match set map_version = ? where id = ?", version, id)
+	return err
+}
+
+// The ids of the matches with a result, either ranked matches or scrimmages
+func (c *Commands) ListMatchIds(result MatchResult, scrimmage bool) ([]int64, error) {
+	if rows, err := c.tx.Query("select id from match where result = ? and (scrimmage != 0) = ? order by id", string(result), scrimmage); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err2 := rows.Scan(&id); err2 != nil {
+				return nil, err2
+			} else {
+				ids = append(ids, id)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+}
+
 func (c *Commands) GetMatchReplay(id int64) ([]byte, TournamentCategory, error) {
 	var replay []byte
 	var category string
@@ -258,12 +628,79 @@ func (c *Commands) GetMatchReplay(id int64) ([]byte, TournamentCategory, error)
 	return replay, TournamentCategory(category), err
 }
 
-func (c *Commands) UpdateLeaderboard(category TournamentCategory, stats map[string]LeaderboardStats, commits map[string]string) error {
+func (c *Commands) UpdateMatchLog(id int64, stream, log string) error {
+	_, err := c.tx.Exec("insert or replace into match_log (match_id, stream, log) values (?,?,?)", id, stream, log)
+	return err
+}
+
+// Puts a finished match back in progress so it can be played again
+func (c *Commands) ResetMatch(id int64) error {
+	_, err := c.tx.Exec("update match set result = ?, replay = null where id = ?", string(MatchResultInProgress), id)
+	return err
+}
+
+func (c *Commands) CreateMatchAttempt(id int64, started, finished time.Time, result MatchResult, message string) error {
+	_, err := c.tx.Exec("insert into match_attempt (match_id, started, finished, result, error) values (?,?,?,?,?)", id, started, finished, string(result), message)
+	return err
+}
+
+// The number of attempts of a match which have failed since it last finished
+func (c *Commands) MatchFailures(id int64) (int, error) {
+	var failures int
+	err := c.tx.QueryRow("select count(*) from match_attempt where match_id = ? and result = ? and id > (select coalesce(max(id), 0) from match_attempt where match_id = ? and result != ?)", id, string(MatchResultError), id, string(MatchResultError)).Scan(&failures)
+	return failures, err
+}
+
+func (c *Commands) ListMatchAttempts(id int64) ([]MatchAttempt, error) {
+	if rows, err := c.tx.Query("select started, finished, result, error from match_attempt where match_id = ? order by id", id); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		attempts := []MatchAttempt{}
+		for rows.Next() {
+			var attempt MatchAttempt
+			var result string
+			if err2 := rows.Scan(&attempt.Started, &attempt.Finished, &result, &attempt.Error); err2 != nil {
+				return nil, err2
+			} else {
+				attempt.Result = MatchResult(result)
+				attempts = append(attempts, attempt)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return attempts, nil
+	}
+}
+
+func (c *Commands) GetMatchLogs(id int64) (map[string]string, error) {
+	if rows, err := c.tx.Query("select stream, log from match_log where match_id = ?", id); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		logs := map[string]string{}
+		for rows.Next() {
+			var stream, log string
+			if err2 := rows.Scan(&stream, &log); err2 != nil {
+				return nil, err2
+			} else {
+				logs[stream] = log
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return logs, nil
+	}
+}
+
+func (c *Commands) UpdateLeaderboard(category TournamentCategory, stats map[string]LeaderboardStats, commits map[string]string, ratings map[string]Rating) error {
 	if _, err := c.tx.Exec("delete from leaderboard where category = ?", string(category)); err != nil {
 		return err
 	} else {
 		for name, stat := range stats {
-			if _, err := c.tx.Exec("insert into leaderboard (name, category, commithash, score, wins, ties, losses) values (?,?,?,?,?,?,?)", name, string(category), commits[name], stat.Score, stat.Wins, stat.Ties, stat.Losses); err != nil {
+			if _, err := c.tx.Exec("insert into leaderboard (name, category, commithash, score, wins, ties, losses, rating, uncertainty) values (?,?,?,?,?,?,?,?,?)", name, string(category), commits[name], stat.Score, stat.Wins, stat.Ties, stat.Losses, ratings[name].Value, ratings[name].Uncertainty); err != nil {
 				return err
 			}
 		}
@@ -275,6 +712,7 @@ func (c *Commands) GetLeaderboard(category TournamentCategory) (map[string]Leade
 	if rows, err := c.tx.Query("select name, commithash, score, wins, ties, losses from leaderboard where category = ?", string(category)); err != nil {
 		return nil, nil, err
 	} else {
+		defer rows.Close()
 		nameCommit := map[string]string{}
 		stats := map[string]LeaderboardStats{}
 		for rows.Next() {
@@ -287,15 +725,19 @@ func (c *Commands) GetLeaderboard(category TournamentCategory) (map[string]Leade
 			stats[name] = stat
 			nameCommit[name] = commit
 		}
-		if matchRows, err := c.tx.Query("select id, player1, player2, commit1, commit2, map, category, result, updated from match where category = ?", string(category)); err != nil {
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+		if matchRows, err := c.tx.Query("select id, player1, player2, commit1, commit2, map, category, result, updated, map_version from match where category = ? and scrimmage = 0 and bracket = 0", string(category)); err != nil {
 			return nil, nil, err
 		} else {
+			defer matchRows.Close()
 			matches := []Match{}
 			for matchRows.Next() {
 				var match Match
 				var result string
 				var categoryString string
-				if err2 := matchRows.Scan(&match.Id, &match.Player1, &match.Player2, &match.Commit1, &match.Commit2, &match.Map, &categoryString, &result, &match.Time); err2 != nil {
+				if err2 := matchRows.Scan(&match.Id, &match.Player1, &match.Player2, &match.Commit1, &match.Commit2, &match.Map, &categoryString, &result, &match.Time, &match.MapVersion); err2 != nil {
 					return nil, nil, err2
 				} else {
 					match.Category = categoryString
@@ -305,11 +747,647 @@ func (c *Commands) GetLeaderboard(category TournamentCategory) (map[string]Leade
 					}
 				}
 			}
+			if err := matchRows.Err(); err != nil {
+				return nil, nil, err
+			}
 			return stats, matches, nil
 		}
 	}
 }
 
+func (c *Commands) CreateLeaderboardSnapshot(category TournamentCategory, created time.Time, points []LeaderboardPoint, ranking Ranking) error {
+	if rankingJson, err := json.Marshal(ranking); err != nil {
+		return err
+	} else if result, err := c.tx.Exec("insert into leaderboard_snapshot (category, created, ranking) values (?,?,?)", string(category), created, string(rankingJson)); err != nil {
+		return err
+	} else if id, err := result.LastInsertId(); err != nil {
+		return err
+	} else {
+		for _, point := range points {
+			if _, err := c.tx.Exec("insert into leaderboard_history (snapshot_id, name, commithash, rank, score, wins, ties, losses, rating) values (?,?,?,?,?,?,?,?,?)", id, point.Name, point.CommitHash, point.Rank, point.Score, point.Wins, point.Ties, point.Losses, point.Rating); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// The ranking stored with the latest leaderboard snapshot of a category
+func (c *Commands) GetLeaderboardRanking(category TournamentCategory) (Ranking, error) {
+	var ranking Ranking
+	var rankingJson string
+	if err := c.tx.QueryRow("select ranking from leaderboard_snapshot where category = ? order by id desc limit 1", string(category)).Scan(&rankingJson); err != nil {
+		return Ranking{}, err
+	} else if rankingJson == "" {
+		return Ranking{}, sql.ErrNoRows
+	} else if err := json.Unmarshal([]byte(rankingJson), &ranking); err != nil {
+		return Ranking{}, err
+	}
+	return ranking, nil
+}
+
+func (c *Commands) GetLeaderboardHistory(category TournamentCategory, name string) ([]LeaderboardPoint, error) {
+	if rows, err := c.tx.Query("select s.created, h.name, h.commithash, h.rank, (select count(*) from leaderboard_history p where p.snapshot_id = s.id), h.score, h.wins, h.ties, h.losses, h.rating from leaderboard_history h join leaderboard_snapshot s on s.id = h.snapshot_id where s.category = ? and h.name = ? order by s.id", string(category), name); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		history := []LeaderboardPoint{}
+		for rows.Next() {
+			var point LeaderboardPoint
+			if err := rows.Scan(&point.Time, &point.Name, &point.CommitHash, &point.Rank, &point.Players, &point.Score, &point.Wins, &point.Ties, &point.Losses, &point.Rating); err != nil {
+				return nil, err
+			}
+			history = append(history, point)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return history, nil
+	}
+}
+
+func (c *Commands) UpdateRatingHistory(category TournamentCategory, history map[string][]RatingPoint) error {
+	if _, err := c.tx.Exec("delete from rating_history where category = ?", string(category)); err != nil {
+		return err
+	}
+	for name, points := range history {
+		for _, point := range points {
+			if _, err := c.tx.Exec("insert into rating_history (category, name, match_id, time, rating, uncertainty) values (?,?,?,?,?,?)", string(category), name, point.MatchId, point.Time, point.Rating, point.Uncertainty); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Commands) GetRatings(category TournamentCategory) (map[string]PlayerRating, error) {
+	ratings := map[string]PlayerRating{}
+	if rows, err := c.tx.Query("select name, rating, uncertainty from leaderboard where category = ?", string(category)); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			rating := PlayerRating{History: []RatingPoint{}}
+			if err := rows.Scan(&name, &rating.Rating, &rating.Uncertainty); err != nil {
+				return nil, err
+			}
+			ratings[name] = rating
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if rows, err := c.tx.Query("select name, match_id, time, rating, uncertainty from rating_history where category = ? order by rowid", string(category)); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			var point RatingPoint
+			if err := rows.Scan(&name, &point.MatchId, &point.Time, &point.Rating, &point.Uncertainty); err != nil {
+				return nil, err
+			} else if rating, ok := ratings[name]; ok {
+				rating.History = append(rating.History, point)
+				ratings[name] = rating
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ratings, nil
+}
+
+func (c *Commands) CreateBracket(bracket Bracket) (int64, error) {
+	if maps, err := json.Marshal(bracket.Maps); err != nil {
+		return 0, err
+	} else if seeds, err := json.Marshal(bracket.Seeds); err != nil {
+		return 0, err
+	} else if result, err := c.tx.Exec("insert into bracket (name, category, format, best_of, maps, seeds, created) values (?,?,?,?,?,?,?)", bracket.Name, string(bracket.Category), bracket.Format, bracket.BestOf, string(maps), string(seeds), bracket.Created); err != nil {
+		return 0, err
+	} else if id, err := result.LastInsertId(); err != nil {
+		return 0, err
+	} else {
+		for _, series := range bracket.Series {
+			a, b := series.Players[0], series.Players[1]
+			if _, err := c.tx.Exec("insert into bracket_series (bracket_id, id, side, round, position, player1, commit1, seed1, ready1, player2, commit2, seed2, ready2, next_winner, next_winner_slot, next_loser, next_loser_slot) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)", id, series.Id, series.Side, series.Round, series.Position, a.Name, a.Commit, a.Seed, a.Ready, b.Name, b.Commit, b.Seed, b.Ready, series.NextWinner, series.NextWinnerSlot, series.NextLoser, series.NextLoserSlot); err != nil {
+				return 0, err
+			}
+		}
+		return id, nil
+	}
+}
+
+func (c *Commands) GetBracket(id int64) (Bracket, error) {
+	var bracket Bracket
+	var category, maps, seeds string
+	if err := c.tx.QueryRow("select id, name, category, format, best_of, maps, seeds, champion, created from bracket where id = ?", id).Scan(&bracket.Id, &bracket.Name, &category, &bracket.Format, &bracket.BestOf, &maps, &seeds, &bracket.Champion, &bracket.Created); err != nil {
+		return Bracket{}, err
+	} else if err := json.Unmarshal([]byte(maps), &bracket.Maps); err != nil {
+		return Bracket{}, err
+	} else if err := json.Unmarshal([]byte(seeds), &bracket.Seeds); err != nil {
+		return Bracket{}, err
+	}
+	bracket.Category = TournamentCategory(category)
+	bracket.Series = []BracketSeries{}
+	if rows, err := c.tx.Query("select id, side, round, position, player1, commit1, seed1, ready1, player2, commit2, seed2, ready2, winner, done, next_winner, next_winner_slot, next_loser, next_loser_slot from bracket_series where bracket_id = ? order by id", id); err != nil {
+		return Bracket{}, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			series := BracketSeries{Games: []SeriesGame{}}
+			a, b := &series.Players[0], &series.Players[1]
+			if err := rows.Scan(&series.Id, &series.Side, &series.Round, &series.Position, &a.Name, &a.Commit, &a.Seed, &a.Ready, &b.Name, &b.Commit, &b.Seed, &b.Ready, &series.Winner, &series.Done, &series.NextWinner, &series.NextWinnerSlot, &series.NextLoser, &series.NextLoserSlot); err != nil {
+				return Bracket{}, err
+			}
+			bracket.Series = append(bracket.Series, series)
+		}
+		if err := rows.Err(); err != nil {
+			return Bracket{}, err
+		}
+	}
+	if rows, err := c.tx.Query("select g.series_id, g.match_id, m.map, m.player1, m.result from bracket_game g join match m on m.id = g.match_id where g.bracket_id = ? order by g.series_id, g.game", id); err != nil {
+		return Bracket{}, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var seriesId int
+			var game SeriesGame
+			var result string
+			if err := rows.Scan(&seriesId, &game.MatchId, &game.Map, &game.Player1, &result); err != nil {
+				return Bracket{}, err
+			} else if seriesId >= 0 && seriesId < len(bracket.Series) {
+				game.Result = MatchResult(result)
+				bracket.Series[seriesId].Games = append(bracket.Series[seriesId].Games, game)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return Bracket{}, err
+		}
+	}
+	return bracket, nil
+}
+
+func (c *Commands) ListBrackets(category TournamentCategory) ([]Bracket, error) {
+	if rows, err := c.tx.Query("select id, name, format, best_of, champion, created from bracket where category = ? order by id", string(category)); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		brackets := []Bracket{}
+		for rows.Next() {
+			bracket := Bracket{Category: category}
+			if err := rows.Scan(&bracket.Id, &bracket.Name, &bracket.Format, &bracket.BestOf, &bracket.Champion, &bracket.Created); err != nil {
+				return nil, err
+			}
+			brackets = append(brackets, bracket)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return brackets, nil
+	}
+}
+
+func queryIds(db dbcon, query string, args ...interface{}) ([]int64, error) {
+	if rows, err := db.Query(query, args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return ids, nil
+	}
+}
+
+func (c *Commands) ListOpenBrackets() ([]int64, error) {
+	ids, err := queryIds(c.tx, "select id from bracket where champion = '' order by id")
+	return ids, err
+}
+
+func (c *Commands) ListMatchBrackets(matchId int64) ([]int64, error) {
+	ids, err := queryIds(c.tx, "select distinct g.bracket_id from bracket_game g join bracket b on b.id = g.bracket_id where g.match_id = ? and b.champion = '' order by g.bracket_id", matchId)
+	return ids, err
+}
+
+func (c *Commands) UpdateBracketSeries(bracketId int64, series BracketSeries) error {
+	a, b := series.Players[0], series.Players[1]
+	_, err := c.tx.Exec("update bracket_series set player1 = ?, commit1 = ?, seed1 = ?, ready1 = ?, player2 = ?, commit2 = ?, seed2 = ?, ready2 = ?, winner = ?, done = ? where bracket_id = ? and id = ?", a.Name, a.Commit, a.Seed, a.Ready, b.Name, b.Commit, b.Seed, b.Ready, series.Winner, series.Done, bracketId, series.Id)
+	return err
+}
+
+func (c *Commands) AddSeriesGame(bracketId int64, seriesId, game int, matchId int64) error {
+	_, err := c.tx.Exec("insert into bracket_game (bracket_id, series_id, game, match_id) values (?,?,?,?)", bracketId, seriesId, game, matchId)
+	return err
+}
+
+// Creates a match for a game of a bracket series, or returns the match when the series already has it.
+// Bracket matches are never shared with ranked matches or other series, so a rematch is played again.
+func (c *Commands) CreateBracketMatch(bracketId int64, seriesId int, category TournamentCategory, mapName string, player1, player2 Submission, created time.Time) (int64, error) {
+	var id int64
+	if version, err := c.latestMapVersion(mapName, category); err != nil {
+		return 0, err
+	} else if err := c.tx.QueryRow("select id from match where player1 = ? and player2 = ? and commit1 = ? and commit2 = ? and map = ? and map_version = ? and category = ? and bracket = ? and series = ?", player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, mapName, version, string(category), bracketId, seriesId).Scan(&id); err == nil {
+		return id, nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	} else if result, err := c.tx.Exec("insert into match(category, map, map_version, player1, player2, commit1, commit2, created, updated, result, bracket, series) values (?,?,?,?,?,?,?,?,?,?,?,?)", string(category), mapName, version, player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, created, created, MatchResultInProgress, bracketId, seriesId); err != nil {
+		return 0, err
+	} else {
+		return result.LastInsertId()
+	}
+}
+
+func (c *Commands) SetBracketChampion(id int64, champion string) error {
+	_, err := c.tx.Exec("update bracket set champion = ? where id = ?", champion, id)
+	return err
+}
+
+func (c *Commands) CreateSwiss(swiss SwissTournament) (int64, error) {
+	if maps, err := json.Marshal(swiss.Maps); err != nil {
+		return 0, err
+	} else if players, err := json.Marshal(swiss.Players); err != nil {
+		return 0, err
+	} else if result, err := c.tx.Exec("insert into swiss (name, category, rounds, maps, players, created) values (?,?,?,?,?,?)", swiss.Name, string(swiss.Category), swiss.Rounds, string(maps), string(players), swiss.Created); err != nil {
+		return 0, err
+	} else {
+		return result.LastInsertId()
+	}
+}
+
+func (c *Commands) GetSwiss(id int64) (SwissTournament, error) {
+	var swiss SwissTournament
+	var category, maps, players string
+	if err := c.tx.QueryRow("select id, name, category, rounds, round, maps, players, finished, created from swiss where id = ?", id).Scan(&swiss.Id, &swiss.Name, &category, &swiss.Rounds, &swiss.Round, &maps, &players, &swiss.Finished, &swiss.Created); err != nil {
+		return SwissTournament{}, err
+	} else if err := json.Unmarshal([]byte(maps), &swiss.Maps); err != nil {
+		return SwissTournament{}, err
+	} else if err := json.Unmarshal([]byte(players), &swiss.Players); err != nil {
+		return SwissTournament{}, err
+	}
+	swiss.Category = TournamentCategory(category)
+	swiss.Pairings = []SwissPairing{}
+	boards := map[[2]int]int{}
+	if rows, err := c.tx.Query("select round, board, player1, player2 from swiss_pairing where swiss_id = ? order by round, board", id); err != nil {
+		return SwissTournament{}, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			pairing := SwissPairing{Games: []SeriesGame{}}
+			if err := rows.Scan(&pairing.Round, &pairing.Board, &pairing.Player1, &pairing.Player2); err != nil {
+				return SwissTournament{}, err
+			}
+			boards[[2]int{pairing.Round, pairing.Board}] = len(swiss.Pairings)
+			swiss.Pairings = append(swiss.Pairings, pairing)
+		}
+		if err := rows.Err(); err != nil {
+			return SwissTournament{}, err
+		}
+	}
+	if rows, err := c.tx.Query("select g.round, g.board, g.match_id, m.map, m.player1, m.result from swiss_game g join match m on m.id = g.match_id where g.swiss_id = ? order by g.round, g.board, g.game", id); err != nil {
+		return SwissTournament{}, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var round, board int
+			var game SeriesGame
+			var result string
+			if err := rows.Scan(&round, &board, &game.MatchId, &game.Map, &game.Player1, &result); err != nil {
+				return SwissTournament{}, err
+			} else if i, ok := boards[[2]int{round, board}]; ok {
+				game.Result = MatchResult(result)
+				swiss.Pairings[i].Games = append(swiss.Pairings[i].Games, game)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return SwissTournament{}, err
+		}
+	}
+	return swiss, nil
+}
+
+func (c *Commands) ListSwiss(category TournamentCategory) ([]SwissTournament, error) {
+	if rows, err := c.tx.Query("select id, name, rounds, round, finished, created from swiss where category = ? order by id", string(category)); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		tournaments := []SwissTournament{}
+		for rows.Next() {
+			swiss := SwissTournament{Category: category}
+			if err := rows.Scan(&swiss.Id, &swiss.Name, &swiss.Rounds, &swiss.Round, &swiss.Finished, &swiss.Created); err != nil {
+				return nil, err
+			}
+			tournaments = append(tournaments, swiss)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return tournaments, nil
+	}
+}
+
+func (c *Commands) ListOpenSwiss() ([]int64, error) {
+	ids, err := queryIds(c.tx, "select id from swiss where finished = 0 order by id")
+	return ids, err
+}
+
+func (c *Commands) ListMatchSwiss(matchId int64) ([]int64, error) {
+	ids, err := queryIds(c.tx, "select distinct g.swiss_id from swiss_game g join swiss s on s.id = g.swiss_id where g.match_id = ? and s.finished = 0 order by g.swiss_id", matchId)
+	return ids, err
+}
+
+func (c *Commands) CreateSwissPairing(swissId int64, pairing SwissPairing) error {
+	if _, err := c.tx.Exec("insert into swiss_pairing (swiss_id, round, board, player1, player2) values (?,?,?,?,?)", swissId, pairing.Round, pairing.Board, pairing.Player1, pairing.Player2); err != nil {
+		return err
+	}
+	for game, g := range pairing.Games {
+		if _, err := c.tx.Exec("insert into swiss_game (swiss_id, round, board, game, match_id) values (?,?,?,?,?)", swissId, pairing.Round, pairing.Board, game, g.MatchId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Commands) SetSwissRound(id int64, round int) error {
+	_, err := c.tx.Exec("update swiss set round = ? where id = ?", round, id)
+	return err
+}
+
+func (c *Commands) FinishSwiss(id int64) error {
+	_, err := c.tx.Exec("update swiss set finished = 1 where id = ?", id)
+	return err
+}
+
+func (c *Commands) CreateSeason(season Season) (int64, error) {
+	if result, err := c.tx.Exec("insert into season (name, created) values (?,?)", season.Name, season.Created); err != nil {
+		return 0, err
+	} else {
+		return result.LastInsertId()
+	}
+}
+
+func (c *Commands) GetSeason(id int64) (Season, error) {
+	var season Season
+	if err := c.tx.QueryRow("select id, name, created from season where id = ?", id).Scan(&season.Id, &season.Name, &season.Created); err != nil {
+		return Season{}, err
+	} else if phases, err := c.queryPhases("where season_id = ? order by start, id", id); err != nil {
+		return Season{}, err
+	} else {
+		for i := range phases {
+			if phases[i].Leaderboard, err = c.phaseLeaderboard(phases[i].Id); err != nil {
+				return Season{}, err
+			}
+		}
+		season.Phases = phases
+		return season, nil
+	}
+}
+
+func (c *Commands) ListSeasons() ([]Season, error) {
+	if rows, err := c.tx.Query("select id, name, created from season order by id"); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		seasons := []Season{}
+		for rows.Next() {
+			var season Season
+			if err := rows.Scan(&season.Id, &season.Name, &season.Created); err != nil {
+				return nil, err
+			}
+			seasons = append(seasons, season)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return seasons, nil
+	}
+}
+
+func (c *Commands) CreatePhase(phase Phase) (int64, error) {
+	scoring := ""
+	if phase.Scoring != nil {
+		if bs, err := json.Marshal(phase.Scoring); err != nil {
+			return 0, err
+		} else {
+			scoring = string(bs)
+		}
+	}
+	if maps, err := json.Marshal(phase.Maps); err != nil {
+		return 0, err
+	} else if result, err := c.tx.Exec("insert into phase (season_id, name, category, format, maps, pool, start, freeze, scoring) values (?,?,?,?,?,?,?,?,?)", phase.SeasonId, phase.Name, string(phase.Category), phase.Format, string(maps), phase.Pool, phase.Start, phase.Freeze, scoring); err != nil {
+		return 0, err
+	} else {
+		return result.LastInsertId()
+	}
+}
+
+func (c *Commands) GetPhase(id int64) (Phase, error) {
+	if phases, err := c.queryPhases("where id = ?", id); err != nil {
+		return Phase{}, err
+	} else if len(phases) == 0 {
+		return Phase{}, sql.ErrNoRows
+	} else if phases[0].Leaderboard, err = c.phaseLeaderboard(id); err != nil {
+		return Phase{}, err
+	} else {
+		return phases[0], nil
+	}
+}
+
+func (c *Commands) ListCategoryPhases(category TournamentCategory) ([]Phase, error) {
+	phases, err := c.queryPhases("where category = ? order by start, id", string(category))
+	return phases, err
+}
+
+// Phases without their leaderboards
+func (c *Commands) queryPhases(where string, args ...interface{}) ([]Phase, error) {
+	if rows, err := c.tx.Query("select id, season_id, name, category, format, maps, pool, start, freeze, players, event_id, started, finished, scoring from phase "+where, args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		phases := []Phase{}
+		for rows.Next() {
+			var phase Phase
+			var category, maps, players, scoring string
+			if err := rows.Scan(&phase.Id, &phase.SeasonId, &phase.Name, &category, &phase.Format, &maps, &phase.Pool, &phase.Start, &phase.Freeze, &players, &phase.EventId, &phase.Started, &phase.Finished, &scoring); err != nil {
+				return nil, err
+			} else if err := json.Unmarshal([]byte(maps), &phase.Maps); err != nil {
+				return nil, err
+			} else if err := json.Unmarshal([]byte(players), &phase.Players); err != nil {
+				return nil, err
+			} else if scoring != "" {
+				if err := json.Unmarshal([]byte(scoring), &phase.Scoring); err != nil {
+					return nil, err
+				}
+			}
+			phase.Category = TournamentCategory(category)
+			phase.Leaderboard = []PhaseStanding{}
+			phases = append(phases, phase)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return phases, nil
+	}
+}
+
+func (c *Commands) phaseLeaderboard(phaseId int64) ([]PhaseStanding, error) {
+	if rows, err := c.tx.Query("select rank, name, commithash, score, wins, ties, losses from phase_leaderboard where phase_id = ? order by rank, rowid", phaseId); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		standings := []PhaseStanding{}
+		for rows.Next() {
+			var standing PhaseStanding
+			if err := rows.Scan(&standing.Rank, &standing.Name, &standing.CommitHash, &standing.Score, &standing.Wins, &standing.Ties, &standing.Losses); err != nil {
+				return nil, err
+			}
+			standings = append(standings, standing)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return standings, nil
+	}
+}
+
+func (c *Commands) StartPhase(id int64, players []Submission, eventId int64) error {
+	if bs, err := json.Marshal(players); err != nil {
+		return err
+	} else {
+		_, err := c.tx.Exec("update phase set players = ?, event_id = ?, started = 1 where id = ?", string(bs), eventId, id)
+		return err
+	}
+}
+
+// Replaces the maps of a phase which has not started
+func (c *Commands) SetPhaseMaps(id int64, maps []string) error {
+	if bs, err := json.Marshal(maps); err != nil {
+		return err
+	} else if result, err := c.tx.Exec("update phase set maps = ? where id = ? and started = 0", string(bs), id); err != nil {
+		return err
+	} else if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("Phase %v has already started", id)
+	}
+	return nil
+}
+
+// Records the leaderboard of a phase, a phase can only be finished once
+func (c *Commands) FinishPhase(id int64, standings []PhaseStanding, matchIds []int64) error {
+	if result, err := c.tx.Exec("update phase set finished = 1 where id = ? and finished = 0", id); err != nil {
+		return err
+	} else if count, err := result.RowsAffected(); err != nil {
+		return err
+	} else if count == 0 {
+		return errors.New("Phase has already finished")
+	}
+	for _, standing := range standings {
+		if _, err := c.tx.Exec("insert into phase_leaderboard (phase_id, rank, name, commithash, score, wins, ties, losses) values (?,?,?,?,?,?,?,?)", id, standing.Rank, standing.Name, standing.CommitHash, standing.Score, standing.Wins, standing.Ties, standing.Losses); err != nil {
+			return err
+		}
+	}
+	for _, matchId := range matchIds {
+		if _, err := c.tx.Exec("insert or ignore into phase_match (phase_id, match_id) values (?,?)", id, matchId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Commands) IsPhaseMatch(matchId int64) (bool, error) {
+	var frozen bool
+	err := c.tx.QueryRow("select count(*) > 0 from phase_match where match_id = ?", matchId).Scan(&frozen)
+	return frozen, err
+}
+
+func (c *Commands) CreateScrimmage(scrimmage Scrimmage) (int64, error) {
+	if result, err := c.tx.Exec("insert into scrimmage (category, requester, opponent, created) values (?,?,?,?)", string(scrimmage.Category), scrimmage.Requester, scrimmage.Opponent, scrimmage.Created); err != nil {
+		return 0, err
+	} else {
+		return result.LastInsertId()
+	}
+}
+
+// Creates a match which belongs to a scrimmage, scrimmage matches are never shared with ranked matches
+func (c *Commands) CreateScrimmageMatch(scrimmageId int64, category TournamentCategory, mapName string, player1, player2 Submission, created time.Time) (int64, error) {
+	if version, err := c.latestMapVersion(mapName, category); err != nil {
+		return 0, err
+	} else if result, err := c.tx.Exec("insert into match(category, map, map_version, player1, player2, commit1, commit2, created, updated, result, scrimmage) values (?,?,?,?,?,?,?,?,?,?,?)", string(category), mapName, version, player1.Name, player2.Name, player1.CommitHash, player2.CommitHash, created, created, MatchResultInProgress, scrimmageId); err != nil {
+		return 0, err
+	} else {
+		return result.LastInsertId()
+	}
+}
+
+func (c *Commands) GetScrimmage(id int64) (Scrimmage, error) {
+	if scrimmages, err := c.queryScrimmages("where id = ?", id); err != nil {
+		return Scrimmage{}, err
+	} else if len(scrimmages) == 0 {
+		return Scrimmage{}, sql.ErrNoRows
+	} else {
+		return scrimmages[0], nil
+	}
+}
+
+// The scrimmages a player requested or was challenged to, newest first
+func (c *Commands) ListScrimmages(name string, category TournamentCategory) ([]Scrimmage, error) {
+	scrimmages, err := c.queryScrimmages("where (requester = ? or opponent = ?) and category = ? order by id desc", name, name, string(category))
+	return scrimmages, err
+}
+
+func (c *Commands) queryScrimmages(where string, args ...interface{}) ([]Scrimmage, error) {
+	scrimmages := []Scrimmage{}
+	index := map[int64]int{}
+	if rows, err := c.tx.Query("select id, category, requester, opponent, created from scrimmage "+where, args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			scrimmage := Scrimmage{Games: []SeriesGame{}}
+			var category string
+			if err := rows.Scan(&scrimmage.Id, &category, &scrimmage.Requester, &scrimmage.Opponent, &scrimmage.Created); err != nil {
+				return nil, err
+			}
+			scrimmage.Category = TournamentCategory(category)
+			index[scrimmage.Id] = len(scrimmages)
+			scrimmages = append(scrimmages, scrimmage)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if rows, err := c.tx.Query("select scrimmage, id, map, player1, result from match where scrimmage in (select id from scrimmage "+where+") order by id", args...); err != nil {
+		return nil, err
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			var scrimmageId int64
+			var game SeriesGame
+			var result string
+			if err := rows.Scan(&scrimmageId, &game.MatchId, &game.Map, &game.Player1, &result); err != nil {
+				return nil, err
+			} else if i, ok := index[scrimmageId]; ok {
+				game.Result = MatchResult(result)
+				scrimmages[i].Games = append(scrimmages[i].Games, game)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return scrimmages, nil
+}
+
 /*
 func (c *Database) InitTables(config Config) error {
 	_, err := c.db.Exec("create table if not exists user (name text not null primary key, public_key text not null, date_created timestamp not null default current_timestamp);")
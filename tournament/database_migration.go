@@ -11,4 +11,76 @@ var SchemaMigrations = map[string][]string{
 		"create table if not exists match (id integer primary key, category text not null, player1 text not null, player2 text not null, commit1 text not null, commit2 text not null, map text not null, result text not null, created timestamp not null default current_timestamp, updated timestamp default null, replay blob default null, unique (category, map, player1, player2, commit1, commit2))",
 		"create table if not exists leaderboard (name text not null, category text not null, commithash text not null, score int not null, wins int not null, ties int not null, losses int not null, unique (name, category, commithash))",
 	},
+	"0.0.3": []string{
+		"alter table submission add column status text not null default 'Accepted'",
+		"alter table submission add column output text not null default ''",
+	},
+	"0.0.4": []string{
+		"create table if not exists match_log (match_id integer not null, stream text not null, log text not null, unique (match_id, stream))",
+		"alter table user add column token text not null default ''",
+	},
+	"0.0.5": []string{
+		"create table if not exists match_attempt (id integer primary key, match_id integer not null, started timestamp not null, finished timestamp not null, result text not null, error text not null default '')",
+	},
+	"0.0.6": []string{
+		"alter table leaderboard add column rating real not null default 0",
+		"alter table leaderboard add column uncertainty real not null default 0",
+		"create table if not exists rating_history (category text not null, name text not null, match_id integer not null, time timestamp not null, rating real not null, uncertainty real not null)",
+	},
+	"0.0.7": []string{
+		"create table if not exists bracket (id integer primary key, name text not null, category text not null, format text not null, best_of integer not null, maps text not null, seeds text not null, champion text not null default '', created timestamp not null default current_timestamp)",
+		"create table if not exists bracket_series (bracket_id integer not null, id integer not null, side text not null, round integer not null, position integer not null, player1 text not null, commit1 text not null, seed1 integer not null, ready1 integer not null, player2 text not null, commit2 text not null, seed2 integer not null, ready2 integer not null, winner text not null default '', done integer not null default 0, next_winner integer not null, next_winner_slot integer not null, next_loser integer not null, next_loser_slot integer not null, unique (bracket_id, id))",
+		"create table if not exists bracket_game (bracket_id integer not null, series_id integer not null, game integer not null, match_id integer not null, unique (bracket_id, series_id, game))",
+	},
+	"0.0.8": []string{
+		"create table if not exists swiss (id integer primary key, name text not null, category text not null, rounds integer not null, round integer not null default 0, maps text not null, players text not null, finished integer not null default 0, created timestamp not null default current_timestamp)",
+		"create table if not exists swiss_pairing (swiss_id integer not null, round integer not null, board integer not null, player1 text not null, player2 text not null, unique (swiss_id, round, board))",
+		"create table if not exists swiss_game (swiss_id integer not null, round integer not null, board integer not null, game integer not null, match_id integer not null, unique (swiss_id, round, board, game))",
+	},
+	"0.0.9": []string{
+		"create table if not exists season (id integer primary key, name text not null, created timestamp not null default current_timestamp)",
+		"create table if not exists phase (id integer primary key, season_id integer not null, name text not null, category text not null, format text not null, maps text not null, start timestamp not null, freeze timestamp not null, players text not null default '[]', event_id integer not null default 0, started integer not null default 0, finished integer not null default 0)",
+		"create table if not exists phase_leaderboard (phase_id integer not null, rank integer not null, name text not null, commithash text not null, score real not null, wins integer not null, ties integer not null, losses integer not null, unique (phase_id, name))",
+		"create table if not exists phase_match (phase_id integer not null, match_id integer not null, unique (phase_id, match_id))",
+	},
+	"0.0.10": []string{
+		"create table if not exists scrimmage (id integer primary key, category text not null, requester text not null, opponent text not null, created timestamp not null default current_timestamp)",
+		"create table if not exists match_copy (id integer primary key, category text not null, player1 text not null, player2 text not null, commit1 text not null, commit2 text not null, map text not null, result text not null, created timestamp not null default current_timestamp, updated timestamp default null, replay blob default null, scrimmage integer not null default 0, unique (category, map, player1, player2, commit1, commit2, scrimmage))",
+		"insert into match_copy (id, category, player1, player2, commit1, commit2, map, result, created, updated, replay) select id, category, player1, player2, commit1, commit2, map, result, created, updated, replay from match",
+		"drop table match",
+		"alter table match_copy rename to match",
+	},
+	"0.0.11": []string{
+		"create table if not exists leaderboard_snapshot (id integer primary key, category text not null, created timestamp not null default current_timestamp)",
+		"create table if not exists leaderboard_history (snapshot_id integer not null, name text not null, commithash text not null, rank integer not null, score real not null, wins integer not null, ties integer not null, losses integer not null, rating real not null, unique (snapshot_id, name))",
+		"create index if not exists leaderboard_history_name on leaderboard_history (name)",
+	},
+	"0.0.12": []string{
+		"alter table phase add column scoring text not null default ''",
+	},
+	"0.0.13": []string{
+		"create table if not exists map_copy (name text not null, category text not null, version integer not null, source text not null, deleted integer not null default 0, created timestamp not null default current_timestamp, unique(name, category, version))",
+		"insert into map_copy (name, category, version, source) select name, category, 1, source from map",
+		"drop table map",
+		"alter table map_copy rename to map",
+		"alter table match add column map_version integer not null default 0",
+		"create table if not exists map_pool (name text not null, category text not null, maps text not null, created timestamp not null default current_timestamp, unique(name, category))",
+		"alter table phase add column pool text not null default ''",
+	},
+	"0.0.14": []string{
+		"alter table leaderboard_snapshot add column ranking text not null default ''",
+	},
+	"0.0.15": []string{
+		"create table if not exists match_copy (id integer primary key, category text not null, player1 text not null, player2 text not null, commit1 text not null, commit2 text not null, map text not null, result text not null, created timestamp not null default current_timestamp, updated timestamp default null, replay blob default null, scrimmage integer not null default 0, map_version integer not null default 0, unique (category, map, map_version, player1, player2, commit1, commit2, scrimmage))",
+		"insert into match_copy (id, category, player1, player2, commit1, commit2, map, result, created, updated, replay, scrimmage, map_version) select id, category, player1, player2, commit1, commit2, map, result, created, updated, replay, scrimmage, map_version from match",
+		"drop table match",
+		"alter table match_copy rename to match",
+		"update match set map_version = 1 where map_version = 0 and exists (select 1 from map where map.name = match.map and map.category = match.category)",
+	},
+	"0.0.16": []string{
+		"create table if not exists match_copy (id integer primary key, category text not null, player1 text not null, player2 text not null, commit1 text not null, commit2 text not null, map text not null, result text not null, created timestamp not null default current_timestamp, updated timestamp default null, replay blob default null, scrimmage integer not null default 0, map_version integer not null default 0, bracket integer not null default 0, series integer not null default 0, unique (category, map, map_version, player1, player2, commit1, commit2, scrimmage, bracket, series))",
+		"insert into match_copy (id, category, player1, player2, commit1, commit2, map, result, created, updated, replay, scrimmage, map_version) select id, category, player1, player2, commit1, commit2, map, result, created, updated, replay, scrimmage, map_version from match",
+		"drop table match",
+		"alter table match_copy rename to match",
+	},
 }
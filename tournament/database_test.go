@@ -2,6 +2,7 @@ package tournament
 
 import (
 	"testing"
+	"time"
 )
 
 // import "code.google.com/p/gomock/gomock"
@@ -78,3 +79,30 @@ func TestMigrateSchema(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestQueryScanErrorReleasesConnection(t *testing.T) {
+	database, err := NewInMemoryDatabase()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := database.MigrateSchema(); err != nil {
+		t.Fatal(err)
+	} else if _, err := database.(*SQLiteDatabase).conn.Exec("insert into match (category, player1, player2, commit1, commit2, map, result, updated) values (?,?,?,?,?,?,?,null)", string(CategoryTest), "p1", "p2", "c1", "c2", "Map1", string(MatchResultWinA)); err != nil {
+		t.Fatal(err)
+	} else if _, err := database.ListMatches(CategoryTest); err == nil {
+		t.Fatal("expected a match without an update time to fail to scan")
+	}
+	// The database has a single connection, which is lost if the failed query is not closed
+	done := make(chan error)
+	go func() {
+		_, err := database.ListUsers()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected the connection to be released after the failed query")
+	}
+}
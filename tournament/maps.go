@@ -0,0 +1,100 @@
+package tournament
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A version of a map's source. Each update adds a version, and matches record the version they were played on.
+type MapVersion struct {
+	Name     string             `json:"name"`
+	Category TournamentCategory `json:"category"`
+	Version  int                `json:"version"`
+	Source   string             `json:"source"`
+	Deleted  bool               `json:"deleted"`
+	Created  time.Time          `json:"created"`
+}
+
+// A named list of maps of a category which matches and phases can be played on instead of every map
+type MapPool struct {
+	Name     string             `json:"name"`
+	Category TournamentCategory `json:"category"`
+	Maps     []string           `json:"maps"`
+	Created  time.Time          `json:"created"`
+}
+
+// Replaces the source of a map, returning its new version
+func (t *Tournament) UpdateMap(name, source string, category TournamentCategory) (int, error) {
+	version, err := t.Database.UpdateMap(name, source, category)
+	return version, err
+}
+
+// Deletes a map so it is no longer listed or played, the versions matches were played on are kept
+func (t *Tournament) DeleteMap(name string, category TournamentCategory) error {
+	return t.Database.DeleteMap(name, category)
+}
+
+func (t *Tournament) GetMapVersion(name string, category TournamentCategory, version int) (MapVersion, error) {
+	m, err := t.Database.GetMapVersion(name, category, version)
+	return m, err
+}
+
+func (t *Tournament) ListMapVersions(name string, category TournamentCategory) ([]MapVersion, error) {
+	versions, err := t.Database.ListMapVersions(name, category)
+	return versions, err
+}
+
+// Creates or replaces a map pool, every map of the pool must exist
+func (t *Tournament) SetMapPool(name string, category TournamentCategory, maps []string, created time.Time) error {
+	if len(maps) == 0 {
+		return errors.New("A map pool needs at least one map")
+	}
+	return t.Database.TransactionBlock(func(tx Statements) error {
+		for _, mapName := range maps {
+			if exists, err := tx.MapExists(mapName, category); err != nil {
+				return err
+			} else if !exists {
+				return fmt.Errorf("Unknown map %v", mapName)
+			}
+		}
+		return tx.SetMapPool(MapPool{name, category, maps, created})
+	})
+}
+
+func (t *Tournament) GetMapPool(name string, category TournamentCategory) (MapPool, error) {
+	pool, err := t.Database.GetMapPool(name, category)
+	return pool, err
+}
+
+func (t *Tournament) ListMapPools(category TournamentCategory) ([]MapPool, error) {
+	pools, err := t.Database.ListMapPools(category)
+	return pools, err
+}
+
+// The maps of a pool which have not been deleted, or every map of the category when pool is empty
+func (t *Tournament) PoolMaps(category TournamentCategory, pool string) ([]string, error) {
+	if pool == "" {
+		return t.ListMaps(category)
+	}
+	if mapPool, err := t.GetMapPool(pool, category); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Unknown map pool %v", pool)
+	} else if err != nil {
+		return nil, err
+	} else if all, err := t.ListMaps(category); err != nil {
+		return nil, err
+	} else {
+		live := map[string]bool{}
+		for _, mapName := range all {
+			live[mapName] = true
+		}
+		maps := []string{}
+		for _, mapName := range mapPool.Maps {
+			if live[mapName] {
+				maps = append(maps, mapName)
+			}
+		}
+		return maps, nil
+	}
+}
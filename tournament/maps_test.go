@@ -0,0 +1,148 @@
+package tournament
+
+import (
+	"context"
+	"github.com/GlenKelley/battleref/testing"
+	"testing"
+	"time"
+)
+
+func TestMapVersions(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.CreateMap("Map1", "Source1", CategoryTest))
+		if err := tm.CreateMap("Map1", "Source2", CategoryTest); err == nil {
+			t.ErrorNow("Expected an error for a map which exists")
+		}
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "c1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "c2", time.Now()))
+		id, _, err := tm.RunMatch(context.Background(), CategoryTest, "Map1", Submission{"Name1", "c1"}, Submission{"Name2", "c2"}, SystemClock())
+		t.CheckError(err)
+
+		version, err := tm.UpdateMap("Map1", "Source2", CategoryTest)
+		t.CheckError(err)
+		t.ExpectEqual(version, 2)
+		if source, err := tm.GetMapSource("Map1", CategoryTest); err != nil || source != "Source2" {
+			t.ErrorNow("Expected the latest version's source", source, err)
+		} else if match, err := tm.GetMatch(id); err != nil || match.MapVersion != 1 {
+			t.ErrorNow("Expected the match to keep the version it was played on", match, err)
+		} else if m, err := tm.GetMapVersion("Map1", CategoryTest, 1); err != nil || m.Source != "Source1" {
+			t.ErrorNow("Expected the first version to be kept", m, err)
+		}
+
+		t.CheckError(tm.DeleteMap("Map1", CategoryTest))
+		if maps, err := tm.ListMaps(CategoryTest); err != nil || len(maps) != 0 {
+			t.ErrorNow("Expected a deleted map not to be listed", maps, err)
+		} else if _, err := tm.UpdateMap("Map1", "Source3", CategoryTest); err == nil {
+			t.ErrorNow("Expected an error updating a deleted map")
+		} else if err := tm.DeleteMap("Map1", CategoryTest); err == nil {
+			t.ErrorNow("Expected an error deleting a deleted map")
+		} else if versions, err := tm.ListMapVersions("Map1", CategoryTest); err != nil || len(versions) != 2 || !versions[1].Deleted {
+			t.ErrorNow("Expected the deleted versions to be kept", versions, err)
+		}
+
+		t.CheckError(tm.CreateMap("Map1", "Source3", CategoryTest))
+		if versions, err := tm.ListMapVersions("Map1", CategoryTest); err != nil || len(versions) != 3 || versions[2].Version != 3 {
+			t.ErrorNow("Expected a recreated map to continue its versions", versions, err)
+		}
+	})
+}
+
+func TestOutdatedMatchesAreReplanned(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.CreateMap("Map1", "Source1", CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "c1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "c2", time.Now()))
+		t.CheckError(tm.RunLatestMatches(CategoryTest))
+		played := func() int {
+			t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+			ranks, _, err := tm.GetLeaderboard(CategoryTest)
+			t.CheckError(err)
+			return ranks["Name1"].Wins + ranks["Name1"].Ties + ranks["Name1"].Losses
+		}
+		if n := played(); n != 2 {
+			t.ErrorNow("Expected both matches to be counted", n)
+		}
+
+		_, err := tm.UpdateMap("Map1", "Source2", CategoryTest)
+		t.CheckError(err)
+		if plan, err := tm.PlanLatestMatches(CategoryTest, ""); err != nil || plan.Played != 0 || len(plan.Matches) != 2 || plan.Matches[0].Reason != PlanOutdated {
+			t.ErrorNow("Expected the matches on the old version to be planned again", plan, err)
+		} else if n := played(); n != 0 {
+			t.ErrorNow("Expected the matches on the old version not to be counted", n)
+		}
+		t.CheckError(tm.RunLatestMatches(CategoryTest))
+		if matches, err := tm.ListMatches(CategoryTest); err != nil || len(matches) != 4 {
+			t.ErrorNow("Expected new matches on the new version", matches, err)
+		} else if plan, err := tm.PlanLatestMatches(CategoryTest, ""); err != nil || plan.Played != 2 || len(plan.Matches) != 0 {
+			t.ErrorNow("Expected nothing left to play", plan, err)
+		} else if n := played(); n != 2 {
+			t.ErrorNow("Expected the matches on the new version to be counted", n)
+		} else if match, err := tm.GetMatch(matches[3].Id); err != nil || match.MapVersion != 2 {
+			t.ErrorNow("Expected the new match to be played on the new version", match, err)
+		}
+	})
+}
+
+func TestMapPools(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		for _, name := range []string{"Map1", "Map2", "Map3"} {
+			t.CheckError(tm.CreateMap(name, "Source"+name, CategoryTest))
+		}
+		if err := tm.SetMapPool("Pool", CategoryTest, []string{}, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for an empty pool")
+		} else if err := tm.SetMapPool("Pool", CategoryTest, []string{"Map1", "MapFoo"}, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for an unknown map")
+		} else if _, err := tm.PoolMaps(CategoryTest, "Pool"); err == nil {
+			t.ErrorNow("Expected an error for an unknown pool")
+		}
+		t.CheckError(tm.SetMapPool("Pool", CategoryTest, []string{"Map1", "Map2"}, time.Now()))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "c1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "c2", time.Now()))
+		if plan, err := tm.PlanLatestMatches(CategoryTest, "Pool"); err != nil || plan.Total != 4 {
+			t.ErrorNow("Expected matches on the pool's maps", plan, err)
+		} else if plan, err := tm.PlanLatestMatches(CategoryTest, ""); err != nil || plan.Total != 6 {
+			t.ErrorNow("Expected matches on every map without a pool", plan, err)
+		}
+
+		t.CheckError(tm.DeleteMap("Map2", CategoryTest))
+		if maps, err := tm.PoolMaps(CategoryTest, "Pool"); err != nil || len(maps) != 1 || maps[0] != "Map1" {
+			t.ErrorNow("Expected deleted maps to leave the pool", maps, err)
+		} else if pools, err := tm.ListMapPools(CategoryTest); err != nil || len(pools) != 1 || len(pools[0].Maps) != 2 {
+			t.ErrorNow("Expected the pool to be listed as it was set", pools, err)
+		}
+	})
+}
+
+func TestPhaseMapPool(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		start := time.Now().Add(-time.Hour)
+		for _, name := range []string{"Map1", "Map2"} {
+			t.CheckError(tm.CreateMap(name, "Source"+name, CategoryTest))
+		}
+		t.CheckError(tm.SetMapPool("Pool", CategoryTest, []string{"Map1"}, start))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "c1", start))
+		seasonId, err := tm.CreateSeason("Season", start)
+		t.CheckError(err)
+		if _, err := tm.AddPhase(seasonId, "Qualifier", CategoryTest, PhaseRoundRobin, []string{"Map1"}, "Pool", start, start, nil); err == nil {
+			t.ErrorNow("Expected an error for both maps and a pool")
+		} else if _, err := tm.AddPhase(seasonId, "Qualifier", CategoryTest, PhaseRoundRobin, nil, "PoolFoo", start, start, nil); err == nil {
+			t.ErrorNow("Expected an error for an unknown pool")
+		}
+		id, err := tm.AddPhase(seasonId, "Qualifier", CategoryTest, PhaseRoundRobin, nil, "Pool", start, start, nil)
+		t.CheckError(err)
+
+		t.CheckError(tm.AddPhaseMaps(id, map[string]string{"Gen1": "SourceGen1"}))
+		if pool, err := tm.GetMapPool("Pool", CategoryTest); err != nil || len(pool.Maps) != 2 || pool.Maps[1] != "Gen1" {
+			t.ErrorNow("Expected added maps to join the phase's pool", pool, err)
+		}
+		t.CheckError(tm.SetMapPool("Pool", CategoryTest, []string{"Map2", "Gen1"}, start))
+		t.CheckError(tm.StartPhase(id, time.Now()))
+		if phase, err := tm.GetPhase(id); err != nil {
+			t.ErrorNow(err)
+		} else if phase.Pool != "Pool" || len(phase.Maps) != 2 || phase.Maps[0] != "Map2" {
+			t.ErrorNow("Expected the phase to be played on its pool as it started", phase)
+		}
+	})
+}
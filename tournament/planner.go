@@ -0,0 +1,147 @@
+package tournament
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Why a match is in a plan
+const (
+	PlanMissing  = "missing"
+	PlanFailed   = "failed"
+	PlanOutdated = "outdated"
+)
+
+// A match the round-robin still needs. MatchId is 0 until a missing or outdated match has been created,
+// and Error is set when the match could not be scheduled. An outdated match was played on an earlier
+// version of its map and is replaced by a match on the latest version.
+type PlannedMatch struct {
+	Map     string `json:"map"`
+	Player1 string `json:"player1"`
+	Commit1 string `json:"commit1"`
+	Player2 string `json:"player2"`
+	Commit2 string `json:"commit2"`
+	MatchId int64  `json:"match_id"`
+	Reason  string `json:"reason"`
+	Error   string `json:"error,omitempty"`
+}
+
+// The difference between a round-robin of the latest submissions on every map and the match table.
+// Total counts every match of the round-robin, Played those with a result and Queued those in progress.
+type MatchPlan struct {
+	Category TournamentCategory `json:"category"`
+	Total    int                `json:"total"`
+	Played   int                `json:"played"`
+	Queued   int                `json:"queued"`
+	Matches  []PlannedMatch     `json:"matches"`
+}
+
+// Returned when some matches of a plan could not be scheduled, the rest of the plan still runs
+type PlanError struct {
+	Failed []PlannedMatch
+}
+
+func (e PlanError) Error() string {
+	return fmt.Sprintf("%v planned matches failed, the first with: %v", len(e.Failed), e.Failed[0].Error)
+}
+
+// Plans the matches between the latest submissions of a category which have not been played, which
+// failed or which were played on an earlier version of their map, on the maps of a pool or every map when pool is empty. Nothing is scheduled, so the plan can be shown before it runs.
+func (t *Tournament) PlanLatestMatches(category TournamentCategory, pool string) (MatchPlan, error) {
+	if latestCommits, err := t.LatestCommits(category); err != nil {
+		return MatchPlan{category, 0, 0, 0, []PlannedMatch{}}, err
+	} else if maps, err := t.PoolMaps(category, pool); err != nil {
+		return MatchPlan{category, 0, 0, 0, []PlannedMatch{}}, err
+	} else {
+		return t.planMatches(category, latestCommits, maps)
+	}
+}
+
+// Plans a round-robin between submissions on the given maps
+func (t *Tournament) planMatches(category TournamentCategory, submissions []Submission, maps []string) (MatchPlan, error) {
+	plan := MatchPlan{category, 0, 0, 0, []PlannedMatch{}}
+	if matches, err := t.ListMatches(category); err != nil {
+		return plan, err
+	} else if versions, err := t.Database.MapVersions(category); err != nil {
+		return plan, err
+	} else {
+		matchLookup := map[string]map[string]map[string]Match{}
+		for _, match := range matches {
+			lookupInsert(matchLookup, match)
+		}
+		for _, submission1 := range submissions {
+			for _, submission2 := range submissions {
+				if submission1.Name == submission2.Name {
+					continue
+				}
+				for _, mapName := range maps {
+					plan.Total++
+					cell := PlannedMatch{mapName, submission1.Name, submission1.CommitHash, submission2.Name, submission2.CommitHash, 0, PlanMissing, ""}
+					if match, ok := lookupMatch(matchLookup, submission1.CommitHash, submission2.CommitHash, mapName); !ok {
+						plan.Matches = append(plan.Matches, cell)
+					} else if match.MapVersion != versions[mapName] {
+						cell.Reason = PlanOutdated
+						plan.Matches = append(plan.Matches, cell)
+					} else if match.Result == MatchResultError || match.Result == MatchResultTimeout {
+						cell.MatchId, cell.Reason = match.Id, PlanFailed
+						plan.Matches = append(plan.Matches, cell)
+					} else if match.Result == MatchResultInProgress {
+						plan.Queued++
+					} else {
+						plan.Played++
+					}
+				}
+			}
+		}
+		return plan, nil
+	}
+}
+
+// Adds the matches of a plan to the match queue, missing matches are created and failed matches rerun.
+// A match which cannot be scheduled is marked with its error and does not stop the rest.
+func (t *Tournament) EnqueuePlan(plan MatchPlan) MatchPlan {
+	for i := range plan.Matches {
+		cell := &plan.Matches[i]
+		var err error
+		if cell.Reason == PlanFailed {
+			err = t.RerunMatch(cell.MatchId)
+		} else {
+			cell.MatchId, err = t.EnqueueMatch(plan.Category, cell.Map, Submission{cell.Player1, cell.Commit1}, Submission{cell.Player2, cell.Commit2}, SystemClock())
+		}
+		if err != nil {
+			log.Printf("Failed to schedule %v against %v on %v: %v\n", cell.Player1, cell.Player2, cell.Map, err)
+			cell.Error = err.Error()
+		}
+	}
+	return plan
+}
+
+// Plays the matches of a plan one at a time, returning a PlanError for the matches which failed
+func (t *Tournament) RunPlan(plan MatchPlan) (MatchPlan, error) {
+	var failed []PlannedMatch
+	for i := range plan.Matches {
+		cell := &plan.Matches[i]
+		if id, _, err := t.RunMatch(context.Background(), plan.Category, cell.Map, Submission{cell.Player1, cell.Commit1}, Submission{cell.Player2, cell.Commit2}, SystemClock()); err != nil {
+			cell.MatchId, cell.Error = id, err.Error()
+			failed = append(failed, *cell)
+		} else {
+			cell.MatchId = id
+		}
+	}
+	if len(failed) > 0 {
+		return plan, PlanError{failed}
+	}
+	return plan, nil
+}
+
+// The matches of a plan which were scheduled without an error
+func (p MatchPlan) Scheduled() []int64 {
+	ids := []int64{}
+	for _, cell := range p.Matches {
+		if cell.Error == "" {
+			ids = append(ids, cell.MatchId)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,76 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"github.com/GlenKelley/battleref/testing"
+	"testing"
+	"time"
+)
+
+func checkPlan(t *testutil.T, tm *Tournament, total, played, queued, missing, failed int) MatchPlan {
+	plan, err := tm.PlanLatestMatches(CategoryTest, "")
+	t.CheckError(err)
+	counts := map[string]int{}
+	for _, cell := range plan.Matches {
+		counts[cell.Reason]++
+	}
+	if plan.Total != total || plan.Played != played || plan.Queued != queued || counts[PlanMissing] != missing || counts[PlanFailed] != failed {
+		t.ErrorNowf("Expected %v total, %v played, %v queued, %v missing and %v failed matches not %+v\n", total, played, queued, missing, failed, plan)
+	}
+	return plan
+}
+
+func TestPlanLatestMatches(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		p1, p2 := Submission{"Name1", "a1"}, Submission{"Name2", "b1"}
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.CreateMap("Map2", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit(p1.Name, CategoryTest, p1.CommitHash, time.Now()))
+		t.CheckError(tm.SubmitCommit(p2.Name, CategoryTest, p2.CommitHash, time.Now()))
+		checkPlan(t, tm, 4, 0, 0, 4, 0)
+
+		_, _, err := tm.RunMatch(context.Background(), CategoryTest, "Map1", p1, p2, SystemClock())
+		t.CheckError(err)
+		_, err = tm.CreateMatch(CategoryTest, "Map2", p1, p2, time.Now())
+		t.CheckError(err)
+		id, err := tm.CreateMatch(CategoryTest, "Map1", p2, p1, time.Now())
+		t.CheckError(err)
+		t.CheckError(tm.UpdateMatch(CategoryTest, "Map1", p2, p1, time.Now(), MatchResultError, []byte{}))
+		plan := checkPlan(t, tm, 4, 1, 1, 1, 1)
+		for _, cell := range plan.Matches {
+			if cell.Reason == PlanFailed && cell.MatchId != id {
+				t.ErrorNow("Expected the failed match to be rerun", cell)
+			} else if cell.Reason == PlanMissing && (cell.MatchId != 0 || cell.Map != "Map2" || cell.Player1 != p2.Name) {
+				t.ErrorNow("Unexpected missing match", cell)
+			}
+		}
+		if matches, err := tm.ListMatches(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(matches) != 3 {
+			t.ErrorNow("Expected planning not to create matches", len(matches))
+		}
+
+		t.CheckError(tm.UpdateMatch(CategoryTest, "Map2", p1, p2, time.Now(), MatchResultTimeout, []byte{}))
+		checkPlan(t, tm, 4, 1, 0, 1, 2)
+	})
+}
+
+func TestRunLatestMatchesContinuesAfterError(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = &flakyArena{Arena: tm.Arena, err: errors.New("worker lost"), failures: 1}
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.CreateMap("Map2", "MapSource", CategoryTest))
+		for _, name := range []string{"Name1", "Name2", "Name3"} {
+			t.CheckError(tm.SubmitCommit(name, CategoryTest, "c"+name, time.Now()))
+		}
+		if err := tm.RunLatestMatches(CategoryTest); err == nil {
+			t.ErrorNow("Expected an error for the failed match")
+		} else if planErr, ok := err.(PlanError); !ok || len(planErr.Failed) != 1 {
+			t.ErrorNow("Expected one failed match", err)
+		}
+		checkPlan(t, tm, 12, 11, 0, 0, 1)
+		t.CheckError(tm.RunLatestMatches(CategoryTest))
+		checkPlan(t, tm, 12, 12, 0, 0, 0)
+	})
+}
@@ -0,0 +1,274 @@
+package tournament
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// How the queue retries matches which failed because of the arena rather than the players
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{3, 30 * time.Second, 10 * time.Minute}
+
+// The wait before the next attempt of a match, doubling after each failure up to MaxBackoff
+func (p RetryPolicy) Delay(failures int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < failures && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// A queue of matches which are played in the background by a pool of workers.
+// Queued matches are stored in the match table with an InProgress result,
+// so any work that was pending when the server stopped is recovered on Start.
+// Scrimmages wait in a second queue which is only played when no ranked match is waiting.
+type MatchQueue struct {
+	tournament *Tournament
+	workers    int
+	clock      Clock
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mutex      sync.Mutex
+	cond       *sync.Cond
+	pending    []int64
+	scrimmages []int64
+	queued     map[int64]bool
+	low        map[int64]bool
+	running    int
+	rescoring  int
+	retrying   int
+	stopped    bool
+	dirty      map[TournamentCategory]bool
+	waitGroup  sync.WaitGroup
+}
+
+func NewMatchQueue(t *Tournament, workers int, clock Clock) *MatchQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &MatchQueue{
+		tournament: t,
+		workers:    workers,
+		clock:      clock,
+		queued:     map[int64]bool{},
+		low:        map[int64]bool{},
+		dirty:      map[TournamentCategory]bool{},
+	}
+	q.cond = sync.NewCond(&q.mutex)
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	return q
+}
+
+// Re-queues any unfinished matches from the database and starts the workers
+func (q *MatchQueue) Start() error {
+	if ids, err := q.tournament.Database.ListMatchIds(MatchResultInProgress, false); err != nil {
+		return err
+	} else if scrimmages, err := q.tournament.Database.ListMatchIds(MatchResultInProgress, true); err != nil {
+		return err
+	} else {
+		for _, id := range ids {
+			q.Push(id)
+		}
+		for _, id := range scrimmages {
+			q.PushScrimmage(id)
+		}
+		q.waitGroup.Add(q.workers)
+		for i := 0; i < q.workers; i++ {
+			go q.work()
+		}
+		return nil
+	}
+}
+
+// Stops the workers and cancels any running matches, which remain queued in the database
+func (q *MatchQueue) Stop() {
+	q.mutex.Lock()
+	q.stopped = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+	q.cancel()
+	q.waitGroup.Wait()
+}
+
+// Adds a match to the back of the queue, matches which are already queued are ignored
+func (q *MatchQueue) Push(id int64) {
+	q.push(id, false)
+}
+
+// Adds a scrimmage match to the back of the low priority queue
+func (q *MatchQueue) PushScrimmage(id int64) {
+	q.push(id, true)
+}
+
+func (q *MatchQueue) push(id int64, low bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if !q.queued[id] {
+		q.queued[id] = true
+		q.low[id] = low
+		q.enqueue(id)
+		q.cond.Broadcast()
+	}
+}
+
+// Appends a match to the queue for its priority, the caller holds the mutex
+func (q *MatchQueue) enqueue(id int64) {
+	if q.low[id] {
+		q.scrimmages = append(q.scrimmages, id)
+	} else {
+		q.pending = append(q.pending, id)
+	}
+}
+
+// The number of matches waiting for or being played by a worker
+func (q *MatchQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending) + len(q.scrimmages) + q.running
+}
+
+// Blocks until every queued match has been played and retried, or the queue is stopped
+func (q *MatchQueue) Wait() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !q.stopped && (len(q.pending) > 0 || len(q.scrimmages) > 0 || q.running > 0 || q.rescoring > 0 || q.retrying > 0) {
+		q.cond.Wait()
+	}
+}
+
+func (q *MatchQueue) next() (int64, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for !q.stopped && len(q.pending) == 0 && len(q.scrimmages) == 0 {
+		q.cond.Wait()
+	}
+	if q.stopped {
+		return 0, false
+	}
+	var id int64
+	if len(q.pending) > 0 {
+		id, q.pending = q.pending[0], q.pending[1:]
+	} else {
+		id, q.scrimmages = q.scrimmages[0], q.scrimmages[1:]
+	}
+	q.running++
+	return id, true
+}
+
+// Marks a match as played, returning the categories to rescore if the queue is now idle
+func (q *MatchQueue) finish(id int64, category TournamentCategory, retry bool) []TournamentCategory {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.queued, id)
+	q.running--
+	if retry {
+		q.retrying++
+	} else {
+		delete(q.low, id)
+	}
+	if category != "" {
+		q.dirty[category] = true
+	}
+	var categories []TournamentCategory
+	if len(q.pending) == 0 && len(q.scrimmages) == 0 && q.running == 0 {
+		for c := range q.dirty {
+			categories = append(categories, c)
+		}
+		q.dirty = map[TournamentCategory]bool{}
+		if len(categories) > 0 {
+			q.rescoring++
+		}
+	}
+	q.cond.Broadcast()
+	return categories
+}
+
+func (q *MatchQueue) rescore(categories []TournamentCategory) {
+	for _, category := range categories {
+		if err := q.tournament.CalculateLeaderboard(category); err != nil {
+			log.Println(err)
+		}
+	}
+	q.mutex.Lock()
+	q.rescoring--
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+}
+
+func (q *MatchQueue) work() {
+	defer q.waitGroup.Done()
+	for {
+		if id, ok := q.next(); !ok {
+			return
+		} else {
+			category, err := q.tournament.runQueuedMatch(q.ctx, id, q.clock)
+			delay, retry := time.Duration(0), false
+			if err != nil {
+				log.Printf("Match %v failed: %v\n", id, err)
+				delay, retry = q.retryDelay(id, err)
+			}
+			if !retry && q.ctx.Err() == nil {
+				q.tournament.advanceMatchBrackets(id)
+				q.tournament.advanceMatchSwiss(id)
+			}
+			if categories := q.finish(id, category, retry); categories != nil {
+				q.rescore(categories)
+			}
+			if retry {
+				go q.retryAfter(id, delay)
+			}
+		}
+	}
+}
+
+// Puts a match which failed because of the arena back in progress, returning how long to wait
+// before playing it again. Matches are given up on after the policy's MaxAttempts, the failures are
+// counted from the match's attempts so they are kept when the server restarts.
+func (q *MatchQueue) retryDelay(id int64, err error) (time.Duration, bool) {
+	policy := q.tournament.Retry
+	if q.ctx.Err() != nil || !IsInfrastructureError(err) {
+		return 0, false
+	}
+	failures, err := q.tournament.Database.MatchFailures(id)
+	if err != nil {
+		log.Println(err)
+		return 0, false
+	}
+	// A match which was given up on and then rerun by an admin gets its attempts again
+	if policy.MaxAttempts > 0 {
+		failures = (failures-1)%policy.MaxAttempts + 1
+	}
+	if failures >= policy.MaxAttempts {
+		log.Printf("Match %v failed %v times, giving up\n", id, failures)
+		return 0, false
+	} else if err := q.tournament.Database.ResetMatch(id); err != nil {
+		log.Println(err)
+		return 0, false
+	}
+	return policy.Delay(failures), true
+}
+
+func (q *MatchQueue) retryAfter(id int64, delay time.Duration) {
+	select {
+	case <-q.ctx.Done():
+	case <-time.After(delay):
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.retrying--
+	if !q.stopped && !q.queued[id] {
+		q.queued[id] = true
+		q.enqueue(id)
+	}
+	q.cond.Broadcast()
+}
@@ -0,0 +1,250 @@
+package tournament
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// An estimate of a player's strength. Volatility is only used by Glicko-2.
+type Rating struct {
+	Value       float64
+	Uncertainty float64
+	Volatility  float64
+}
+
+// A player's rating after one of their matches
+type RatingPoint struct {
+	MatchId     int64
+	Time        time.Time
+	Rating      float64
+	Uncertainty float64
+}
+
+// A player's current rating and how it changed over their matches
+type PlayerRating struct {
+	Rating      float64
+	Uncertainty float64
+	History     []RatingPoint
+}
+
+// Folds match results into player ratings, one match at a time
+type RatingModel interface {
+	Initial() Rating
+	// The ratings of two players after a match, where score is 1 if a won, 0.5 for a tie and 0 if a lost
+	Update(a, b Rating, score float64) (Rating, Rating)
+}
+
+const DefaultRatingModel = "elo"
+
+// The rating models a category can choose
+var RatingModels = map[string]RatingModel{
+	"elo":       Elo{32},
+	"glicko2":   Glicko2{0.5},
+	"trueskill": TrueSkill{25.0 / 6, 25.0 / 300, 0.1},
+}
+
+func NewRatingModel(name string) (RatingModel, error) {
+	if model, ok := RatingModels[name]; ok {
+		return model, nil
+	}
+	return nil, fmt.Errorf("Unknown rating model %v", name)
+}
+
+// The rating model of a category, Elo unless the category has chosen another
+func (t *Tournament) RatingModel(category TournamentCategory) (string, RatingModel) {
+	if name, ok := t.RatingModels[category]; ok {
+		if model, ok := RatingModels[name]; ok {
+			return name, model
+		}
+	}
+	return DefaultRatingModel, RatingModels[DefaultRatingModel]
+}
+
+// The score of player 1 in a finished match, false for matches which were not decided
+func ratingScore(result MatchResult) (float64, bool) {
+	switch result {
+	case MatchResultWinA:
+		return 1, true
+	case MatchResultWinB:
+		return 0, true
+	case MatchResultTieA, MatchResultTieB:
+		return 0.5, true
+	default:
+		return 0, false
+	}
+}
+
+// Rates every player from their matches in the order they finished
+func calculateRatings(model RatingModel, matches []Match) (map[string]Rating, map[string][]RatingPoint) {
+	sorted := append([]Match{}, matches...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Time.Equal(sorted[j].Time) {
+			return sorted[i].Time.Before(sorted[j].Time)
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+	ratings := map[string]Rating{}
+	history := map[string][]RatingPoint{}
+	rating := func(name string) Rating {
+		if r, ok := ratings[name]; ok {
+			return r
+		}
+		return model.Initial()
+	}
+	for _, match := range sorted {
+		if score, ok := ratingScore(match.Result); ok && match.Player1 != match.Player2 {
+			a, b := model.Update(rating(match.Player1), rating(match.Player2), score)
+			ratings[match.Player1] = a
+			ratings[match.Player2] = b
+			history[match.Player1] = append(history[match.Player1], RatingPoint{match.Id, match.Time, a.Value, a.Uncertainty})
+			history[match.Player2] = append(history[match.Player2], RatingPoint{match.Id, match.Time, b.Value, b.Uncertainty})
+		}
+	}
+	return ratings, history
+}
+
+// Elo with a fixed K factor, which has no measure of uncertainty
+type Elo struct {
+	K float64
+}
+
+func (e Elo) Initial() Rating {
+	return Rating{1500, 0, 0}
+}
+
+func (e Elo) Update(a, b Rating, score float64) (Rating, Rating) {
+	expected := 1 / (1 + math.Pow(10, (b.Value-a.Value)/400))
+	change := e.K * (score - expected)
+	a.Value += change
+	b.Value -= change
+	return a, b
+}
+
+// Glicko-2 where every match is its own rating period. Tau constrains how quickly volatility changes.
+type Glicko2 struct {
+	Tau float64
+}
+
+// The ratio between the Glicko and Glicko-2 scales
+const glickoScale = 173.7178
+
+func (g Glicko2) Initial() Rating {
+	return Rating{1500, 350, 0.06}
+}
+
+func (g Glicko2) Update(a, b Rating, score float64) (Rating, Rating) {
+	return g.update(a, b, score), g.update(b, a, 1-score)
+}
+
+func (g Glicko2) update(player, opponent Rating, score float64) Rating {
+	mu, phi := (player.Value-1500)/glickoScale, player.Uncertainty/glickoScale
+	muJ, phiJ := (opponent.Value-1500)/glickoScale, opponent.Uncertainty/glickoScale
+	gJ := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+	expected := 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+	v := 1 / (gJ * gJ * expected * (1 - expected))
+	delta := v * gJ * (score - expected)
+	sigma := g.volatility(phi, player.Volatility, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * gJ * (score - expected)
+	return Rating{mu*glickoScale + 1500, phi * glickoScale, sigma}
+}
+
+// Solves for the new volatility with the Illinois algorithm
+func (g Glicko2) volatility(phi, sigma, v, delta float64) float64 {
+	const epsilon = 0.000001
+	alpha := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-alpha)/(g.Tau*g.Tau)
+	}
+	lower, upper := alpha, 0.0
+	if delta*delta > phi*phi+v {
+		upper = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(alpha-k*g.Tau) < 0 {
+			k++
+		}
+		upper = alpha - k*g.Tau
+	}
+	fLower, fUpper := f(lower), f(upper)
+	for math.Abs(upper-lower) > epsilon {
+		c := lower + (lower-upper)*fLower/(fUpper-fLower)
+		fC := f(c)
+		if fC*fUpper <= 0 {
+			lower, fLower = upper, fUpper
+		} else {
+			fLower /= 2
+		}
+		upper, fUpper = c, fC
+	}
+	return math.Exp(lower / 2)
+}
+
+// A two player TrueSkill, where Beta is the performance spread, Tau the drift added before
+// each match and DrawProbability the chance that two equal players tie
+type TrueSkill struct {
+	Beta            float64
+	Tau             float64
+	DrawProbability float64
+}
+
+func (s TrueSkill) Initial() Rating {
+	return Rating{25, 25.0 / 3, 0}
+}
+
+func (s TrueSkill) Update(a, b Rating, score float64) (Rating, Rating) {
+	if score < 0.5 {
+		b, a = s.Update(b, a, 1-score)
+		return a, b
+	}
+	varA := a.Uncertainty*a.Uncertainty + s.Tau*s.Tau
+	varB := b.Uncertainty*b.Uncertainty + s.Tau*s.Tau
+	c := math.Sqrt(2*s.Beta*s.Beta + varA + varB)
+	margin := normalQuantile((s.DrawProbability+1)/2) * math.Sqrt2 * s.Beta / c
+	t := (a.Value - b.Value) / c
+	v, w := winFactors(t, margin)
+	if score == 0.5 {
+		v, w = drawFactors(t, margin)
+	}
+	a.Value += varA / c * v
+	b.Value -= varB / c * v
+	a.Uncertainty = math.Sqrt(varA * (1 - varA/(c*c)*w))
+	b.Uncertainty = math.Sqrt(varB * (1 - varB/(c*c)*w))
+	return a, b
+}
+
+func normalPdf(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+func normalCdf(x float64) float64 {
+	return (1 + math.Erf(x/math.Sqrt2)) / 2
+}
+
+func normalQuantile(p float64) float64 {
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+func winFactors(t, margin float64) (float64, float64) {
+	denominator := normalCdf(t - margin)
+	if denominator < 1e-12 {
+		return margin - t, 1
+	}
+	v := normalPdf(t-margin) / denominator
+	return v, v * (v + t - margin)
+}
+
+func drawFactors(t, margin float64) (float64, float64) {
+	denominator := normalCdf(margin-t) - normalCdf(-margin-t)
+	if denominator < 1e-12 {
+		return 0, 1
+	}
+	v := (normalPdf(-margin-t) - normalPdf(margin-t)) / denominator
+	w := v*v + ((margin-t)*normalPdf(margin-t)+(margin+t)*normalPdf(margin+t))/denominator
+	return v, w
+}
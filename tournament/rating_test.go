@@ -0,0 +1,51 @@
+package tournament
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRatingModels(test *testing.T) {
+	t := (*testutil.T)(test)
+	for name, model := range RatingModels {
+		initial := model.Initial()
+		if a, b := model.Update(initial, initial, 1); a.Value <= initial.Value || b.Value >= initial.Value {
+			t.Errorf("%v: expected the winner to gain and the loser to lose, not %v %v", name, a, b)
+		} else if b2, a2 := model.Update(initial, initial, 0); math.Abs(a2.Value-a.Value) > 1e-9 || math.Abs(b2.Value-b.Value) > 1e-9 {
+			t.Errorf("%v: expected a loss to mirror a win, not %v %v", name, a2, b2)
+		} else if a.Uncertainty > initial.Uncertainty {
+			t.Errorf("%v: expected uncertainty to shrink, not %v", name, a.Uncertainty)
+		}
+		if a, b := model.Update(initial, initial, 0.5); math.Abs(a.Value-initial.Value) > 1e-9 || math.Abs(b.Value-initial.Value) > 1e-9 {
+			t.Errorf("%v: expected a tie between equal players to keep their ratings, not %v %v", name, a, b)
+		}
+		strong, weak := model.Initial(), model.Initial()
+		for i := 0; i < 5; i++ {
+			strong, weak = model.Update(strong, weak, 1)
+		}
+		if upset, _ := model.Update(weak, strong, 1); upset.Value-weak.Value <= 0 {
+			t.Errorf("%v: expected an upset to raise the weaker rating", name)
+		} else if expected, _ := model.Update(strong, weak, 1); expected.Value-strong.Value >= upset.Value-weak.Value {
+			t.Errorf("%v: expected an upset to move ratings more than an expected win", name)
+		}
+	}
+}
+
+func TestCalculateRatingsChronological(test *testing.T) {
+	t := (*testutil.T)(test)
+	now := time.Now()
+	matches := []Match{
+		{2, "a", "b", "", "", "map", "", MatchResultWinB, now.Add(time.Hour), 0},
+		{1, "a", "b", "", "", "map", "", MatchResultWinA, now, 0},
+		{3, "a", "a", "", "", "map", "", MatchResultWinA, now, 0},
+		{4, "a", "b", "", "", "map", "", MatchResultError, now, 0},
+	}
+	ratings, history := calculateRatings(Elo{32}, matches)
+	if len(history["a"]) != 2 || history["a"][0].MatchId != 1 || history["a"][1].MatchId != 2 {
+		t.ErrorNow("expected the matches in the order they finished", history["a"])
+	} else if ratings["b"].Value <= 1500 {
+		t.ErrorNow("expected the later win to leave b ahead", ratings)
+	}
+}
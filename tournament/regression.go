@@ -0,0 +1,101 @@
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How a candidate commit of a player did against a baseline commit of the same player.
+// Records are from the candidate's point of view, Pending counts the matches still to be played.
+type Regression struct {
+	Category  TournamentCategory   `json:"category"`
+	Name      string               `json:"name"`
+	Baseline  string               `json:"baseline"`
+	Candidate string               `json:"candidate"`
+	Maps      map[string]MapRecord `json:"maps"`
+	Total     MapRecord            `json:"total"`
+	Pending   int                  `json:"pending"`
+}
+
+// Queues self-play matches between two accepted commits of a player, with each commit playing both sides
+// of every given map, or of every map of the category. The matches are played as a scrimmage of the player
+// against themselves, so they are unranked and count towards the player's scrimmage quota.
+func (t *Tournament) RequestRegression(name string, category TournamentCategory, baseline, candidate string, maps []string, created time.Time) (int64, error) {
+	if t.Queue == nil {
+		return 0, errors.New("Match queue is not running")
+	} else if baseline == candidate {
+		return 0, errors.New("A regression needs two different commits")
+	}
+	for _, commit := range []string{baseline, candidate} {
+		if status, err := t.GetCommitStatus(name, category, commit); err != nil {
+			return 0, fmt.Errorf("Unknown commit %v", commit)
+		} else if status.Status != SubmissionAccepted {
+			return 0, fmt.Errorf("Commit %v was not accepted", commit)
+		}
+	}
+	maps, err := t.eventMaps(category, maps)
+	if err != nil {
+		return 0, err
+	} else if len(maps) == 0 {
+		return 0, errors.New("A regression needs at least one map")
+	}
+	players := [2]Submission{{name, candidate}, {name, baseline}}
+	var id int64
+	var matchIds []int64
+	if err := t.Database.TransactionBlock(func(tx Statements) error {
+		var err error
+		if err = t.checkScrimmageQuota(tx, name, category, 2*len(maps), created); err != nil {
+			return err
+		} else if id, err = tx.CreateScrimmage(Scrimmage{0, category, name, name, created, nil}); err != nil {
+			return err
+		}
+		for _, mapName := range maps {
+			for side := 0; side < 2; side++ {
+				if matchId, err := tx.CreateScrimmageMatch(id, category, mapName, players[side], players[1-side], created); err != nil {
+					return err
+				} else {
+					matchIds = append(matchIds, matchId)
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for _, matchId := range matchIds {
+		t.Queue.PushScrimmage(matchId)
+	}
+	return id, nil
+}
+
+// The candidate's record against the baseline on each map from every self-play match between the two commits
+func (t *Tournament) Regression(name string, category TournamentCategory, baseline, candidate string) (Regression, error) {
+	regression := Regression{category, name, baseline, candidate, map[string]MapRecord{}, MapRecord{}, 0}
+	if matches, err := t.Database.ListSelfPlayMatches(name, category); err != nil {
+		return regression, err
+	} else {
+		for _, match := range matches {
+			var candidateSide bool
+			if match.Commit1 == candidate && match.Commit2 == baseline {
+				candidateSide = true
+			} else if match.Commit1 != baseline || match.Commit2 != candidate {
+				continue
+			}
+			if match.Result == MatchResultInProgress {
+				regression.Pending++
+				continue
+			}
+			record := regression.Maps[match.Map]
+			record.add(match.Result, candidateSide)
+			regression.Maps[match.Map] = record
+			regression.Total.add(match.Result, candidateSide)
+		}
+		for mapName, record := range regression.Maps {
+			record.WinRate = winRate(record.Record)
+			regression.Maps[mapName] = record
+		}
+		regression.Total.WinRate = winRate(regression.Total.Record)
+		return regression, nil
+	}
+}
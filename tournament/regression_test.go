@@ -0,0 +1,54 @@
+package tournament
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"testing"
+	"time"
+)
+
+func TestRegression(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = upsetArena{tm.Arena, map[string]bool{"a1 a2": true}}
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		tm.ScrimmageQuota = 4
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.CreateMap("Map2", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "a1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "a2", time.Now()))
+		if _, err := tm.RequestRegression("Name1", CategoryTest, "a1", "a1", nil, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for a regression against the same commit")
+		} else if _, err := tm.RequestRegression("Name1", CategoryTest, "a1", "a3", nil, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for an unknown commit")
+		}
+
+		id, err := tm.RequestRegression("Name1", CategoryTest, "a1", "a2", nil, time.Now())
+		t.CheckError(err)
+		tm.Queue.Wait()
+		if scrimmage, err := tm.GetScrimmage(id); err != nil {
+			t.ErrorNow(err)
+		} else if len(scrimmage.Games) != 4 {
+			t.ErrorNow("Expected each commit to play both sides of each map", scrimmage)
+		}
+		if regression, err := tm.Regression("Name1", CategoryTest, "a1", "a2"); err != nil {
+			t.ErrorNow(err)
+		} else if regression.Total.Wins != 4 || regression.Total.WinRate != 1 || regression.Pending != 0 {
+			t.ErrorNow("Expected the candidate to win every match", regression)
+		} else if record := regression.Maps["Map2"]; record.Wins != 2 || record.Losses != 0 {
+			t.ErrorNow("Expected the candidate to win on both sides of Map2", regression)
+		}
+		if regression, err := tm.Regression("Name1", CategoryTest, "a2", "a1"); err != nil {
+			t.ErrorNow(err)
+		} else if regression.Total.Losses != 4 || regression.Total.WinRate != 0 {
+			t.ErrorNow("Expected the baseline to lose every match", regression)
+		}
+		if matches, err := tm.ListMatches(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(matches) != 0 {
+			t.ErrorNow("Expected self-play matches not to be ranked", matches)
+		}
+		if _, err := tm.RequestRegression("Name1", CategoryTest, "a1", "a2", []string{"Map1"}, time.Now()); err == nil {
+			t.ErrorNow("Expected the quota to be exceeded")
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package tournament
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// The tiebreakers which can order players with equal points, applied in the order a category lists them
+const (
+	TiebreakHeadToHead         = "head_to_head"
+	TiebreakStrengthOfSchedule = "strength_of_schedule"
+	TiebreakTotalWins          = "total_wins"
+)
+
+// The first ranking step, which orders every player by their points
+const RankByPoints = "points"
+
+// How a category or phase scores matches and orders players with equal points.
+// A tiebreak win is a tied match the engine awarded to one team, the other team scores a tie.
+type ScoringRules struct {
+	Victory     float64  `json:"victory"`
+	TiebreakWin float64  `json:"tiebreak_win"`
+	Tie         float64  `json:"tie"`
+	Loss        float64  `json:"loss"`
+	Tiebreakers []string `json:"tiebreakers"`
+}
+
+var DefaultScoringRules = ScoringRules{3, 0, 0, -1, []string{}}
+
+func (r ScoringRules) Validate() error {
+	seen := map[string]bool{}
+	for _, tiebreaker := range r.Tiebreakers {
+		switch tiebreaker {
+		case TiebreakHeadToHead, TiebreakStrengthOfSchedule, TiebreakTotalWins:
+		default:
+			return fmt.Errorf("Unknown tiebreaker %v", tiebreaker)
+		}
+		if seen[tiebreaker] {
+			return fmt.Errorf("Tiebreaker %v is listed twice", tiebreaker)
+		}
+		seen[tiebreaker] = true
+	}
+	return nil
+}
+
+// The scoring rules of a category, the defaults unless the category has its own
+func (t *Tournament) ScoringRules(category TournamentCategory) ScoringRules {
+	if rules, ok := t.Scoring[category]; ok {
+		return rules
+	}
+	return DefaultScoringRules
+}
+
+// The points a player earned from a finished match
+func (r ScoringRules) points(result MatchResult, player1 bool) float64 {
+	switch result {
+	case MatchResultWinA, MatchResultWinB:
+		if (result == MatchResultWinA) == player1 {
+			return r.Victory
+		}
+		return r.Loss
+	case MatchResultTieA, MatchResultTieB:
+		if (result == MatchResultTieA) == player1 {
+			return r.TiebreakWin
+		}
+		return r.Tie
+	default:
+		return 0
+	}
+}
+
+// One step in ordering a leaderboard, a rule applied to a group of players who were level before it
+// with each player's value under the rule
+type RankingStep struct {
+	Rule    string             `json:"rule"`
+	Players []string           `json:"players"`
+	Values  map[string]float64 `json:"values"`
+}
+
+// The order of a leaderboard with the steps which produced it. Players left level by every tiebreaker share a rank.
+type Ranking struct {
+	Rules ScoringRules   `json:"rules"`
+	Order []string       `json:"order"`
+	Ranks map[string]int `json:"ranks"`
+	Steps []RankingStep  `json:"steps"`
+}
+
+// Orders players by points, then splits each group of level players by the tiebreakers in turn.
+// Head-to-head counts the points a player earned against the rest of their group, strength of schedule
+// sums the points of the opponent of each match, and total wins counts the matches a player won.
+func rankPlayers(rules ScoringRules, stats map[string]LeaderboardStats, matches []Match) Ranking {
+	ranking := Ranking{rules, []string{}, map[string]int{}, []RankingStep{}}
+	points := map[string]map[string]float64{}
+	schedule := map[string]float64{}
+	for name := range stats {
+		points[name] = map[string]float64{}
+	}
+	for _, match := range matches {
+		if _, ok := stats[match.Player1]; !ok {
+			continue
+		} else if _, ok := stats[match.Player2]; !ok {
+			continue
+		}
+		points[match.Player1][match.Player2] += rules.points(match.Result, true)
+		points[match.Player2][match.Player1] += rules.points(match.Result, false)
+		schedule[match.Player1] += stats[match.Player2].Score
+		schedule[match.Player2] += stats[match.Player1].Score
+	}
+	values := map[string]func(name string, group []string) float64{
+		RankByPoints: func(name string, group []string) float64 {
+			return stats[name].Score
+		},
+		TiebreakHeadToHead: func(name string, group []string) float64 {
+			total := 0.0
+			for _, opponent := range group {
+				total += points[name][opponent]
+			}
+			return total
+		},
+		TiebreakStrengthOfSchedule: func(name string, group []string) float64 {
+			return schedule[name]
+		},
+		TiebreakTotalWins: func(name string, group []string) float64 {
+			return float64(stats[name].Wins)
+		},
+	}
+
+	players := []string{}
+	for name := range stats {
+		players = append(players, name)
+	}
+	sort.Strings(players)
+	groups := [][]string{}
+	if len(players) > 0 {
+		groups = append(groups, players)
+	}
+	for _, rule := range append([]string{RankByPoints}, rules.Tiebreakers...) {
+		value, ok := values[rule]
+		if !ok {
+			continue
+		}
+		split := [][]string{}
+		for _, group := range groups {
+			if len(group) < 2 && rule != RankByPoints {
+				split = append(split, group)
+				continue
+			}
+			step := RankingStep{rule, group, map[string]float64{}}
+			for _, name := range group {
+				step.Values[name] = value(name, group)
+			}
+			ordered := append([]string{}, group...)
+			sort.SliceStable(ordered, func(i, j int) bool {
+				return step.Values[ordered[i]] > step.Values[ordered[j]]
+			})
+			for i, name := range ordered {
+				if i > 0 && step.Values[name] == step.Values[ordered[i-1]] {
+					split[len(split)-1] = append(split[len(split)-1], name)
+				} else {
+					split = append(split, []string{name})
+				}
+			}
+			ranking.Steps = append(ranking.Steps, step)
+		}
+		groups = split
+	}
+	for _, group := range groups {
+		rank := len(ranking.Order) + 1
+		for _, name := range group {
+			ranking.Order = append(ranking.Order, name)
+			ranking.Ranks[name] = rank
+		}
+	}
+	return ranking
+}
+
+// The ranking of a category's leaderboard as it was last calculated, so it agrees with the stored ranks and history.
+// A category whose leaderboard has not been calculated has an empty ranking.
+func (t *Tournament) LeaderboardRanking(category TournamentCategory) (Ranking, error) {
+	if ranking, err := t.Database.GetLeaderboardRanking(category); err == sql.ErrNoRows {
+		return Ranking{t.ScoringRules(category), []string{}, map[string]int{}, []RankingStep{}}, nil
+	} else {
+		return ranking, err
+	}
+}
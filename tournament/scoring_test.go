@@ -0,0 +1,98 @@
+package tournament
+
+import (
+	"context"
+	"github.com/GlenKelley/battleref/arena"
+	"github.com/GlenKelley/battleref/testing"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Ends every match in a tie which the engine awards to team A
+type tieArena struct {
+	arena.Arena
+}
+
+func (a tieArena) RunMatch(ctx context.Context, p arena.MatchProperties, clock func() time.Time) (time.Time, arena.MatchResult, error) {
+	finished, result, err := a.Arena.RunMatch(ctx, p, clock)
+	result.Reason = arena.ReasonTie
+	return finished, result, err
+}
+
+func TestTiebreakWinsAreScored(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = tieArena{tm.Arena}
+		tm.Scoring[CategoryTest] = ScoringRules{3, 2, 1, 0, []string{}}
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "a1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "b1", time.Now()))
+		t.CheckError(tm.RunLatestMatches(CategoryTest))
+		t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+		if ranks, _, err := tm.GetLeaderboard(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if stat := ranks["Name1"]; stat.Ties != 2 || stat.Score != 3 {
+			t.ErrorNow("Expected a tiebreak win and a tie", ranks)
+		}
+	})
+}
+
+func TestLeaderboardRankingAgreesWithHistory(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = upsetArena{tm.Arena, map[string]bool{"a1 b1": true}}
+		tm.Scoring[CategoryTest] = ScoringRules{3, 2, 1, 0, []string{TiebreakHeadToHead}}
+		if ranking, err := tm.LeaderboardRanking(CategoryTest); err != nil || len(ranking.Order) != 0 {
+			t.ErrorNow("Expected an empty ranking before the leaderboard is calculated", ranking, err)
+		}
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "a1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "b1", time.Now()))
+		t.CheckError(tm.RunLatestMatches(CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "b2", time.Now().Add(time.Second)))
+		t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+		if ranking, err := tm.LeaderboardRanking(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else {
+			for _, name := range []string{"Name1", "Name2"} {
+				if history, err := tm.LeaderboardHistory(CategoryTest, name); err != nil || len(history) != 1 {
+					t.ErrorNow("Expected a leaderboard snapshot", history, err)
+				} else if ranking.Ranks[name] != history[0].Rank || ranking.Ranks[name] != 1 {
+					t.ErrorNow("Expected the ranking to leave out the old commit's matches", ranking, history)
+				}
+			}
+		}
+	})
+}
+
+func TestRankPlayers(test *testing.T) {
+	t := (*testutil.T)(test)
+	stats := map[string]LeaderboardStats{
+		"Name1": {4, 2, 0, 2},
+		"Name2": {4, 2, 0, 2},
+		"Name3": {4, 1, 2, 1},
+		"Name4": {6, 2, 0, 0},
+	}
+	matches := []Match{
+		{Player1: "Name2", Player2: "Name1", Result: MatchResultWinA},
+		{Player1: "Name1", Player2: "Name3", Result: MatchResultWinA},
+		{Player1: "Name3", Player2: "Name2", Result: MatchResultWinA},
+	}
+	rules := ScoringRules{3, 1, 1, -1, []string{TiebreakTotalWins, TiebreakHeadToHead}}
+	ranking := rankPlayers(rules, stats, matches)
+	if expected := []string{"Name4", "Name2", "Name1", "Name3"}; !reflect.DeepEqual(ranking.Order, expected) {
+		t.ErrorNow("Expected total wins and then head-to-head to break the tie", ranking)
+	} else if len(ranking.Steps) != 3 || ranking.Steps[1].Rule != TiebreakTotalWins || ranking.Steps[2].Rule != TiebreakHeadToHead {
+		t.ErrorNow("Expected the points step and a step for each tiebreaker", ranking.Steps)
+	} else if players := ranking.Steps[2].Players; len(players) != 2 {
+		t.ErrorNow("Expected head-to-head to only order the players left level", players)
+	}
+
+	rules.Tiebreakers = []string{}
+	ranking = rankPlayers(rules, stats, matches)
+	if ranking.Ranks["Name1"] != 2 || ranking.Ranks["Name3"] != 2 {
+		t.ErrorNow("Expected players with equal points to share a rank", ranking.Ranks)
+	}
+	if err := (ScoringRules{Tiebreakers: []string{"coin_toss"}}).Validate(); err == nil {
+		t.ErrorNow("Expected an error for an unknown tiebreaker")
+	}
+}
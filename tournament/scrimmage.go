@@ -0,0 +1,124 @@
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// The number of scrimmage matches a player may request in a day, unless the tournament sets its own
+const DefaultScrimmageQuota = 20
+
+// An unranked set of matches a player requested against another player's latest submission.
+// The players swap sides each game, and the results are kept but never count towards the leaderboard.
+type Scrimmage struct {
+	Id        int64              `json:"id"`
+	Category  TournamentCategory `json:"category"`
+	Requester string             `json:"requester"`
+	Opponent  string             `json:"opponent"`
+	Created   time.Time          `json:"created"`
+	Games     []SeriesGame       `json:"games"`
+}
+
+// The number of scrimmage matches a player has requested in the day before a time
+func (t *Tournament) ScrimmageMatchesUsed(name string, category TournamentCategory, at time.Time) (int, error) {
+	return scrimmageMatchesUsed(t.Database, name, category, at)
+}
+
+// Checks a player's quota in the transaction which creates their scrimmage, so concurrent requests cannot exceed it
+func (t *Tournament) checkScrimmageQuota(tx Statements, name string, category TournamentCategory, matches int, at time.Time) error {
+	if used, err := scrimmageMatchesUsed(tx, name, category, at); err != nil {
+		return err
+	} else if used+matches > t.ScrimmageQuota {
+		return fmt.Errorf("Scrimmage quota exceeded, %v of %v matches used today", used, t.ScrimmageQuota)
+	}
+	return nil
+}
+
+func scrimmageMatchesUsed(tx Statements, name string, category TournamentCategory, at time.Time) (int, error) {
+	if scrimmages, err := tx.ListScrimmages(name, category); err != nil {
+		return 0, err
+	} else {
+		used := 0
+		since := at.Add(-24 * time.Hour)
+		for _, scrimmage := range scrimmages {
+			if scrimmage.Requester == name && scrimmage.Created.After(since) {
+				used += len(scrimmage.Games)
+			}
+		}
+		return used, nil
+	}
+}
+
+// Queues a scrimmage between the latest submissions of two players, played on the given maps
+// or on count maps of the category chosen at random. Scrimmages are played after any waiting ranked matches.
+func (t *Tournament) RequestScrimmage(requester, opponent string, category TournamentCategory, maps []string, count int, created time.Time) (int64, error) {
+	if t.Queue == nil {
+		return 0, errors.New("Match queue is not running")
+	} else if requester == opponent {
+		return 0, errors.New("A player cannot scrimmage against themselves")
+	}
+	if len(maps) == 0 {
+		if all, err := t.ListMaps(category); err != nil {
+			return 0, err
+		} else if count < 1 || count > len(all) {
+			return 0, fmt.Errorf("A scrimmage is played on between 1 and %v maps", len(all))
+		} else {
+			for _, i := range rand.Perm(len(all))[:count] {
+				maps = append(maps, all[i])
+			}
+		}
+	} else if _, err := t.eventMaps(category, maps); err != nil {
+		return 0, err
+	}
+	commits := map[string]string{}
+	if latestCommits, err := t.LatestCommits(category); err != nil {
+		return 0, err
+	} else {
+		for _, submission := range latestCommits {
+			commits[submission.Name] = submission.CommitHash
+		}
+	}
+	for _, name := range []string{requester, opponent} {
+		if commits[name] == "" {
+			return 0, fmt.Errorf("%v has no accepted submission in %v", name, category)
+		}
+	}
+	players := [2]Submission{{requester, commits[requester]}, {opponent, commits[opponent]}}
+	var id int64
+	var matchIds []int64
+	if err := t.Database.TransactionBlock(func(tx Statements) error {
+		var err error
+		if err = t.checkScrimmageQuota(tx, requester, category, len(maps), created); err != nil {
+			return err
+		} else if id, err = tx.CreateScrimmage(Scrimmage{0, category, requester, opponent, created, nil}); err != nil {
+			return err
+		}
+		for game, mapName := range maps {
+			if matchId, err := tx.CreateScrimmageMatch(id, category, mapName, players[game%2], players[1-game%2], created); err != nil {
+				return err
+			} else {
+				matchIds = append(matchIds, matchId)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	for _, matchId := range matchIds {
+		t.Queue.PushScrimmage(matchId)
+	}
+	return id, nil
+}
+
+func (t *Tournament) GetScrimmage(id int64) (Scrimmage, error) {
+	scrimmage, err := t.Database.GetScrimmage(id)
+	return scrimmage, err
+}
+
+// The scrimmages a player requested or was challenged to in a category
+func (t *Tournament) ListScrimmages(name string, category TournamentCategory) ([]Scrimmage, error) {
+	scrimmages, err := t.Database.ListScrimmages(name, category)
+	return scrimmages, err
+}
@@ -0,0 +1,116 @@
+package tournament
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScrimmageQueuePriority(test *testing.T) {
+	t := (*testutil.T)(test)
+	q := NewMatchQueue(nil, 1, SystemClock())
+	q.PushScrimmage(1)
+	q.Push(2)
+	q.PushScrimmage(3)
+	q.Push(4)
+	order := []int64{}
+	for i := 0; i < 4; i++ {
+		id, _ := q.next()
+		order = append(order, id)
+	}
+	if expected := []int64{2, 4, 1, 3}; !reflect.DeepEqual(order, expected) {
+		t.ErrorNow("Expected ranked matches before scrimmages", order)
+	}
+}
+
+func TestRequestScrimmage(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		tm.ScrimmageQuota = 3
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.CreateMap("Map2", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "a1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "b1", time.Now()))
+		if _, err := tm.RequestScrimmage("Name1", "Name1", CategoryTest, nil, 1, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for a scrimmage against yourself")
+		} else if _, err := tm.RequestScrimmage("Name1", "Name3", CategoryTest, nil, 1, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for an opponent without a submission")
+		} else if _, err := tm.RequestScrimmage("Name1", "Name2", CategoryTest, []string{"Map3"}, 0, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for an unknown map")
+		}
+
+		t.CheckError(tm.RunLatestMatches(CategoryTest))
+		id, err := tm.RequestScrimmage("Name1", "Name2", CategoryTest, []string{"Map1", "Map2"}, 0, time.Now())
+		t.CheckError(err)
+		tm.Queue.Wait()
+		if scrimmage, err := tm.GetScrimmage(id); err != nil {
+			t.ErrorNow(err)
+		} else if len(scrimmage.Games) != 2 || scrimmage.Games[0].Player1 != "Name1" || scrimmage.Games[1].Player1 != "Name2" {
+			t.ErrorNow("Expected the players to swap sides", scrimmage)
+		} else if scrimmage.Games[0].Result != MatchResultWinA || scrimmage.Games[1].Result != MatchResultWinA {
+			t.ErrorNow("Expected the scrimmage to be played", scrimmage)
+		}
+		if _, err := tm.RequestScrimmage("Name1", "Name2", CategoryTest, nil, 2, time.Now()); err == nil {
+			t.ErrorNow("Expected the quota to be exceeded")
+		} else if _, err := tm.RequestScrimmage("Name1", "Name2", CategoryTest, nil, 1, time.Now()); err != nil {
+			t.ErrorNow(err)
+		} else if _, err := tm.RequestScrimmage("Name1", "Name2", CategoryTest, nil, 1, time.Now().Add(25*time.Hour)); err != nil {
+			t.ErrorNow("Expected the quota to reset after a day", err)
+		} else if _, err := tm.RequestScrimmage("Name2", "Name1", CategoryTest, nil, 1, time.Now()); err != nil {
+			t.ErrorNow("Expected each player to have their own quota", err)
+		}
+		tm.Queue.Wait()
+
+		if matches, err := tm.ListMatches(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(matches) != 4 {
+			t.ErrorNow("Expected scrimmages to be separate from ranked matches", matches)
+		}
+		t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+		if ranks, _, err := tm.GetLeaderboard(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if ranks["Name1"].Wins != 2 || ranks["Name1"].Losses != 2 {
+			t.ErrorNow("Expected scrimmages not to count towards the leaderboard", ranks)
+		}
+		if scrimmages, err := tm.ListScrimmages("Name2", CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(scrimmages) != 4 || scrimmages[0].Requester != "Name2" {
+			t.ErrorNow("Expected every scrimmage of the player, newest first", scrimmages)
+		}
+	})
+}
+
+func TestScrimmageQuotaConcurrent(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		tm.ScrimmageQuota = 3
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "a1", time.Now()))
+		t.CheckError(tm.SubmitCommit("Name2", CategoryTest, "b1", time.Now()))
+		var waitGroup sync.WaitGroup
+		var mutex sync.Mutex
+		accepted := 0
+		for i := 0; i < 8; i++ {
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				if _, err := tm.RequestScrimmage("Name1", "Name2", CategoryTest, []string{"Map1"}, 0, time.Now()); err == nil {
+					mutex.Lock()
+					accepted++
+					mutex.Unlock()
+				}
+			}()
+		}
+		waitGroup.Wait()
+		tm.Queue.Wait()
+		if accepted != 3 {
+			t.ErrorNow("Expected concurrent requests to stay within the quota, accepted", accepted)
+		} else if used, err := tm.ScrimmageMatchesUsed("Name1", CategoryTest, time.Now()); err != nil || used != 3 {
+			t.ErrorNow("Expected the quota to be used", used, err)
+		}
+	})
+}
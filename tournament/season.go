@@ -0,0 +1,369 @@
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The formats a phase can be played in, besides the bracket formats
+const (
+	PhaseRoundRobin = "round_robin"
+	PhaseSwiss      = "swiss"
+)
+
+// A season is a sequence of phases, such as a qualifier, a seeding round and a final
+type Season struct {
+	Id      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Phases  []Phase   `json:"phases"`
+}
+
+// A stage of a season played in one category. Submissions to the category are frozen from Freeze until the
+// phase finishes, and the phase is played between the latest submission of each player when it is started.
+// EventId is the bracket or Swiss tournament the phase was played as, and is 0 for a round-robin.
+// The leaderboard is a snapshot taken when the phase finishes, after which its matches cannot be rerun.
+// It is scored with the phase's own rules, or with those of its category when Scoring is nil.
+type Phase struct {
+	Id          int64              `json:"id"`
+	SeasonId    int64              `json:"season_id"`
+	Name        string             `json:"name"`
+	Category    TournamentCategory `json:"category"`
+	Format      string             `json:"format"`
+	Maps        []string           `json:"maps"`
+	Pool        string             `json:"pool"`
+	Start       time.Time          `json:"start"`
+	Freeze      time.Time          `json:"freeze"`
+	Players     []Submission       `json:"players"`
+	Scoring     *ScoringRules      `json:"scoring"`
+	EventId     int64              `json:"event_id"`
+	Started     bool               `json:"started"`
+	Finished    bool               `json:"finished"`
+	Leaderboard []PhaseStanding    `json:"leaderboard"`
+}
+
+// A player's place on the leaderboard of a finished phase
+type PhaseStanding struct {
+	Rank       int     `json:"rank"`
+	Name       string  `json:"name"`
+	CommitHash string  `json:"commit_hash"`
+	Score      float64 `json:"score"`
+	Wins       int     `json:"wins"`
+	Ties       int     `json:"ties"`
+	Losses     int     `json:"losses"`
+}
+
+// Whether submissions to the phase's category are frozen at a time
+func (p Phase) Frozen(at time.Time) bool {
+	return !p.Finished && !at.Before(p.Freeze)
+}
+
+func (t *Tournament) CreateSeason(name string, created time.Time) (int64, error) {
+	id, err := t.Database.CreateSeason(Season{0, name, created, nil})
+	return id, err
+}
+
+// A season with each of its phases in order
+func (t *Tournament) GetSeason(id int64) (Season, error) {
+	season, err := t.Database.GetSeason(id)
+	return season, err
+}
+
+// Every season without its phases
+func (t *Tournament) ListSeasons() ([]Season, error) {
+	seasons, err := t.Database.ListSeasons()
+	return seasons, err
+}
+
+func (t *Tournament) GetPhase(id int64) (Phase, error) {
+	phase, err := t.Database.GetPhase(id)
+	return phase, err
+}
+
+// Adds a phase to a season. The phase is played on the maps of a pool as they are when it starts,
+// or on every map of its category when neither maps nor a pool are given, and may not overlap another
+// phase of the same category.
+func (t *Tournament) AddPhase(seasonId int64, name string, category TournamentCategory, format string, maps []string, pool string, start, freeze time.Time, scoring *ScoringRules) (int64, error) {
+	if format != PhaseRoundRobin && format != PhaseSwiss && format != BracketSingleElimination && format != BracketDoubleElimination {
+		return 0, fmt.Errorf("Unknown phase format %v", format)
+	} else if freeze.Before(start) {
+		return 0, errors.New("A phase cannot freeze before it starts")
+	} else if len(maps) > 0 && pool != "" {
+		return 0, errors.New("A phase is played on either its maps or a map pool, not both")
+	} else if _, err := t.GetSeason(seasonId); err != nil {
+		return 0, err
+	}
+	if scoring != nil {
+		if err := scoring.Validate(); err != nil {
+			return 0, err
+		}
+	}
+	var err error
+	if pool != "" {
+		maps, err = t.PoolMaps(category, pool)
+	} else {
+		maps, err = t.eventMaps(category, maps)
+	}
+	if err != nil {
+		return 0, err
+	} else if len(maps) == 0 {
+		return 0, errors.New("A phase needs at least one map")
+	}
+	if phases, err := t.Database.ListCategoryPhases(category); err != nil {
+		return 0, err
+	} else {
+		for _, other := range phases {
+			if !start.After(other.Freeze) && !other.Start.After(freeze) {
+				return 0, fmt.Errorf("Phase %v overlaps phase %v", name, other.Name)
+			}
+		}
+	}
+	id, err := t.Database.CreatePhase(Phase{0, seasonId, name, category, format, maps, pool, start, freeze, nil, scoring, 0, false, false, nil})
+	return id, err
+}
+
+// Creates maps in a phase's category and adds them to its maps, and to its map pool if it has one,
+// before the phase starts
+func (t *Tournament) AddPhaseMaps(id int64, maps map[string]string) error {
+	names := []string{}
+	for name := range maps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return t.Database.TransactionBlock(func(tx Statements) error {
+		if phase, err := tx.GetPhase(id); err != nil {
+			return err
+		} else if phase.Started {
+			return fmt.Errorf("Phase %v has already started", phase.Name)
+		} else {
+			for _, name := range names {
+				if err := tx.CreateMap(name, maps[name], phase.Category); err != nil {
+					return fmt.Errorf("Unable to create map %v: %v", name, err)
+				}
+			}
+			if phase.Pool != "" {
+				if pool, err := tx.GetMapPool(phase.Pool, phase.Category); err != nil {
+					return err
+				} else if err := tx.SetMapPool(MapPool{pool.Name, pool.Category, append(pool.Maps, names...), pool.Created}); err != nil {
+					return err
+				}
+			}
+			return tx.SetPhaseMaps(id, append(phase.Maps, names...))
+		}
+	})
+}
+
+// The phase which freezes submissions to a category at a time, if there is one
+func (t *Tournament) frozenPhase(category TournamentCategory, at time.Time) (Phase, bool, error) {
+	if phases, err := t.Database.ListCategoryPhases(category); err != nil {
+		return Phase{}, false, err
+	} else {
+		for _, phase := range phases {
+			if phase.Frozen(at) {
+				return phase, true, nil
+			}
+		}
+		return Phase{}, false, nil
+	}
+}
+
+// Plays a phase between the latest submission of each player once its submissions are frozen
+func (t *Tournament) StartPhase(id int64, now time.Time) error {
+	if t.Queue == nil {
+		return errors.New("Match queue is not running")
+	}
+	phase, err := t.GetPhase(id)
+	if err != nil {
+		return err
+	} else if phase.Started {
+		return fmt.Errorf("Phase %v has already started", phase.Name)
+	} else if now.Before(phase.Freeze) {
+		return fmt.Errorf("Phase %v cannot start until submissions freeze at %v", phase.Name, phase.Freeze)
+	}
+	if phase.Pool != "" {
+		if phase.Maps, err = t.PoolMaps(phase.Category, phase.Pool); err != nil {
+			return err
+		} else if len(phase.Maps) == 0 {
+			return fmt.Errorf("Map pool %v has no maps", phase.Pool)
+		} else if err := t.Database.SetPhaseMaps(id, phase.Maps); err != nil {
+			return err
+		}
+	}
+	players, err := t.Seeds(phase.Category)
+	if err != nil {
+		return err
+	}
+	var eventId int64
+	switch phase.Format {
+	case PhaseRoundRobin:
+		if plan, err := t.planMatches(phase.Category, players, phase.Maps); err != nil {
+			return err
+		} else {
+			t.EnqueuePlan(plan)
+		}
+	case PhaseSwiss:
+		eventId, err = t.CreateSwiss(phase.Name, phase.Category, 0, phase.Maps, now)
+	default:
+		eventId, err = t.CreateBracket(phase.Name, phase.Category, phase.Format, 1, phase.Maps, 0, now)
+	}
+	if err != nil {
+		return err
+	}
+	return t.Database.StartPhase(id, players, eventId)
+}
+
+// Finishes a phase once all of its matches have been played, keeping a snapshot of its leaderboard.
+// A round-robin is ranked by the phase's scoring rules, a Swiss phase by its standings and a bracket by placement.
+// Submissions to the category are accepted again.
+func (t *Tournament) FinishPhase(id int64) error {
+	phase, err := t.GetPhase(id)
+	if err != nil {
+		return err
+	} else if !phase.Started {
+		return fmt.Errorf("Phase %v has not started", phase.Name)
+	} else if phase.Finished {
+		return fmt.Errorf("Phase %v has already finished", phase.Name)
+	}
+	var standings []PhaseStanding
+	var matchIds []int64
+	switch phase.Format {
+	case PhaseRoundRobin:
+		if plan, err := t.planMatches(phase.Category, phase.Players, phase.Maps); err != nil {
+			return err
+		} else if left := len(plan.Matches) + plan.Queued; left > 0 {
+			return fmt.Errorf("Phase %v has %v matches left to play", phase.Name, left)
+		} else if matches, err := t.ListMatches(phase.Category); err != nil {
+			return err
+		} else if versions, err := t.Database.MapVersions(phase.Category); err != nil {
+			return err
+		} else {
+			rules := t.ScoringRules(phase.Category)
+			if phase.Scoring != nil {
+				rules = *phase.Scoring
+			}
+			standings, matchIds = phaseStandings(phase, matches, versions, rules)
+		}
+	case PhaseSwiss:
+		if swiss, err := t.GetSwiss(phase.EventId); err != nil {
+			return err
+		} else if !swiss.Finished {
+			return fmt.Errorf("Phase %v has not finished its Swiss rounds", phase.Name)
+		} else {
+			standings, matchIds = swissPhaseStandings(swiss)
+		}
+	default:
+		if bracket, err := t.GetBracket(phase.EventId); err != nil {
+			return err
+		} else if bracket.Champion == "" {
+			return fmt.Errorf("Phase %v has not finished its bracket", phase.Name)
+		} else {
+			standings, matchIds = bracketPhaseStandings(bracket)
+		}
+	}
+	return t.Database.TransactionBlock(func(tx Statements) error {
+		return tx.FinishPhase(id, standings, matchIds)
+	})
+}
+
+// The leaderboard of a round-robin phase from the matches between its players on the latest versions of its maps,
+// with the ids of those matches
+func phaseStandings(phase Phase, matches []Match, versions map[string]int, rules ScoringRules) ([]PhaseStanding, []int64) {
+	matchLookup := map[string]map[string]map[string]Match{}
+	for _, match := range matches {
+		lookupInsert(matchLookup, match)
+	}
+	stats := map[string]*LeaderboardStats{}
+	for _, player := range phase.Players {
+		stats[player.Name] = &LeaderboardStats{}
+	}
+	counted := tallyMatches(rules, stats, phase.Players, phase.Maps, versions, matchLookup)
+	matchIds := []int64{}
+	for _, match := range counted {
+		matchIds = append(matchIds, match.Id)
+	}
+	stats2 := map[string]LeaderboardStats{}
+	commits := map[string]string{}
+	for _, player := range phase.Players {
+		stats2[player.Name] = *stats[player.Name]
+		commits[player.Name] = player.CommitHash
+	}
+	ranking := rankPlayers(rules, stats2, counted)
+	standings := []PhaseStanding{}
+	for _, name := range ranking.Order {
+		stat := stats2[name]
+		standings = append(standings, PhaseStanding{ranking.Ranks[name], name, commits[name], stat.Score, stat.Wins, stat.Ties, stat.Losses})
+	}
+	return standings, matchIds
+}
+
+// The leaderboard of a Swiss phase in the order of its standings, with the ids of the matches it played
+func swissPhaseStandings(swiss SwissTournament) ([]PhaseStanding, []int64) {
+	commits := map[string]string{}
+	for _, player := range swiss.Players {
+		commits[player.Name] = player.CommitHash
+	}
+	standings := []PhaseStanding{}
+	for i, standing := range swiss.Standings() {
+		standings = append(standings, PhaseStanding{i + 1, standing.Name, commits[standing.Name], standing.Points, standing.Wins, standing.Draws, standing.Losses})
+	}
+	matchIds := []int64{}
+	for _, pairing := range swiss.Pairings {
+		for _, game := range pairing.Games {
+			matchIds = append(matchIds, game.MatchId)
+		}
+	}
+	return standings, matchIds
+}
+
+// The leaderboard of a bracket phase by placement, with the ids of the matches it played. Players knocked out
+// in the same round share a place behind everyone who lasted longer. Score, wins and losses count games.
+func bracketPhaseStandings(bracket Bracket) ([]PhaseStanding, []int64) {
+	wins, losses := map[string]int{}, map[string]int{}
+	matchIds := []int64{}
+	for _, series := range bracket.Series {
+		for i, player := range series.Players {
+			wins[player.Name] += series.Wins[i]
+			losses[player.Name] += series.Wins[1-i]
+		}
+		for _, game := range series.Games {
+			matchIds = append(matchIds, game.MatchId)
+		}
+	}
+	commits := map[string]string{}
+	for _, seed := range bracket.Seeds {
+		commits[seed.Name] = seed.CommitHash
+	}
+	standing := func(rank int, name string) PhaseStanding {
+		return PhaseStanding{rank, name, commits[name], float64(wins[name]), wins[name], 0, losses[name]}
+	}
+	// Series are laid out in the order they are played, so the later rounds are found first
+	standings := []PhaseStanding{standing(1, bracket.Champion)}
+	for i := len(bracket.Series) - 1; i >= 0; {
+		rank := len(standings) + 1
+		side, round := bracket.Series[i].Side, bracket.Series[i].Round
+		for ; i >= 0 && bracket.Series[i].Side == side && bracket.Series[i].Round == round; i-- {
+			if loser, ok := knockedOut(bracket.Series[i]); ok {
+				standings = append(standings, standing(rank, loser))
+			}
+		}
+	}
+	return standings, matchIds
+}
+
+// The player who left the bracket by losing a series. The loser of a final won by the player
+// from the losers bracket plays the reset final instead.
+func knockedOut(series BracketSeries) (string, bool) {
+	if !series.Done || series.Players[0].Name == "" || series.Players[1].Name == "" {
+		return "", false
+	}
+	loser := series.Players[0].Name
+	if series.Winner == loser {
+		loser = series.Players[1].Name
+	}
+	if series.Side == BracketFinal {
+		return loser, series.Winner == series.Players[0].Name
+	}
+	return loser, series.NextLoser < 0
+}
@@ -0,0 +1,191 @@
+package tournament
+
+import (
+	"fmt"
+	"github.com/GlenKelley/battleref/testing"
+	"testing"
+	"time"
+)
+
+func TestSeasonPhases(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		start := time.Now().Add(-time.Hour)
+		freeze := start.Add(30 * time.Minute)
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		for i := 1; i <= 3; i++ {
+			t.CheckError(tm.SubmitCommit(fmt.Sprintf("Name%v", i), CategoryTest, fmt.Sprintf("c%v", i), start))
+		}
+		seasonId, err := tm.CreateSeason("Season", start)
+		t.CheckError(err)
+		if _, err := tm.AddPhase(seasonId, "Qualifier", CategoryTest, "league", nil, "", start, freeze, nil); err == nil {
+			t.ErrorNow("Expected an error for an unknown format")
+		} else if _, err := tm.AddPhase(seasonId, "Qualifier", CategoryTest, PhaseRoundRobin, nil, "", freeze, start, nil); err == nil {
+			t.ErrorNow("Expected an error for a phase which freezes before it starts")
+		}
+		id, err := tm.AddPhase(seasonId, "Qualifier", CategoryTest, PhaseRoundRobin, nil, "", start, freeze, nil)
+		t.CheckError(err)
+		if _, err := tm.AddPhase(seasonId, "Overlap", CategoryTest, PhaseRoundRobin, nil, "", start.Add(time.Minute), freeze.Add(time.Minute), nil); err == nil {
+			t.ErrorNow("Expected an error for overlapping phases")
+		}
+
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "c1b", freeze.Add(-time.Minute)))
+		if err := tm.SubmitCommit("Name1", CategoryTest, "c1c", freeze); err == nil {
+			t.ErrorNow("Expected submissions to be frozen")
+		} else if err := tm.StartPhase(id, start); err == nil {
+			t.ErrorNow("Expected the phase not to start before its freeze")
+		}
+		t.CheckError(tm.StartPhase(id, time.Now()))
+		if err := tm.StartPhase(id, time.Now()); err == nil {
+			t.ErrorNow("Expected the phase to only start once")
+		}
+		tm.Queue.Wait()
+		t.CheckError(tm.FinishPhase(id))
+		if err := tm.FinishPhase(id); err == nil {
+			t.ErrorNow("Expected the phase to only finish once")
+		}
+
+		phase, err := tm.GetPhase(id)
+		t.CheckError(err)
+		if !phase.Finished || len(phase.Players) != 3 || len(phase.Leaderboard) != 3 {
+			t.ErrorNow("Expected a leaderboard of 3 players", phase)
+		}
+		for _, standing := range phase.Leaderboard {
+			if standing.Rank != 1 || standing.Wins != 2 || standing.Losses != 2 {
+				t.ErrorNow("Expected every player to win as team A", standing)
+			} else if standing.Name == "Name1" && standing.CommitHash != "c1b" {
+				t.ErrorNow("Expected the last commit before the freeze", standing)
+			}
+		}
+		matches, err := tm.ListMatches(CategoryTest)
+		t.CheckError(err)
+		if len(matches) != 6 {
+			t.ErrorNow("Expected a round-robin of 6 matches", matches)
+		} else if err := tm.RerunMatch(matches[0].Id); err == nil {
+			t.ErrorNow("Expected the results of a finished phase to be immutable")
+		}
+
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "c1c", time.Now()))
+		finalStart := time.Now().Add(-time.Minute)
+		finalId, err := tm.AddPhase(seasonId, "Final", CategoryTest, BracketSingleElimination, []string{"Map1"}, "", finalStart, finalStart, nil)
+		t.CheckError(err)
+		t.CheckError(tm.StartPhase(finalId, time.Now()))
+		tm.Queue.Wait()
+		t.CheckError(tm.FinishPhase(finalId))
+		if season, err := tm.GetSeason(seasonId); err != nil {
+			t.ErrorNow(err)
+		} else if len(season.Phases) != 2 || season.Phases[1].Name != "Final" || season.Phases[1].EventId == 0 {
+			t.ErrorNow("Expected the final to be played as a bracket", season)
+		} else if leaderboard := season.Phases[0].Leaderboard; leaderboard[0].Wins != 2 {
+			t.ErrorNow("Expected the qualifier leaderboard not to change", leaderboard)
+		}
+	})
+}
+
+// Plays a phase of an event format between four players after a ranked match, returning the phase and the match
+func playEventPhase(t *testutil.T, tm *Tournament, format string) (Phase, int64) {
+	t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+	start := time.Now().Add(-time.Hour)
+	t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+	for i := 1; i <= 4; i++ {
+		t.CheckError(tm.SubmitCommit(fmt.Sprintf("Name%v", i), CategoryTest, fmt.Sprintf("c%v", i), start))
+	}
+	ranked, err := tm.EnqueueMatch(CategoryTest, "Map1", Submission{"Name4", "c4"}, Submission{"Name1", "c1"}, SystemClock())
+	t.CheckError(err)
+	tm.Queue.Wait()
+	seasonId, err := tm.CreateSeason("Season", start)
+	t.CheckError(err)
+	id, err := tm.AddPhase(seasonId, "Final", CategoryTest, format, []string{"Map1"}, "", start, start, nil)
+	t.CheckError(err)
+	t.CheckError(tm.StartPhase(id, time.Now()))
+	tm.Queue.Wait()
+	t.CheckError(tm.FinishPhase(id))
+	phase, err := tm.GetPhase(id)
+	t.CheckError(err)
+	return phase, ranked
+}
+
+func TestBracketPhaseStandings(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		defer func() {
+			if tm.Queue != nil {
+				tm.Queue.Stop()
+			}
+		}()
+		phase, ranked := playEventPhase(t, tm, BracketSingleElimination)
+		bracket, err := tm.GetBracket(phase.EventId)
+		t.CheckError(err)
+		if frozen, err := tm.Database.IsPhaseMatch(ranked); err != nil {
+			t.ErrorNow(err)
+		} else if frozen {
+			t.ErrorNow("Expected only the matches of the bracket to be frozen")
+		}
+		ranks := []int{}
+		for _, standing := range phase.Leaderboard {
+			ranks = append(ranks, standing.Rank)
+		}
+		if len(phase.Leaderboard) != 4 || fmt.Sprint(ranks) != "[1 2 3 3]" {
+			t.ErrorNow("Expected the semi-final losers to share third place", phase.Leaderboard)
+		} else if champion := phase.Leaderboard[0]; champion.Name != bracket.Champion || champion.Wins != 2 || champion.Losses != 0 {
+			t.ErrorNow("Expected the champion to place first with the games it won", champion)
+		} else if runnerUp := phase.Leaderboard[1]; runnerUp.Name != bracket.Series[2].Players[0].Name && runnerUp.Name != bracket.Series[2].Players[1].Name {
+			t.ErrorNow("Expected the finalist to place second", runnerUp)
+		}
+	})
+}
+
+func TestSwissPhaseStandings(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		defer func() {
+			if tm.Queue != nil {
+				tm.Queue.Stop()
+			}
+		}()
+		phase, _ := playEventPhase(t, tm, PhaseSwiss)
+		swiss, err := tm.GetSwiss(phase.EventId)
+		t.CheckError(err)
+		standings := swiss.Standings()
+		if len(phase.Leaderboard) != len(standings) {
+			t.ErrorNow("Expected a standing for each player", phase.Leaderboard)
+		}
+		for i, standing := range phase.Leaderboard {
+			if standing.Rank != i+1 || standing.Name != standings[i].Name || standing.Score != standings[i].Points || standing.Wins != standings[i].Wins {
+				t.ErrorNow("Expected the leaderboard to follow the Swiss standings", phase.Leaderboard, standings)
+			}
+		}
+	})
+}
+
+func TestAddPhaseMaps(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		start := time.Now().Add(-time.Hour)
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit("Name1", CategoryTest, "c1", start))
+		seasonId, err := tm.CreateSeason("Season", start)
+		t.CheckError(err)
+		id, err := tm.AddPhase(seasonId, "Qualifier", CategoryTest, PhaseRoundRobin, []string{"Map1"}, "", start, start, nil)
+		t.CheckError(err)
+
+		t.CheckError(tm.AddPhaseMaps(id, map[string]string{"Gen2": "SourceGen2", "Gen1": "SourceGen1"}))
+		if phase, err := tm.GetPhase(id); err != nil {
+			t.ErrorNow(err)
+		} else if len(phase.Maps) != 3 || phase.Maps[1] != "Gen1" || phase.Maps[2] != "Gen2" {
+			t.ErrorNow("Expected the generated maps in the phase's maps", phase.Maps)
+		} else if source, err := tm.GetMapSource("Gen1", CategoryTest); err != nil || source != "SourceGen1" {
+			t.ErrorNow("Expected the generated map to be created", source, err)
+		}
+		if err := tm.AddPhaseMaps(id, map[string]string{"Gen3": "SourceGen3", "Map1": "MapSource"}); err == nil {
+			t.ErrorNow("Expected an error for a map which exists")
+		} else if exists, err := tm.MapExists("Gen3", CategoryTest); err != nil || exists {
+			t.ErrorNow("Expected no maps to be created when one fails", err)
+		}
+
+		t.CheckError(tm.StartPhase(id, time.Now()))
+		if err := tm.AddPhaseMaps(id, map[string]string{"Gen3": "SourceGen3"}); err == nil {
+			t.ErrorNow("Expected an error for a phase which has started")
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package tournament
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Wins, ties and losses from one player's point of view
+type Record struct {
+	Wins   int `json:"wins"`
+	Ties   int `json:"ties"`
+	Losses int `json:"losses"`
+}
+
+func (r *Record) add(result MatchResult, player1 bool) {
+	switch result {
+	case MatchResultWinA, MatchResultWinB:
+		if (result == MatchResultWinA) == player1 {
+			r.Wins++
+		} else {
+			r.Losses++
+		}
+	case MatchResultTieA, MatchResultTieB:
+		r.Ties++
+	}
+}
+
+func (r Record) Played() int {
+	return r.Wins + r.Ties + r.Losses
+}
+
+func winRate(record Record) float64 {
+	if played := record.Played(); played > 0 {
+		return float64(record.Wins) / float64(played)
+	}
+	return 0
+}
+
+// The record of every player against every other player, Records[a][b] is a's record against b
+type HeadToHead struct {
+	Category TournamentCategory           `json:"category"`
+	Players  []string                     `json:"players"`
+	Records  map[string]map[string]Record `json:"records"`
+}
+
+// A player's record on a map, WinRate is the fraction of decided and tied matches which were won
+type MapRecord struct {
+	Record
+	WinRate float64 `json:"win_rate"`
+}
+
+// The record of every player on every map, Records[player][map]
+type MapStats struct {
+	Category TournamentCategory              `json:"category"`
+	Players  []string                        `json:"players"`
+	Maps     []string                        `json:"maps"`
+	Records  map[string]map[string]MapRecord `json:"records"`
+}
+
+// Limits a player's results to the commits they submitted from From to To, inclusive.
+// An empty From starts at their first commit and an empty To ends at their latest commit.
+// Without a filter every player is counted with their latest submission.
+type StatsFilter struct {
+	Name string
+	From string
+	To   string
+}
+
+// Stats computed from the match table, kept until a match result, a submission or a map changes
+type statsCache struct {
+	mutex   sync.Mutex
+	entries map[string]statsEntry
+}
+
+type statsEntry struct {
+	version string
+	value   interface{}
+}
+
+func (c *statsCache) get(key, version string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	return entry.value, ok && entry.version == version
+}
+
+func (c *statsCache) put(key, version string, value interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]statsEntry{}
+	}
+	c.entries[key] = statsEntry{version, value}
+}
+
+// The commits each player is counted with, and a version which changes with the submissions, match results or maps
+func (t *Tournament) statsCommits(category TournamentCategory, filter StatsFilter) (map[string]map[string]bool, string, error) {
+	latestCommits, err := t.LatestCommits(category)
+	if err != nil {
+		return nil, "", err
+	}
+	version, err := t.Database.MatchesVersion(category)
+	if err != nil {
+		return nil, "", err
+	}
+	commits := map[string]map[string]bool{}
+	for _, submission := range latestCommits {
+		commits[submission.Name] = map[string]bool{submission.CommitHash: true}
+		version += ":" + submission.CommitHash
+	}
+	if filter.Name != "" {
+		if _, ok := commits[filter.Name]; !ok {
+			return nil, "", fmt.Errorf("%v has no accepted submission in %v", filter.Name, category)
+		} else if history, err := t.ListCommits(filter.Name, category); err != nil {
+			return nil, "", err
+		} else if inRange, err := commitRange(history, filter.From, filter.To); err != nil {
+			return nil, "", err
+		} else {
+			commits[filter.Name] = inRange
+		}
+	}
+	return commits, version, nil
+}
+
+// The commits from from to to in submission order, inclusive
+func commitRange(history []string, from, to string) (map[string]bool, error) {
+	index := map[string]int{}
+	for i, commit := range history {
+		index[commit] = i
+	}
+	start, end := 0, len(history)-1
+	if from != "" {
+		if i, ok := index[from]; !ok {
+			return nil, fmt.Errorf("Unknown commit %v", from)
+		} else {
+			start = i
+		}
+	}
+	if to != "" {
+		if i, ok := index[to]; !ok {
+			return nil, fmt.Errorf("Unknown commit %v", to)
+		} else {
+			end = i
+		}
+	}
+	if start > end {
+		return nil, fmt.Errorf("Commit %v was submitted after %v", from, to)
+	}
+	inRange := map[string]bool{}
+	for _, commit := range history[start : end+1] {
+		inRange[commit] = true
+	}
+	return inRange, nil
+}
+
+// The matches between the commits each player is counted with on the latest version of each map which has not been deleted
+func (t *Tournament) statsMatches(category TournamentCategory, commits map[string]map[string]bool) ([]Match, error) {
+	if matches, err := t.ListMatches(category); err != nil {
+		return nil, err
+	} else if maps, err := t.ListMaps(category); err != nil {
+		return nil, err
+	} else if versions, err := t.Database.MapVersions(category); err != nil {
+		return nil, err
+	} else {
+		live := map[string]bool{}
+		for _, mapName := range maps {
+			live[mapName] = true
+		}
+		counted := []Match{}
+		for _, match := range matches {
+			if live[match.Map] && match.MapVersion == versions[match.Map] && match.Player1 != match.Player2 && commits[match.Player1][match.Commit1] && commits[match.Player2][match.Commit2] {
+				counted = append(counted, match)
+			}
+		}
+		return counted, nil
+	}
+}
+
+func sortedPlayers(commits map[string]map[string]bool) []string {
+	players := []string{}
+	for name := range commits {
+		players = append(players, name)
+	}
+	sort.Strings(players)
+	return players
+}
+
+func statsKey(kind string, category TournamentCategory, filter StatsFilter) string {
+	return strings.Join([]string{kind, string(category), filter.Name, filter.From, filter.To}, "\x00")
+}
+
+// The win, tie and loss matrix between the current submissions of a category
+func (t *Tournament) HeadToHead(category TournamentCategory, filter StatsFilter) (HeadToHead, error) {
+	key := statsKey("headtohead", category, filter)
+	if commits, version, err := t.statsCommits(category, filter); err != nil {
+		return HeadToHead{}, err
+	} else if cached, ok := t.stats.get(key, version); ok {
+		return cached.(HeadToHead), nil
+	} else if matches, err := t.statsMatches(category, commits); err != nil {
+		return HeadToHead{}, err
+	} else {
+		stats := HeadToHead{category, sortedPlayers(commits), map[string]map[string]Record{}}
+		for _, a := range stats.Players {
+			stats.Records[a] = map[string]Record{}
+			for _, b := range stats.Players {
+				if a != b {
+					stats.Records[a][b] = Record{}
+				}
+			}
+		}
+		for _, match := range matches {
+			for _, side := range []bool{true, false} {
+				player, opponent := match.Player1, match.Player2
+				if !side {
+					player, opponent = opponent, player
+				}
+				record := stats.Records[player][opponent]
+				record.add(match.Result, side)
+				stats.Records[player][opponent] = record
+			}
+		}
+		t.stats.put(key, version, stats)
+		return stats, nil
+	}
+}
+
+// The record of each current submission of a category on each map
+func (t *Tournament) MapStats(category TournamentCategory, filter StatsFilter) (MapStats, error) {
+	key := statsKey("maps", category, filter)
+	if commits, version, err := t.statsCommits(category, filter); err != nil {
+		return MapStats{}, err
+	} else if cached, ok := t.stats.get(key, version); ok {
+		return cached.(MapStats), nil
+	} else if maps, err := t.ListMaps(category); err != nil {
+		return MapStats{}, err
+	} else if matches, err := t.statsMatches(category, commits); err != nil {
+		return MapStats{}, err
+	} else {
+		sort.Strings(maps)
+		stats := MapStats{category, sortedPlayers(commits), maps, map[string]map[string]MapRecord{}}
+		for _, player := range stats.Players {
+			stats.Records[player] = map[string]MapRecord{}
+			for _, mapName := range maps {
+				stats.Records[player][mapName] = MapRecord{}
+			}
+		}
+		for _, match := range matches {
+			for _, side := range []bool{true, false} {
+				player := match.Player1
+				if !side {
+					player = match.Player2
+				}
+				record := stats.Records[player][match.Map]
+				record.add(match.Result, side)
+				record.WinRate = winRate(record.Record)
+				stats.Records[player][match.Map] = record
+			}
+		}
+		t.stats.put(key, version, stats)
+		return stats, nil
+	}
+}
@@ -0,0 +1,95 @@
+package tournament
+
+import (
+	"github.com/GlenKelley/battleref/testing"
+	"testing"
+	"time"
+)
+
+func TestMatchStats(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		p1, p2 := Submission{"Name1", "a1"}, Submission{"Name2", "b1"}
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.CreateMap("Map2", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit(p1.Name, CategoryTest, p1.CommitHash, time.Now()))
+		t.CheckError(tm.SubmitCommit(p2.Name, CategoryTest, p2.CommitHash, time.Now()))
+		play := func(mapName string, player1, player2 Submission, result MatchResult) {
+			_, err := tm.CreateMatch(CategoryTest, mapName, player1, player2, time.Now())
+			t.CheckError(err)
+			t.CheckError(tm.UpdateMatch(CategoryTest, mapName, player1, player2, time.Now(), result, []byte{}))
+		}
+		play("Map1", p1, p2, MatchResultWinA)
+		play("Map1", p2, p1, MatchResultWinA)
+		play("Map2", p1, p2, MatchResultTieA)
+		play("Map2", p2, p1, MatchResultWinB)
+
+		if stats, err := tm.HeadToHead(CategoryTest, StatsFilter{}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Name2"]; record != (Record{2, 1, 1}) {
+			t.ErrorNow("Unexpected record for Name1", record)
+		} else if record := stats.Records["Name2"]["Name1"]; record != (Record{1, 1, 2}) {
+			t.ErrorNow("Unexpected record for Name2", record)
+		}
+		if stats, err := tm.MapStats(CategoryTest, StatsFilter{}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Map1"]; record.Record != (Record{1, 0, 1}) || record.WinRate != 0.5 {
+			t.ErrorNow("Unexpected record for Name1 on Map1", record)
+		} else if record := stats.Records["Name2"]["Map2"]; record.Record != (Record{0, 1, 1}) || record.WinRate != 0 {
+			t.ErrorNow("Unexpected record for Name2 on Map2", record)
+		}
+
+		p1 = Submission{"Name1", "a2"}
+		t.CheckError(tm.SubmitCommit(p1.Name, CategoryTest, p1.CommitHash, time.Now().Add(time.Second)))
+		if stats, err := tm.HeadToHead(CategoryTest, StatsFilter{}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Name2"]; record.Played() != 0 {
+			t.ErrorNow("Expected only the current submissions to be counted", record)
+		}
+		play("Map1", p1, p2, MatchResultWinA)
+		if stats, err := tm.HeadToHead(CategoryTest, StatsFilter{}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Name2"]; record != (Record{1, 0, 0}) {
+			t.ErrorNow("Expected the cache to be refreshed by a new result", record)
+		}
+		if stats, err := tm.HeadToHead(CategoryTest, StatsFilter{"Name1", "a1", ""}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Name2"]; record != (Record{3, 1, 1}) {
+			t.ErrorNow("Expected every commit in the range to be counted", record)
+		} else if _, err := tm.HeadToHead(CategoryTest, StatsFilter{"Name1", "a2", "a1"}); err == nil {
+			t.ErrorNow("Expected an error for a reversed range")
+		} else if _, err := tm.HeadToHead(CategoryTest, StatsFilter{"Name1", "a3", ""}); err == nil {
+			t.ErrorNow("Expected an error for an unknown commit")
+		}
+
+		t.CheckError(tm.DeleteMap("Map2", CategoryTest))
+		if stats, err := tm.MapStats(CategoryTest, StatsFilter{}); err != nil {
+			t.ErrorNow(err)
+		} else if len(stats.Maps) != 1 || stats.Maps[0] != "Map1" {
+			t.ErrorNow("Expected the cache to be refreshed by a deleted map", stats.Maps)
+		} else if _, ok := stats.Records["Name2"]["Map2"]; ok {
+			t.ErrorNow("Expected no records on a deleted map", stats.Records["Name2"])
+		}
+		if stats, err := tm.HeadToHead(CategoryTest, StatsFilter{"Name1", "a1", ""}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Name2"]; record != (Record{2, 0, 1}) {
+			t.ErrorNow("Expected matches on a deleted map not to be counted", record)
+		}
+		_, err := tm.UpdateMap("Map1", "MapSource2", CategoryTest)
+		t.CheckError(err)
+		if stats, err := tm.HeadToHead(CategoryTest, StatsFilter{"Name1", "a1", ""}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Name2"]; record.Played() != 0 {
+			t.ErrorNow("Expected matches on an earlier version of a map not to be counted", record)
+		} else if stats, err := tm.MapStats(CategoryTest, StatsFilter{}); err != nil {
+			t.ErrorNow(err)
+		} else if record := stats.Records["Name1"]["Map1"]; record.Played() != 0 {
+			t.ErrorNow("Expected matches on an earlier version of a map not to be counted", record)
+		}
+		t.CheckError(tm.CreateMap("Map3", "MapSource", CategoryTest))
+		if stats, err := tm.MapStats(CategoryTest, StatsFilter{}); err != nil {
+			t.ErrorNow(err)
+		} else if len(stats.Maps) != 2 || stats.Maps[1] != "Map3" {
+			t.ErrorNow("Expected the cache to be refreshed by a new map", stats.Maps)
+		}
+	})
+}
@@ -0,0 +1,350 @@
+package tournament
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Serialises Swiss advancement, so a round is never paired twice
+var swissMutex sync.Mutex
+
+// The most partial pairings tried when looking for a round without rematches, before rematches are allowed
+const swissPairingBudget = 100000
+
+// A Swiss-system tournament. Each round players are paired with players on similar points whom they
+// have not played yet, and each pairing plays one match on every map with the players swapping sides.
+type SwissTournament struct {
+	Id       int64              `json:"id"`
+	Name     string             `json:"name"`
+	Category TournamentCategory `json:"category"`
+	Rounds   int                `json:"rounds"`
+	Round    int                `json:"round"`
+	Maps     []string           `json:"maps"`
+	Players  []Submission       `json:"players"`
+	Finished bool               `json:"finished"`
+	Created  time.Time          `json:"created"`
+	Pairings []SwissPairing     `json:"pairings"`
+}
+
+// Two players paired in a round, a pairing without a Player2 is a bye.
+// The player who wins more games scores a point, an even pairing is half a point each.
+// A pairing is not done while a game has ended in an error or timeout, until that game is rerun.
+type SwissPairing struct {
+	Round   int          `json:"round"`
+	Board   int          `json:"board"`
+	Player1 string       `json:"player1"`
+	Player2 string       `json:"player2"`
+	Games   []SeriesGame `json:"games"`
+	Wins    [2]int       `json:"wins"`
+	Points  [2]float64   `json:"points"`
+	Done    bool         `json:"done"`
+}
+
+// A player's standing in a Swiss tournament. Buchholz is the sum of the points of the player's opponents,
+// BuchholzCut1 leaves out the weakest opponent and SonnebornBerger weights each opponent by the player's result.
+type SwissStanding struct {
+	Name            string  `json:"name"`
+	Seed            int     `json:"seed"`
+	Points          float64 `json:"points"`
+	Buchholz        float64 `json:"buchholz"`
+	BuchholzCut1    float64 `json:"buchholz_cut1"`
+	SonnebornBerger float64 `json:"sonneborn_berger"`
+	Wins            int     `json:"wins"`
+	Draws           int     `json:"draws"`
+	Losses          int     `json:"losses"`
+	Byes            int     `json:"byes"`
+}
+
+// Scores a pairing from the results of its games
+func (p *SwissPairing) tally() {
+	wins, pending := countWins(p.Games, p.Player1)
+	p.Wins, p.Done = wins, pending == 0
+	switch {
+	case p.Player2 == "" || wins[0] > wins[1]:
+		p.Points = [2]float64{1, 0}
+	case wins[0] < wins[1]:
+		p.Points = [2]float64{0, 1}
+	default:
+		p.Points = [2]float64{0.5, 0.5}
+	}
+}
+
+// Whether every pairing of the current round has been played
+func (s *SwissTournament) roundComplete() bool {
+	for _, pairing := range s.Pairings {
+		if pairing.Round == s.Round && !pairing.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// The players ordered by points, then Buchholz, Buchholz cut 1, Sonneborn-Berger and seed.
+// Only finished pairings are counted, a bye is worth a point and does not count towards the tiebreakers.
+func (s *SwissTournament) Standings() []SwissStanding {
+	standings := make([]SwissStanding, len(s.Players))
+	index := map[string]int{}
+	for i, player := range s.Players {
+		standings[i] = SwissStanding{Name: player.Name, Seed: i + 1}
+		index[player.Name] = i
+	}
+	opponents := make([][]int, len(s.Players))
+	results := make([][]float64, len(s.Players))
+	for _, pairing := range s.Pairings {
+		a, ok := index[pairing.Player1]
+		if !ok || !pairing.Done {
+			continue
+		} else if pairing.Player2 == "" {
+			standings[a].Points++
+			standings[a].Byes++
+			continue
+		}
+		b, ok := index[pairing.Player2]
+		if !ok {
+			continue
+		}
+		for _, side := range [][2]int{{a, 0}, {b, 1}} {
+			player, points := side[0], pairing.Points[side[1]]
+			standings[player].Points += points
+			switch points {
+			case 1:
+				standings[player].Wins++
+			case 0:
+				standings[player].Losses++
+			default:
+				standings[player].Draws++
+			}
+			results[player] = append(results[player], points)
+		}
+		opponents[a] = append(opponents[a], b)
+		opponents[b] = append(opponents[b], a)
+	}
+	for i := range standings {
+		lowest := math.Inf(1)
+		for j, opponent := range opponents[i] {
+			points := standings[opponent].Points
+			standings[i].Buchholz += points
+			standings[i].SonnebornBerger += results[i][j] * points
+			lowest = math.Min(lowest, points)
+		}
+		standings[i].BuchholzCut1 = standings[i].Buchholz
+		if len(opponents[i]) > 0 {
+			standings[i].BuchholzCut1 -= lowest
+		}
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		} else if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		} else if a.BuchholzCut1 != b.BuchholzCut1 {
+			return a.BuchholzCut1 > b.BuchholzCut1
+		} else if a.SonnebornBerger != b.SonnebornBerger {
+			return a.SonnebornBerger > b.SonnebornBerger
+		}
+		return a.Seed < b.Seed
+	})
+	return standings
+}
+
+// Pairs players given in standings order, each with the highest placed player they have not played.
+// With an odd number of players the lowest placed player without a bye sits the round out.
+// Rematches are only allowed when there is no pairing without them.
+func pairSwiss(ranked []string, played map[string]bool, hadBye map[string]bool) ([][2]string, string) {
+	bye := ""
+	if len(ranked)%2 == 1 {
+		index := len(ranked) - 1
+		for i := len(ranked) - 1; i >= 0; i-- {
+			if !hadBye[ranked[i]] {
+				index = i
+				break
+			}
+		}
+		bye = ranked[index]
+		ranked = append(append([]string{}, ranked[:index]...), ranked[index+1:]...)
+	}
+	budget := swissPairingBudget
+	if pairs, ok := pairWithoutRematches(ranked, played, &budget); ok {
+		return pairs, bye
+	}
+	pairs := [][2]string{}
+	for i := 0; i+1 < len(ranked); i += 2 {
+		pairs = append(pairs, [2]string{ranked[i], ranked[i+1]})
+	}
+	return pairs, bye
+}
+
+func pairWithoutRematches(players []string, played map[string]bool, budget *int) ([][2]string, bool) {
+	if len(players) == 0 {
+		return [][2]string{}, true
+	}
+	for i := 1; i < len(players) && *budget > 0; i++ {
+		*budget--
+		if played[players[0]+"\x00"+players[i]] {
+			continue
+		}
+		rest := append(append([]string{}, players[1:i]...), players[i+1:]...)
+		if pairs, ok := pairWithoutRematches(rest, played, budget); ok {
+			return append([][2]string{{players[0], players[i]}}, pairs...), true
+		}
+	}
+	return nil, false
+}
+
+// Creates a Swiss tournament between every player of a category, seeded from the leaderboard,
+// and queues its first round. The number of rounds defaults to enough to separate the players.
+func (t *Tournament) CreateSwiss(name string, category TournamentCategory, rounds int, maps []string, created time.Time) (int64, error) {
+	if t.Queue == nil {
+		return 0, errors.New("Match queue is not running")
+	}
+	maps, err := t.eventMaps(category, maps)
+	if err != nil {
+		return 0, err
+	} else if len(maps) == 0 {
+		return 0, errors.New("A Swiss tournament needs at least one map")
+	}
+	players, err := t.Seeds(category)
+	if err != nil {
+		return 0, err
+	} else if len(players) < 2 {
+		return 0, errors.New("A Swiss tournament needs at least two players")
+	}
+	maxRounds := len(players) - 1 + len(players)%2
+	if rounds == 0 {
+		rounds = int(math.Ceil(math.Log2(float64(len(players)))))
+	}
+	if rounds < 1 || rounds > maxRounds {
+		return 0, fmt.Errorf("A Swiss tournament of %v players has between 1 and %v rounds", len(players), maxRounds)
+	}
+	var id int64
+	if err := t.Database.TransactionBlock(func(tx Statements) error {
+		id, err = tx.CreateSwiss(SwissTournament{0, name, category, rounds, 0, maps, players, false, created, nil})
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return id, t.AdvanceSwiss(id)
+}
+
+// A Swiss tournament with the score of each pairing
+func (t *Tournament) GetSwiss(id int64) (SwissTournament, error) {
+	if swiss, err := t.Database.GetSwiss(id); err != nil {
+		return SwissTournament{}, err
+	} else {
+		for i := range swiss.Pairings {
+			swiss.Pairings[i].tally()
+		}
+		return swiss, nil
+	}
+}
+
+// The Swiss tournaments of a category without their pairings
+func (t *Tournament) ListSwiss(category TournamentCategory) ([]SwissTournament, error) {
+	tournaments, err := t.Database.ListSwiss(category)
+	return tournaments, err
+}
+
+// Pairs and queues the next round of a Swiss tournament once every pairing of the current round has been played
+func (t *Tournament) AdvanceSwiss(id int64) error {
+	swissMutex.Lock()
+	defer swissMutex.Unlock()
+	return t.advanceSwiss(id)
+}
+
+func (t *Tournament) advanceSwiss(id int64) error {
+	for {
+		if swiss, err := t.GetSwiss(id); err != nil {
+			return err
+		} else if swiss.Finished || !swiss.roundComplete() {
+			return nil
+		} else if swiss.Round >= swiss.Rounds {
+			return t.Database.FinishSwiss(id)
+		} else if err := t.pairSwissRound(swiss); err != nil {
+			return err
+		}
+	}
+}
+
+// Advances every Swiss tournament which has not finished, for rounds which finished while the queue was stopped
+func (t *Tournament) AdvanceSwissTournaments() error {
+	swissMutex.Lock()
+	defer swissMutex.Unlock()
+	if ids, err := t.Database.ListOpenSwiss(); err != nil {
+		return err
+	} else {
+		for _, id := range ids {
+			if err := t.advanceSwiss(id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Advances the Swiss tournaments a finished match belongs to, looked up under the lock like advanceMatchBrackets
+func (t *Tournament) advanceMatchSwiss(matchId int64) {
+	swissMutex.Lock()
+	defer swissMutex.Unlock()
+	if ids, err := t.Database.ListMatchSwiss(matchId); err != nil {
+		log.Println(err)
+	} else {
+		for _, id := range ids {
+			if err := t.advanceSwiss(id); err != nil {
+				log.Printf("Failed to advance Swiss tournament %v: %v\n", id, err)
+			}
+		}
+	}
+}
+
+// Pairs the next round from the current standings and queues its matches
+func (t *Tournament) pairSwissRound(swiss SwissTournament) error {
+	ranked := []string{}
+	for _, standing := range swiss.Standings() {
+		ranked = append(ranked, standing.Name)
+	}
+	played, hadBye := map[string]bool{}, map[string]bool{}
+	for _, pairing := range swiss.Pairings {
+		if pairing.Player2 == "" {
+			hadBye[pairing.Player1] = true
+		} else {
+			played[pairing.Player1+"\x00"+pairing.Player2] = true
+			played[pairing.Player2+"\x00"+pairing.Player1] = true
+		}
+	}
+	commits := map[string]string{}
+	for _, player := range swiss.Players {
+		commits[player.Name] = player.CommitHash
+	}
+	round := swiss.Round + 1
+	pairs, bye := pairSwiss(ranked, played, hadBye)
+	pairings := []SwissPairing{}
+	for board, pair := range pairs {
+		pairing := SwissPairing{Round: round, Board: board, Player1: pair[0], Player2: pair[1]}
+		for game, mapName := range swiss.Maps {
+			player1, player2 := pair[game%2], pair[1-game%2]
+			if id, err := t.EnqueueMatch(swiss.Category, mapName, Submission{player1, commits[player1]}, Submission{player2, commits[player2]}, SystemClock()); err != nil {
+				return err
+			} else {
+				pairing.Games = append(pairing.Games, SeriesGame{id, mapName, player1, MatchResultInProgress})
+			}
+		}
+		pairings = append(pairings, pairing)
+	}
+	if bye != "" {
+		pairings = append(pairings, SwissPairing{Round: round, Board: len(pairs), Player1: bye})
+	}
+	return t.Database.TransactionBlock(func(tx Statements) error {
+		for _, pairing := range pairings {
+			if err := tx.CreateSwissPairing(swiss.Id, pairing); err != nil {
+				return err
+			}
+		}
+		return tx.SetSwissRound(swiss.Id, round)
+	})
+}
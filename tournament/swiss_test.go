@@ -0,0 +1,97 @@
+package tournament
+
+import (
+	"fmt"
+	"github.com/GlenKelley/battleref/testing"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPairSwiss(test *testing.T) {
+	t := (*testutil.T)(test)
+	played := map[string]bool{"a\x00b": true, "b\x00a": true}
+	if pairs, bye := pairSwiss([]string{"a", "b", "c", "d", "e"}, played, map[string]bool{"e": true}); bye != "d" {
+		t.ErrorNow("Expected the lowest player without a bye to sit out, not", bye)
+	} else if expected := [][2]string{{"a", "c"}, {"b", "e"}}; !reflect.DeepEqual(pairs, expected) {
+		t.ErrorNow("Expected to avoid the rematch", pairs)
+	} else if pairs, _ := pairSwiss([]string{"a", "b"}, played, map[string]bool{}); !reflect.DeepEqual(pairs, [][2]string{{"a", "b"}}) {
+		t.ErrorNow("Expected a rematch when there is no other pairing", pairs)
+	}
+}
+
+func TestSwissStandings(test *testing.T) {
+	t := (*testutil.T)(test)
+	win := []SeriesGame{{1, "Map1", "a", MatchResultWinA}}
+	swiss := SwissTournament{Players: []Submission{{"a", "c1"}, {"b", "c2"}, {"c", "c3"}}, Pairings: []SwissPairing{
+		{Round: 1, Board: 0, Player1: "a", Player2: "b", Games: win},
+		{Round: 1, Board: 1, Player1: "c"},
+		{Round: 2, Board: 0, Player1: "c", Player2: "a", Games: []SeriesGame{{2, "Map1", "c", MatchResultTieB}}},
+		{Round: 2, Board: 1, Player1: "b"},
+	}}
+	for i := range swiss.Pairings {
+		swiss.Pairings[i].tally()
+	}
+	standings := swiss.Standings()
+	if standings[0].Name != "a" || standings[0].Points != 2 || standings[0].Wins != 2 {
+		t.ErrorNow("Expected a to lead with 2 points", standings[0])
+	} else if standings[1].Name != "b" || standings[1].Buchholz != 2 || standings[1].SonnebornBerger != 0 || standings[1].Byes != 1 {
+		t.ErrorNow("Expected b to be second on seed", standings[1])
+	} else if standings[2].Name != "c" || standings[2].Buchholz != 2 || standings[2].Losses != 1 {
+		t.ErrorNow("Expected c to be last on seed", standings[2])
+	} else if standings[0].Buchholz != 2 || standings[0].BuchholzCut1 != 1 || standings[0].SonnebornBerger != 2 {
+		t.ErrorNow("Unexpected tiebreakers", standings[0])
+	}
+}
+
+func TestSwissPairingWaitsForRerun(test *testing.T) {
+	t := (*testutil.T)(test)
+	for _, result := range []MatchResult{MatchResultInProgress, MatchResultError, MatchResultTimeout} {
+		pairing := SwissPairing{Round: 1, Player1: "a", Player2: "b", Games: []SeriesGame{{1, "Map1", "a", result}}}
+		pairing.tally()
+		swiss := SwissTournament{Round: 1, Pairings: []SwissPairing{pairing}}
+		if pairing.Done || swiss.roundComplete() {
+			t.ErrorNow("Expected a pairing with a game which is", result, "to wait")
+		}
+	}
+}
+
+func TestSwissTournament(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		for i := 1; i <= 5; i++ {
+			t.CheckError(tm.SubmitCommit(fmt.Sprintf("Name%v", i), CategoryTest, fmt.Sprintf("c%v", i), time.Now()))
+		}
+		if _, err := tm.CreateSwiss("Qualifier", CategoryTest, 6, nil, time.Now()); err == nil {
+			t.ErrorNow("Expected an error for more rounds than opponents")
+		}
+		id, err := tm.CreateSwiss("Qualifier", CategoryTest, 0, nil, time.Now())
+		t.CheckError(err)
+		tm.Queue.Wait()
+		swiss, err := tm.GetSwiss(id)
+		t.CheckError(err)
+		if !swiss.Finished || swiss.Round != 3 || len(swiss.Pairings) != 9 {
+			t.ErrorNow("Expected 3 finished rounds of 3 pairings", swiss)
+		}
+		played, byes := map[string]bool{}, map[string]int{}
+		for _, pairing := range swiss.Pairings {
+			if pairing.Player2 == "" {
+				byes[pairing.Player1]++
+			} else if played[pairing.Player1+pairing.Player2] || played[pairing.Player2+pairing.Player1] {
+				t.ErrorNow("Unexpected rematch", pairing)
+			} else {
+				played[pairing.Player1+pairing.Player2] = true
+			}
+		}
+		for name, count := range byes {
+			if count > 1 {
+				t.ErrorNow("Expected at most one bye each", name, count)
+			}
+		}
+		if standings := swiss.Standings(); standings[0].Name != "Name1" || standings[0].Points != 3 {
+			t.ErrorNow("Expected the top seed to win every round", standings)
+		}
+	})
+}
@@ -3,6 +3,11 @@ package tournament
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -40,15 +45,38 @@ const (
 )
 
 type Tournament struct {
-	Database  Database
-	Arena     arena.Arena
-	Bootstrap arena.Bootstrap
-	GitHost   git.GitHost
-	Remote    git.Remote
+	Database       Database
+	Arena          arena.Arena
+	Bootstrap      arena.Bootstrap
+	GitHost        git.GitHost
+	Remote         git.Remote
+	Queue          *MatchQueue
+	Retry          RetryPolicy
+	RatingModels   map[TournamentCategory]string
+	Scoring        map[TournamentCategory]ScoringRules
+	ScrimmageQuota int
+	stats          statsCache
 }
 
 func NewTournament(database Database, arena arena.Arena, bootstrap arena.Bootstrap, gitHost git.GitHost, remote git.Remote) *Tournament {
-	return &Tournament{database, arena, bootstrap, gitHost, remote}
+	return &Tournament{database, arena, bootstrap, gitHost, remote, nil, DefaultRetryPolicy, map[TournamentCategory]string{}, map[TournamentCategory]ScoringRules{}, DefaultScrimmageQuota, statsCache{}}
+}
+
+// Starts a pool of workers which play enqueued matches in the background, and catches up any brackets
+// and Swiss tournaments whose matches finished while the queue was stopped
+func (t *Tournament) StartMatchQueue(workers int, clock Clock) error {
+	if t.Queue != nil {
+		return errors.New("Match queue already started")
+	}
+	queue := NewMatchQueue(t, workers, clock)
+	if err := queue.Start(); err != nil {
+		return err
+	}
+	t.Queue = queue
+	if err := t.AdvanceBrackets(); err != nil {
+		return err
+	}
+	return t.AdvanceSwissTournaments()
 }
 
 func (t *Tournament) InstallDefaultMaps(resourcePath string, category TournamentCategory) error {
@@ -149,6 +177,34 @@ func (t *Tournament) CreateUser(name, publicKey string, category TournamentCateg
 	//	})
 }
 
+// Creates a secret token which identifies a player to the server, replacing any previous token
+func (t *Tournament) CreateUserToken(name string) (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(bs)
+	if err := t.Database.SetUserToken(name, hashToken(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// The player identified by a token
+func (t *Tournament) GetTokenUser(token string) (string, error) {
+	if name, err := t.Database.GetTokenUser(hashToken(token)); err == sql.ErrNoRows {
+		return "", errors.New("Unknown token")
+	} else {
+		return name, err
+	}
+}
+
+// Only a hash of each token is stored so a copy of the database does not give access to the server
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 func (t *Tournament) CreateMap(name, source string, category TournamentCategory) error {
 	return t.Database.CreateMap(name, source, category)
 }
@@ -164,15 +220,16 @@ func (t *Tournament) ListMaps(category TournamentCategory) ([]string, error) {
 }
 
 type Match struct {
-	Id       int64
-	Player1  string
-	Player2  string
-	Commit1  string
-	Commit2  string
-	Map      string
-	Category string
-	Result   MatchResult
-	Time     time.Time
+	Id         int64
+	Player1    string
+	Player2    string
+	Commit1    string
+	Commit2    string
+	Map        string
+	Category   string
+	Result     MatchResult
+	Time       time.Time
+	MapVersion int
 }
 
 func (t *Tournament) ListMatches(category TournamentCategory) ([]Match, error) {
@@ -185,8 +242,38 @@ func (t *Tournament) MapExists(name string, category TournamentCategory) (bool,
 	return exists, err
 }
 
+// Records a commit and checks that it builds, only accepted commits are played.
+// Commits are accepted without a check when the arena is not an arena.Compiler.
+// Commits are rejected while a phase of the category has frozen submissions.
 func (t *Tournament) SubmitCommit(name string, category TournamentCategory, commitHash string, time time.Time) error {
-	return t.Database.CreateCommit(name, category, commitHash, time)
+	if phase, frozen, err := t.frozenPhase(category, time); err != nil {
+		return err
+	} else if frozen {
+		return fmt.Errorf("Submissions to %v are frozen for phase %v", category, phase.Name)
+	} else if previous, err := t.Database.GetCommitStatus(name, category, commitHash); err == nil && previous.Status == SubmissionError {
+		// The commit could not be checked when it was submitted, so it is checked again
+	} else if err := t.Database.CreateCommit(name, category, commitHash, time); err != nil {
+		return err
+	}
+	status := SubmissionStatus{SubmissionAccepted, ""}
+	if compiler, ok := t.Arena.(arena.Compiler); ok {
+		if result, err := compiler.CompilePlayer(context.Background(), string(category), t.GitHost.RepositoryURL(name), commitHash); err != nil {
+			if err2 := t.Database.UpdateCommitStatus(name, category, commitHash, SubmissionStatus{SubmissionError, err.Error()}); err2 != nil {
+				log.Println(err2)
+			}
+			return err
+		} else if !result.Accepted {
+			status = SubmissionStatus{SubmissionRejected, result.Output}
+		} else {
+			status.Output = result.Output
+		}
+	}
+	return t.Database.UpdateCommitStatus(name, category, commitHash, status)
+}
+
+func (t *Tournament) GetCommitStatus(name string, category TournamentCategory, commitHash string) (SubmissionStatus, error) {
+	status, err := t.Database.GetCommitStatus(name, category, commitHash)
+	return status, err
 }
 
 func (t *Tournament) ListCommits(name string, category TournamentCategory) ([]string, error) {
@@ -199,6 +286,20 @@ type Submission struct {
 	CommitHash string
 }
 
+const (
+	SubmissionPending  = "Pending"
+	SubmissionAccepted = "Accepted"
+	SubmissionRejected = "Rejected"
+	// The compile check failed to run, the commit may be submitted again to retry it
+	SubmissionError = "Error"
+)
+
+// Whether a submission passed its compile check, and the output of the compiler
+type SubmissionStatus struct {
+	Status string `json:"status"`
+	Output string `json:"output"`
+}
+
 type MatchResult string
 
 const (
@@ -208,6 +309,7 @@ const (
 	MatchResultTieA       = "TieA"
 	MatchResultTieB       = "TieB"
 	MatchResultError      = "Error"
+	MatchResultTimeout    = "Timeout"
 )
 
 func (t *Tournament) CreateMatch(category TournamentCategory, mapName string, player1, player2 Submission, created time.Time) (int64, error) {
@@ -224,6 +326,11 @@ func (t *Tournament) GetMatchResult(id int64) (MatchResult, error) {
 	return result, err
 }
 
+func (t *Tournament) GetMatch(id int64) (Match, error) {
+	match, err := t.Database.GetMatch(id)
+	return match, err
+}
+
 func (t *Tournament) GetMatchReplay(id int64) (simulator.Replay, error) {
 	if replay, category, err := t.Database.GetMatchReplay(id); err != nil {
 		return nil, err
@@ -241,45 +348,225 @@ func (t *Tournament) GetMatchReplayRaw(id int64) ([]byte, error) {
 	return replay, err
 }
 
-func (t *Tournament) RunMatch(category TournamentCategory, mapName string, player1, player2 Submission, clock Clock) (int64, MatchResult, error) {
+// Plays a match, a match cancelled through the context is left InProgress so it can be played again.
+// Every attempt which is not cancelled is kept in the match history.
+func (t *Tournament) RunMatch(ctx context.Context, category TournamentCategory, mapName string, player1, player2 Submission, clock Clock) (int64, MatchResult, error) {
 	if id, err := t.CreateMatch(category, mapName, player1, player2, clock.Now()); err != nil {
 		return 0, MatchResultError, err
 	} else {
-		if mapSource, err := t.GetMapSource(mapName, category); err != nil {
-			return id, MatchResultError, err
-		} else if finished, result, err := t.Arena.RunMatch(arena.MatchProperties{
+		result, err := t.playMatch(ctx, id, category, mapName, player1, player2, clock)
+		return id, result, err
+	}
+}
+
+// Plays a match which has already been created, see RunMatch
+func (t *Tournament) playMatch(ctx context.Context, id int64, category TournamentCategory, mapName string, player1, player2 Submission, clock Clock) (MatchResult, error) {
+	started := clock.Now()
+	finished, result := started, arena.MatchResult{}
+	m, err := t.matchMap(id, mapName, category)
+	if err == nil {
+		finished, result, err = t.Arena.RunMatch(ctx, arena.MatchProperties{
 			mapName,
-			strings.NewReader(mapSource),
+			strings.NewReader(m.Source),
 			string(category),
 			t.GitHost.RepositoryURL(player1.Name),
 			t.GitHost.RepositoryURL(player2.Name),
 			player1.CommitHash,
 			player2.CommitHash,
-		}, func() time.Time { return clock.Now() }); err != nil {
-			if err2 := t.UpdateMatch(category, mapName, player1, player2, finished, MatchResultError, []byte{}); err2 != nil {
-				log.Println(err2)
-			}
-			return id, MatchResultError, err
-		} else if unzipped, err := gzip.NewReader(bytes.NewReader(result.Replay)); err != nil {
-			return id, MatchResultError, err
-		} else if replay, err := simulator.NewReplay(unzipped, string(category)); err != nil {
-			return id, MatchResultError, err
+		}, func() time.Time { return clock.Now() })
+		if err != nil && ctx.Err() != nil {
+			return MatchResultInProgress, err
+		}
+		if err2 := t.saveMatchLogs(id, result.Logs); err2 != nil {
+			log.Println(err2)
+		}
+	}
+	matchResult, err := t.recordMatch(id, category, finished, result, err)
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	if err2 := t.Database.CreateMatchAttempt(id, started, finished, matchResult, message); err2 != nil {
+		log.Println(err2)
+	}
+	return matchResult, err
+}
+
+// The version of its map a match is played on, the latest version when the match was created.
+// Matches created before maps were versioned are played on the latest version.
+func (t *Tournament) matchMap(id int64, mapName string, category TournamentCategory) (MapVersion, error) {
+	if match, err := t.Database.GetMatch(id); err != nil {
+		return MapVersion{}, err
+	} else if match.MapVersion == 0 {
+		if m, err := t.Database.GetMap(mapName, category); err != nil {
+			return MapVersion{}, err
+		} else {
+			return m, t.Database.SetMatchMapVersion(id, m.Version)
+		}
+	} else if m, err := t.Database.GetMapVersion(mapName, category, match.MapVersion); err != nil {
+		return MapVersion{}, err
+	} else if m.Deleted {
+		return MapVersion{}, &MatchError{fmt.Errorf("Map %v has been deleted", mapName)}
+	} else {
+		return m, nil
+	}
+}
+
+// Stores the outcome of a match played by the arena
+func (t *Tournament) recordMatch(id int64, category TournamentCategory, finished time.Time, result arena.MatchResult, err error) (MatchResult, error) {
+	if err == arena.ErrMatchTimeout {
+		if err2 := t.Database.UpdateMatchResult(id, finished, MatchResultTimeout, []byte{}); err2 != nil {
+			return MatchResultError, err2
+		}
+		return MatchResultTimeout, nil
+	} else if err != nil {
+		if err2 := t.Database.UpdateMatchResult(id, finished, MatchResultError, []byte{}); err2 != nil {
+			log.Println(err2)
+		}
+		return MatchResultError, err
+	} else if unzipped, err := gzip.NewReader(bytes.NewReader(result.Replay)); err != nil {
+		return MatchResultError, &MatchError{err}
+	} else if replay, err := simulator.NewReplay(unzipped, string(category)); err != nil {
+		return MatchResultError, &MatchError{err}
+	} else {
+		matchResult := GetMatchResult(result)
+		gzReplay := bytes.Buffer{}
+		gz := gzip.NewWriter(&gzReplay)
+		if jsonReplay, err := json.MarshalIndent(replay, "", "\t"); err != nil {
+			return MatchResultError, &MatchError{err}
+		} else if _, err := gz.Write(jsonReplay); err != nil {
+			return MatchResultError, err
+		} else if err := gz.Close(); err != nil {
+			return MatchResultError, err
+		}
+		if err := t.Database.UpdateMatchResult(id, finished, matchResult, gzReplay.Bytes()); err != nil {
+			return MatchResultError, err
+		}
+		return matchResult, nil
+	}
+}
+
+// One play of a match, a match which is retried or rerun has several attempts
+type MatchAttempt struct {
+	Started  time.Time   `json:"started"`
+	Finished time.Time   `json:"finished"`
+	Result   MatchResult `json:"result"`
+	Error    string      `json:"error"`
+}
+
+func (t *Tournament) ListMatchAttempts(id int64) ([]MatchAttempt, error) {
+	attempts, err := t.Database.ListMatchAttempts(id)
+	return attempts, err
+}
+
+// Queues a finished match to be played again, keeping the earlier attempts in its history.
+// Matches counted by a finished phase are never rerun.
+func (t *Tournament) RerunMatch(id int64) error {
+	if t.Queue == nil {
+		return errors.New("Match queue is not running")
+	} else if result, err := t.GetMatchResult(id); err != nil {
+		return err
+	} else if result == MatchResultInProgress {
+		return errors.New("Match is already queued")
+	} else if frozen, err := t.Database.IsPhaseMatch(id); err != nil {
+		return err
+	} else if frozen {
+		return errors.New("Match belongs to a finished phase")
+	} else if scrimmage, err := t.Database.MatchScrimmage(id); err != nil {
+		return err
+	} else if err := t.Database.ResetMatch(id); err != nil {
+		return err
+	} else {
+		if scrimmage != 0 {
+			t.Queue.PushScrimmage(id)
 		} else {
-			matchResult := GetMatchResult(result)
-			gzReplay := bytes.Buffer{}
-			gz := gzip.NewWriter(&gzReplay)
-			if jsonReplay, err := json.MarshalIndent(replay, "", "\t"); err != nil {
-				return id, MatchResultError, err
-			} else if _, err := gz.Write(jsonReplay); err != nil {
-				return id, MatchResultError, err
-			} else if err := gz.Close(); err != nil {
-				return id, MatchResultError, err
+			t.Queue.Push(id)
+		}
+		return nil
+	}
+}
+
+// Returned when a match cannot be played or recorded however often it is retried,
+// such as a match on a deleted map or one whose replay cannot be read
+type MatchError struct {
+	Err error
+}
+
+func (e *MatchError) Error() string {
+	return e.Err.Error()
+}
+
+// Whether a match failed because of the arena rather than the players, which makes it worth retrying
+func IsInfrastructureError(err error) bool {
+	switch err.(type) {
+	case *arena.BuildError, *arena.UnrecognisedReasonError, *MatchError:
+		return false
+	}
+	return err != nil && err != arena.ErrMatchTimeout
+}
+
+const (
+	LogEngine  = "engine"
+	LogPlayer1 = "player1"
+	LogPlayer2 = "player2"
+	LogStderr  = "stderr"
+)
+
+// Replaces the logs of a match with those of its latest run
+func (t *Tournament) saveMatchLogs(id int64, logs arena.MatchLogs) error {
+	return t.Database.TransactionBlock(func(tx Statements) error {
+		for stream, log := range map[string]string{LogEngine: logs.Engine, LogPlayer1: logs.TeamA, LogPlayer2: logs.TeamB, LogStderr: logs.Stderr} {
+			if err := tx.UpdateMatchLog(id, stream, log); err != nil {
+				return err
 			}
-			if err := t.UpdateMatch(category, mapName, player1, player2, finished, matchResult, gzReplay.Bytes()); err != nil {
-				return id, MatchResultError, err
+		}
+		return nil
+	})
+}
+
+// The logs of a match by stream, see LogEngine, LogPlayer1, LogPlayer2 and LogStderr
+func (t *Tournament) GetMatchLogs(id int64) (map[string]string, error) {
+	logs, err := t.Database.GetMatchLogs(id)
+	return logs, err
+}
+
+// Creates a match and adds it to the match queue if it has not already been played
+func (t *Tournament) EnqueueMatch(category TournamentCategory, mapName string, player1, player2 Submission, clock Clock) (int64, error) {
+	if t.Queue == nil {
+		return 0, errors.New("Match queue is not running")
+	} else if id, err := t.CreateMatch(category, mapName, player1, player2, clock.Now()); err != nil {
+		return 0, err
+	} else if result, err := t.GetMatchResult(id); err != nil {
+		return id, err
+	} else {
+		if result == MatchResultInProgress {
+			t.Queue.Push(id)
+		}
+		return id, nil
+	}
+}
+
+// Plays a match created by EnqueueMatch, returning the category of the match
+func (t *Tournament) runQueuedMatch(ctx context.Context, id int64, clock Clock) (TournamentCategory, error) {
+	if match, err := t.GetMatch(id); err != nil {
+		return "", err
+	} else {
+		category := TournamentCategory(match.Category)
+		player1 := Submission{match.Player1, match.Commit1}
+		player2 := Submission{match.Player2, match.Commit2}
+		if _, err := t.playMatch(ctx, id, category, match.Map, player1, player2, clock); err != nil {
+			if ctx.Err() != nil {
+				return category, err
+			} else if result, err2 := t.GetMatchResult(id); err2 != nil {
+				log.Println(err2)
+			} else if result == MatchResultInProgress {
+				if err2 := t.Database.UpdateMatchResult(id, clock.Now(), MatchResultError, []byte{}); err2 != nil {
+					log.Println(err2)
+				}
 			}
-			return id, matchResult, nil
+			return category, err
 		}
+		return category, nil
 	}
 }
 
@@ -291,25 +578,25 @@ func (t *Tournament) LatestCommits(category TournamentCategory) ([]Submission, e
 	}
 }
 
+// Plays the matches between the latest submissions which are missing or failed, see PlanLatestMatches
 func (t *Tournament) RunLatestMatches(category TournamentCategory) error {
-	if latestCommits, err := t.LatestCommits(category); err != nil {
+	if plan, err := t.PlanLatestMatches(category, ""); err != nil {
 		return err
-	} else if maps, err := t.ListMaps(category); err != nil {
+	} else {
+		_, err := t.RunPlan(plan)
 		return err
+	}
+}
+
+// Enqueues the matches between the latest submissions which are missing or failed, returning the ids of the scheduled matches
+func (t *Tournament) EnqueueLatestMatches(category TournamentCategory) ([]int64, error) {
+	if t.Queue == nil {
+		return nil, errors.New("Match queue is not running")
+	} else if plan, err := t.PlanLatestMatches(category, ""); err != nil {
+		return nil, err
 	} else {
-		for _, submission1 := range latestCommits {
-			for _, submission2 := range latestCommits {
-				if submission1.Name != submission2.Name {
-					for _, mapName := range maps {
-						if _, _, err := t.RunMatch(category, mapName, submission1, submission2, SystemClock()); err != nil {
-							return err
-						}
-					}
-				}
-			}
-		}
+		return t.EnqueuePlan(plan).Scheduled(), nil
 	}
-	return nil
 }
 
 func lookupMatch(matchLookup map[string]map[string]map[string]Match, commit1, commit2, mapName string) (Match, bool) {
@@ -323,6 +610,7 @@ func lookupMatch(matchLookup map[string]map[string]map[string]Match, commit1, co
 	}
 }
 
+// Indexes a match by its commits and map, keeping the match played on the latest version of the map
 func lookupInsert(matchLookup map[string]map[string]map[string]Match, match Match) {
 	var m1 map[string]map[string]Match
 	if v, ok := matchLookup[match.Commit1]; ok {
@@ -338,7 +626,9 @@ func lookupInsert(matchLookup map[string]map[string]map[string]Match, match Matc
 		m2 = map[string]Match{}
 		m1[match.Commit2] = m2
 	}
-	m2[match.Map] = match
+	if previous, ok := m2[match.Map]; !ok || previous.MapVersion <= match.MapVersion {
+		m2[match.Map] = match
+	}
 }
 
 type LeaderboardStats struct {
@@ -360,6 +650,45 @@ func (l *LeaderboardStats) AddTie() {
 	l.Ties++
 }
 
+// Adds a finished match to a player's record and score, returning false for matches which were not decided
+func (l *LeaderboardStats) add(rules ScoringRules, result MatchResult, player1 bool) bool {
+	switch result {
+	case MatchResultWinA, MatchResultWinB:
+		if (result == MatchResultWinA) == player1 {
+			l.AddWin()
+		} else {
+			l.AddLoss()
+		}
+	case MatchResultTieA, MatchResultTieB:
+		l.AddTie()
+	default:
+		return false
+	}
+	l.Score += rules.points(result, player1)
+	return true
+}
+
+// Adds the result of the match between each pair of submissions on each map to their stats,
+// returning the matches which were counted. Matches played on an earlier version of a map are left out.
+func tallyMatches(rules ScoringRules, stats map[string]*LeaderboardStats, submissions []Submission, maps []string, versions map[string]int, matchLookup map[string]map[string]map[string]Match) []Match {
+	counted := []Match{}
+	for _, submission1 := range submissions {
+		for _, submission2 := range submissions {
+			if submission1.Name != submission2.Name {
+				for _, mapName := range maps {
+					if match, ok := lookupMatch(matchLookup, submission1.CommitHash, submission2.CommitHash, mapName); ok && match.MapVersion == versions[mapName] {
+						if stats[submission1.Name].add(rules, match.Result, true) {
+							stats[submission2.Name].add(rules, match.Result, false)
+							counted = append(counted, match)
+						}
+					}
+				}
+			}
+		}
+	}
+	return counted
+}
+
 func (t *Tournament) CalculateLeaderboard(category TournamentCategory) error {
 	if latestCommits, err := t.LatestCommits(category); err != nil {
 		return err
@@ -367,57 +696,81 @@ func (t *Tournament) CalculateLeaderboard(category TournamentCategory) error {
 		return err
 	} else if maps, err := t.ListMaps(category); err != nil {
 		return err
+	} else if versions, err := t.Database.MapVersions(category); err != nil {
+		return err
 	} else {
 
 		matchLookup := map[string]map[string]map[string]Match{}
 		stats := map[string]*LeaderboardStats{}
-		commits := map[string]string{}
 		for _, match := range matches {
 			lookupInsert(matchLookup, match)
 			stats[match.Player1] = &LeaderboardStats{}
 			stats[match.Player2] = &LeaderboardStats{}
-			commits[match.Player1] = match.Commit1
-			commits[match.Player2] = match.Commit2
 		}
-
-		for _, submission1 := range latestCommits {
-			for _, submission2 := range latestCommits {
-				if submission1.Name != submission2.Name {
-					for _, mapName := range maps {
-						if match, ok := lookupMatch(matchLookup, submission1.CommitHash, submission2.CommitHash, mapName); ok {
-							if result, err := t.GetMatchResult(match.Id); err != nil {
-								return err
-							} else {
-								switch result {
-								case MatchResultWinA:
-									stats[submission1.Name].AddWin()
-									stats[submission2.Name].AddLoss()
-									break
-								case MatchResultWinB:
-									stats[submission1.Name].AddLoss()
-									stats[submission2.Name].AddWin()
-									break
-								case MatchResultTieA:
-								case MatchResultTieB:
-									stats[submission1.Name].AddTie()
-									stats[submission2.Name].AddTie()
-									break
-								}
-							}
-						}
-					}
-				}
-			}
+		// Players are ranked with their latest commit, whichever commits their matches were played with
+		commits := map[string]string{}
+		for _, submission := range latestCommits {
+			commits[submission.Name] = submission.CommitHash
 		}
 
+		rules := t.ScoringRules(category)
+		counted := tallyMatches(rules, stats, latestCommits, maps, versions, matchLookup)
+
 		stats2 := map[string]LeaderboardStats{}
 		for name, stat := range stats {
-			stat.Score = float64(stat.Wins*3 + stat.Losses*-1)
 			stats2[name] = *stat
 		}
 
-		return t.Database.UpdateLeaderboard(category, stats2, commits)
+		_, model := t.RatingModel(category)
+		ratings, history := calculateRatings(model, matches)
+		ranking := rankPlayers(rules, stats2, counted)
+		snapshot := leaderboardSnapshot(stats2, commits, ratings, ranking)
+		return t.Database.TransactionBlock(func(tx Statements) error {
+			if err := tx.UpdateLeaderboard(category, stats2, commits, ratings); err != nil {
+				return err
+			} else if err := tx.CreateLeaderboardSnapshot(category, time.Now(), snapshot, ranking); err != nil {
+				return err
+			}
+			return tx.UpdateRatingHistory(category, history)
+		})
+	}
+}
+
+// A player's place on the leaderboard after one recalculation, with the commit they were ranked with.
+// Players left level by the category's tiebreakers share a rank.
+type LeaderboardPoint struct {
+	Time       time.Time `json:"time"`
+	Name       string    `json:"name"`
+	CommitHash string    `json:"commit_hash"`
+	Rank       int       `json:"rank"`
+	Players    int       `json:"players"`
+	Score      float64   `json:"score"`
+	Wins       int       `json:"wins"`
+	Ties       int       `json:"ties"`
+	Losses     int       `json:"losses"`
+	Rating     float64   `json:"rating"`
+}
+
+// The players of a leaderboard in the order of its ranking
+func leaderboardSnapshot(stats map[string]LeaderboardStats, commits map[string]string, ratings map[string]Rating, ranking Ranking) []LeaderboardPoint {
+	points := []LeaderboardPoint{}
+	for _, name := range ranking.Order {
+		stat := stats[name]
+		points = append(points, LeaderboardPoint{time.Time{}, name, commits[name], ranking.Ranks[name], len(stats), stat.Score, stat.Wins, stat.Ties, stat.Losses, ratings[name].Value})
 	}
+	return points
+}
+
+// A player's rank and score after each recalculation of a category's leaderboard, oldest first
+func (t *Tournament) LeaderboardHistory(category TournamentCategory, name string) ([]LeaderboardPoint, error) {
+	history, err := t.Database.GetLeaderboardHistory(category, name)
+	return history, err
+}
+
+// The rating of each player on the leaderboard of a category, with the history of their rating
+func (t *Tournament) GetRatings(category TournamentCategory) (map[string]PlayerRating, error) {
+	ratings, err := t.Database.GetRatings(category)
+	return ratings, err
 }
 
 func (t *Tournament) GetLeaderboard(category TournamentCategory) (map[string]LeaderboardStats, []Match, error) {
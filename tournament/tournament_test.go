@@ -3,12 +3,17 @@ package tournament
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/xml"
+	"errors"
 	"github.com/GlenKelley/battleref/arena"
 	"github.com/GlenKelley/battleref/git"
 	"github.com/GlenKelley/battleref/simulator/battlecode2015"
 	"github.com/GlenKelley/battleref/testing"
 	"os/user"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -29,7 +34,7 @@ func TournamentTest(test *testing.T, f func(*testutil.T, *Tournament)) {
 		} else if err := gz.Close(); err != nil {
 			t.ErrorNow(err)
 		}
-		dummyArena := arena.DummyArena{time.Now(), arena.MatchResult{arena.WinnerA, arena.ReasonVictory, gzReplay.Bytes()}, nil}
+		dummyArena := arena.DummyArena{time.Now(), arena.MatchResult{arena.WinnerA, arena.ReasonVictory, arena.ReasonCodeDestruction, 1, 0, gzReplay.Bytes(), arena.MatchLogs{}}, nil}
 		remote := git.TempRemote{}
 		bootstrap := &arena.MinimalBootstrap{"../arena/internal/categories"}
 		if database, err := NewInMemoryDatabase(); err != nil {
@@ -70,7 +75,7 @@ func GitoliteTournamentTest(test *testing.T, f func(*testutil.T, *Tournament)) {
 		t.ErrorNow(err)
 	} else {
 		defer host.Cleanup()
-		dummyArena := arena.DummyArena{time.Now(), arena.MatchResult{arena.WinnerA, arena.ReasonVictory, []byte("MATCH_RESULT")}, nil}
+		dummyArena := arena.DummyArena{time.Now(), arena.MatchResult{arena.WinnerA, arena.ReasonVictory, arena.ReasonCodeDestruction, 1, 0, []byte("MATCH_RESULT"), arena.MatchLogs{}}, nil}
 		remote := git.TempRemote{}
 		bootstrap := &arena.MinimalBootstrap{"../arena/internal/categories"}
 		if database, err := NewInMemoryDatabase(); err != nil {
@@ -204,6 +209,76 @@ func TestSubmitCommit(t *testing.T) {
 	})
 }
 
+// An arena which rejects commits containing "broken"
+type compilingArena struct {
+	arena.DummyArena
+}
+
+func (a compilingArena) CompilePlayer(ctx context.Context, category, repoURL, commit string) (arena.CompileResult, error) {
+	if strings.Contains(commit, "broken") {
+		return arena.CompileResult{false, "RobotPlayer.java:1: error: class, interface, or enum expected"}, nil
+	}
+	return arena.CompileResult{true, ""}, nil
+}
+
+func TestSubmitRejectedCommit(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = compilingArena{tm.Arena.(arena.DummyArena)}
+		if _, err := tm.CreateUser("NameFoo", "PublicKeyFoo", CategoryTest); err != nil {
+			t.ErrorNow(err)
+		}
+		date := time.Now()
+		t.CheckError(tm.SubmitCommit("NameFoo", CategoryTest, "abcdef", date))
+		t.CheckError(tm.SubmitCommit("NameFoo", CategoryTest, "broken", date.Add(time.Hour)))
+		if status, err := tm.GetCommitStatus("NameFoo", CategoryTest, "abcdef"); err != nil {
+			t.ErrorNow(err)
+		} else if status.Status != SubmissionAccepted {
+			t.ErrorNow(status, "but expected", SubmissionAccepted)
+		}
+		if status, err := tm.GetCommitStatus("NameFoo", CategoryTest, "broken"); err != nil {
+			t.ErrorNow(err)
+		} else if status.Status != SubmissionRejected || status.Output == "" {
+			t.ErrorNow(status, "but expected", SubmissionRejected)
+		}
+		if commits, err := tm.LatestCommits(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(commits) != 1 || commits[0].CommitHash != "abcdef" {
+			t.ErrorNow(commits, "but expected only the accepted commit")
+		}
+	})
+}
+
+type unavailableCompiler struct {
+	arena.DummyArena
+}
+
+func (a unavailableCompiler) CompilePlayer(ctx context.Context, category, repoURL, commit string) (arena.CompileResult, error) {
+	return arena.CompileResult{}, errors.New("compiler unavailable")
+}
+
+func TestResubmitUncheckedCommit(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		dummy := tm.Arena.(arena.DummyArena)
+		tm.Arena = unavailableCompiler{dummy}
+		if err := tm.SubmitCommit("NameFoo", CategoryTest, "abcdef", time.Now()); err == nil {
+			t.ErrorNow("Expected an error when the compiler is unavailable")
+		} else if status, err := tm.GetCommitStatus("NameFoo", CategoryTest, "abcdef"); err != nil {
+			t.ErrorNow(err)
+		} else if status.Status != SubmissionError {
+			t.ErrorNow(status, "but expected", SubmissionError)
+		}
+		tm.Arena = compilingArena{dummy}
+		t.CheckError(tm.SubmitCommit("NameFoo", CategoryTest, "abcdef", time.Now()))
+		if status, err := tm.GetCommitStatus("NameFoo", CategoryTest, "abcdef"); err != nil {
+			t.ErrorNow(err)
+		} else if status.Status != SubmissionAccepted {
+			t.ErrorNow(status, "but expected", SubmissionAccepted)
+		} else if err := tm.SubmitCommit("NameFoo", CategoryTest, "abcdef", time.Now()); err == nil {
+			t.ErrorNow("Expected an error resubmitting a checked commit")
+		}
+	})
+}
+
 func TestCreateMatch(t *testing.T) {
 	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
 		p1 := Submission{"p1", "c1"}
@@ -244,7 +319,7 @@ func TestRunMatch(t *testing.T) {
 		p1 := Submission{"p1", "c1"}
 		p2 := Submission{"p2", "c2"}
 		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
-		if id, result, err := tm.RunMatch(CategoryTest, "MapFoo", p1, p2, SystemClock()); err != nil {
+		if id, result, err := tm.RunMatch(context.Background(), CategoryTest, "MapFoo", p1, p2, SystemClock()); err != nil {
 			t.ErrorNow(err)
 		} else if result != "WinA" {
 			t.ErrorNowf("Expected WinA not %v\n", result)
@@ -320,3 +395,360 @@ func TestCalculateLeaderboard(t *testing.T) {
 
 	})
 }
+
+func TestLeaderboardHistory(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		p1, p2 := Submission{"Name1", "a1"}, Submission{"Name2", "b1"}
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.SubmitCommit(p1.Name, CategoryTest, p1.CommitHash, time.Now()))
+		t.CheckError(tm.SubmitCommit(p2.Name, CategoryTest, p2.CommitHash, time.Now()))
+		play := func(player1, player2 Submission, result MatchResult) {
+			_, err := tm.CreateMatch(CategoryTest, "Map1", player1, player2, time.Now())
+			t.CheckError(err)
+			t.CheckError(tm.UpdateMatch(CategoryTest, "Map1", player1, player2, time.Now(), result, []byte{}))
+		}
+		play(p1, p2, MatchResultWinA)
+		play(p2, p1, MatchResultWinB)
+		t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+
+		p2 = Submission{"Name2", "b2"}
+		t.CheckError(tm.SubmitCommit(p2.Name, CategoryTest, p2.CommitHash, time.Now().Add(time.Second)))
+		play(p1, p2, MatchResultWinB)
+		play(p2, p1, MatchResultWinA)
+		t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+
+		if history, err := tm.LeaderboardHistory(CategoryTest, "Name2"); err != nil {
+			t.ErrorNow(err)
+		} else if len(history) != 2 {
+			t.ErrorNow("Expected a snapshot for each recalculation", history)
+		} else if first := history[0]; first.CommitHash != "b1" || first.Rank != 2 || first.Score != -2 || first.Players != 2 {
+			t.ErrorNow("Unexpected first snapshot", first)
+		} else if last := history[1]; last.CommitHash != "b2" || last.Rank != 1 || last.Score != 6 || last.Time.Before(first.Time) {
+			t.ErrorNow("Unexpected last snapshot", last)
+		}
+
+		// A match played later with an old commit does not change the commit a player is ranked with
+		old := Submission{"Name2", "b1"}
+		t.CheckError(tm.CreateMap("Map2", "MapSource", CategoryTest))
+		_, err := tm.CreateMatch(CategoryTest, "Map2", p1, old, time.Now())
+		t.CheckError(err)
+		t.CheckError(tm.UpdateMatch(CategoryTest, "Map2", p1, old, time.Now(), MatchResultWinA, []byte{}))
+		t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+		if history, err := tm.LeaderboardHistory(CategoryTest, "Name2"); err != nil {
+			t.ErrorNow(err)
+		} else if len(history) != 3 || history[2].CommitHash != "b2" {
+			t.ErrorNow("Expected the latest commit in the snapshot", history)
+		}
+	})
+}
+
+func TestLeaderboardRatings(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.RatingModels[CategoryTest] = "glicko2"
+		runLatestMatches(t, tm)
+		t.CheckError(tm.CalculateLeaderboard(CategoryTest))
+		if ratings, err := tm.GetRatings(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(ratings) != 3 {
+			t.ErrorNow("Expected 3 ratings", ratings)
+		} else {
+			for name, rating := range ratings {
+				if len(rating.History) != 12 {
+					t.ErrorNow("Expected 12 rated matches for", name, len(rating.History))
+				} else if last := rating.History[len(rating.History)-1]; last.Rating != rating.Rating || last.Uncertainty != rating.Uncertainty {
+					t.ErrorNow("Expected the last rating in the history", name, rating)
+				} else if rating.Uncertainty >= 350 {
+					t.ErrorNow("Expected the uncertainty to shrink", name, rating.Uncertainty)
+				}
+			}
+		}
+	})
+}
+
+func TestEnqueueMatch(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		p1 := Submission{"p1", "c1"}
+		p2 := Submission{"p2", "c2"}
+		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+		if _, err := tm.EnqueueMatch(CategoryTest, "MapFoo", p1, p2, SystemClock()); err == nil {
+			t.ErrorNow("expected error without a running queue")
+		}
+		t.CheckError(tm.StartMatchQueue(2, SystemClock()))
+		defer tm.Queue.Stop()
+		if id, err := tm.EnqueueMatch(CategoryTest, "MapFoo", p1, p2, SystemClock()); err != nil {
+			t.ErrorNow(err)
+		} else {
+			tm.Queue.Wait()
+			if result, err := tm.GetMatchResult(id); err != nil {
+				t.ErrorNow(err)
+			} else if result != MatchResultWinA {
+				t.ErrorNowf("Expected WinA not %v\n", result)
+			} else if tm.Queue.Len() != 0 {
+				t.ErrorNowf("Expected empty queue not %v\n", tm.Queue.Len())
+			}
+		}
+	})
+}
+
+func TestMatchQueueRecovery(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		p1 := Submission{"p1", "c1"}
+		p2 := Submission{"p2", "c2"}
+		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+		if id, err := tm.CreateMatch(CategoryTest, "MapFoo", p1, p2, time.Now()); err != nil {
+			t.ErrorNow(err)
+		} else {
+			t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+			defer tm.Queue.Stop()
+			tm.Queue.Wait()
+			if result, err := tm.GetMatchResult(id); err != nil {
+				t.ErrorNow(err)
+			} else if result != MatchResultWinA {
+				t.ErrorNowf("Expected WinA not %v\n", result)
+			}
+		}
+	})
+}
+
+func TestEnqueueLatestMatches(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		t.CheckError(tm.StartMatchQueue(2, SystemClock()))
+		defer tm.Queue.Stop()
+		for _, name := range []string{"Name1", "Name2", "Name3"} {
+			if _, err := tm.CreateUser(name, "PublicKey"+name, CategoryTest); err != nil {
+				t.ErrorNow(err)
+			}
+			t.CheckError(tm.SubmitCommit(name, CategoryTest, "c"+name, time.Now()))
+		}
+		t.CheckError(tm.CreateMap("Map1", "MapSource", CategoryTest))
+		t.CheckError(tm.CreateMap("Map2", "MapSource", CategoryTest))
+		if ids, err := tm.EnqueueLatestMatches(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(ids) != 12 {
+			t.ErrorNow("Expected 12 matches got", len(ids))
+		}
+		tm.Queue.Wait()
+		if ranks, _, err := tm.GetLeaderboard(CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if len(ranks) != 3 {
+			t.ErrorNow("Expected 3 ranks", len(ranks))
+		}
+	})
+}
+
+func TestRunMatchTimeout(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = arena.DummyArena{time.Now(), arena.MatchResult{}, arena.ErrMatchTimeout}
+		p1 := Submission{"p1", "c1"}
+		p2 := Submission{"p2", "c2"}
+		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+		if id, result, err := tm.RunMatch(context.Background(), CategoryTest, "MapFoo", p1, p2, SystemClock()); err != nil {
+			t.ErrorNow(err)
+		} else if result != MatchResultTimeout {
+			t.ErrorNowf("Expected Timeout not %v\n", result)
+		} else if result2, err := tm.GetMatchResult(id); err != nil {
+			t.ErrorNow(err)
+		} else if result2 != MatchResultTimeout {
+			t.ErrorNowf("Expected Timeout not %v\n", result2)
+		}
+	})
+}
+
+func TestRunMatchLogs(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		logs := arena.MatchLogs{"EngineFoo", "TeamAFoo", "TeamBFoo", "StderrFoo"}
+		tm.Arena = arena.DummyArena{time.Now(), arena.MatchResult{Logs: logs}, arena.ErrMatchTimeout}
+		p1 := Submission{"p1", "c1"}
+		p2 := Submission{"p2", "c2"}
+		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+		if id, _, err := tm.RunMatch(context.Background(), CategoryTest, "MapFoo", p1, p2, SystemClock()); err != nil {
+			t.ErrorNow(err)
+		} else if saved, err := tm.GetMatchLogs(id); err != nil {
+			t.ErrorNow(err)
+		} else if expected := map[string]string{LogEngine: "EngineFoo", LogPlayer1: "TeamAFoo", LogPlayer2: "TeamBFoo", LogStderr: "StderrFoo"}; !reflect.DeepEqual(saved, expected) {
+			t.ErrorNowf("Expected %v not %v\n", expected, saved)
+		}
+	})
+}
+
+func TestUserToken(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		if _, err := tm.CreateUser("Name1", "PublicKey1", CategoryTest); err != nil {
+			t.ErrorNow(err)
+		} else if token, err := tm.CreateUserToken("Name1"); err != nil {
+			t.ErrorNow(err)
+		} else if name, err := tm.GetTokenUser(token); err != nil {
+			t.ErrorNow(err)
+		} else if name != "Name1" {
+			t.ErrorNowf("Expected Name1 not %v\n", name)
+		} else if _, err := tm.GetTokenUser("unknown"); err == nil {
+			t.ErrorNow("Expected unknown token error")
+		} else if _, err := tm.CreateUserToken("Name1"); err != nil {
+			t.ErrorNow(err)
+		} else if _, err := tm.GetTokenUser(token); err == nil {
+			t.ErrorNow("Expected replaced token error")
+		}
+	})
+}
+
+// Fails a number of matches before playing like the arena it wraps
+type flakyArena struct {
+	arena.Arena
+	err      error
+	failures int
+	mutex    sync.Mutex
+}
+
+func (a *flakyArena) RunMatch(ctx context.Context, p arena.MatchProperties, clock func() time.Time) (time.Time, arena.MatchResult, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.failures > 0 {
+		a.failures--
+		return clock(), arena.MatchResult{}, a.err
+	}
+	return a.Arena.RunMatch(ctx, p, clock)
+}
+
+func queueFlakyMatch(t *testutil.T, tm *Tournament, arena *flakyArena) int64 {
+	tm.Arena = arena
+	tm.Retry = RetryPolicy{3, time.Millisecond, time.Millisecond}
+	t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+	t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+	if id, err := tm.EnqueueMatch(CategoryTest, "MapFoo", Submission{"p1", "c1"}, Submission{"p2", "c2"}, SystemClock()); err != nil {
+		t.ErrorNow(err)
+		return 0
+	} else {
+		tm.Queue.Wait()
+		return id
+	}
+}
+
+func checkMatchAttempts(t *testutil.T, tm *Tournament, id int64, expected ...MatchResult) {
+	if attempts, err := tm.ListMatchAttempts(id); err != nil {
+		t.ErrorNow(err)
+	} else if len(attempts) != len(expected) {
+		t.ErrorNowf("Expected %v attempts not %v\n", len(expected), attempts)
+	} else {
+		for i, attempt := range attempts {
+			if attempt.Result != expected[i] {
+				t.ErrorNowf("Expected attempt %v to be %v not %v\n", i, expected[i], attempt.Result)
+			}
+		}
+	}
+	if result, err := tm.GetMatchResult(id); err != nil {
+		t.ErrorNow(err)
+	} else if last := expected[len(expected)-1]; result != last {
+		t.ErrorNowf("Expected %v not %v\n", last, result)
+	}
+}
+
+func TestMatchRetry(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		id := queueFlakyMatch(t, tm, &flakyArena{Arena: tm.Arena, err: errors.New("worker lost"), failures: 2})
+		defer tm.Queue.Stop()
+		checkMatchAttempts(t, tm, id, MatchResultError, MatchResultError, MatchResultWinA)
+	})
+}
+
+func TestMatchRetryGivesUp(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		id := queueFlakyMatch(t, tm, &flakyArena{Arena: tm.Arena, err: errors.New("worker lost"), failures: 5})
+		defer tm.Queue.Stop()
+		checkMatchAttempts(t, tm, id, MatchResultError, MatchResultError, MatchResultError)
+	})
+}
+
+func TestMatchRetryAfterRestart(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = &flakyArena{Arena: tm.Arena, err: errors.New("worker lost"), failures: 5}
+		tm.Retry = RetryPolicy{3, time.Millisecond, time.Millisecond}
+		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+		id, err := tm.CreateMatch(CategoryTest, "MapFoo", Submission{"p1", "c1"}, Submission{"p2", "c2"}, time.Now())
+		t.CheckError(err)
+		for i := 0; i < 2; i++ {
+			t.CheckError(tm.Database.CreateMatchAttempt(id, time.Now(), time.Now(), MatchResultError, "worker lost"))
+		}
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		tm.Queue.Wait()
+		checkMatchAttempts(t, tm, id, MatchResultError, MatchResultError, MatchResultError)
+	})
+}
+
+func TestMatchRetryBuildError(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		id := queueFlakyMatch(t, tm, &flakyArena{Arena: tm.Arena, err: &arena.BuildError{"p1", "error: ';' expected", errors.New("exit status 1")}, failures: 1})
+		defer tm.Queue.Stop()
+		checkMatchAttempts(t, tm, id, MatchResultError)
+	})
+}
+
+func TestMatchRetryUnrecognisedReason(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		id := queueFlakyMatch(t, tm, &flakyArena{Arena: tm.Arena, err: &arena.UnrecognisedReasonError{"battlecode2016", "The winning team won on tiebreakers (more Zombies)."}, failures: 1})
+		defer tm.Queue.Stop()
+		checkMatchAttempts(t, tm, id, MatchResultError)
+	})
+}
+
+func TestMatchRetryUnreadableReplay(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		result := arena.MatchResult{arena.WinnerA, arena.ReasonVictory, arena.ReasonCodeDestruction, 1, 0, []byte("not a replay"), arena.MatchLogs{}}
+		id := queueFlakyMatch(t, tm, &flakyArena{Arena: arena.DummyArena{time.Now(), result, nil}})
+		defer tm.Queue.Stop()
+		checkMatchAttempts(t, tm, id, MatchResultError)
+	})
+}
+
+func TestMatchRetryDeletedMap(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Retry = RetryPolicy{3, time.Millisecond, time.Millisecond}
+		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+		id, err := tm.CreateMatch(CategoryTest, "MapFoo", Submission{"p1", "c1"}, Submission{"p2", "c2"}, time.Now())
+		t.CheckError(err)
+		t.CheckError(tm.DeleteMap("MapFoo", CategoryTest))
+		t.CheckError(tm.StartMatchQueue(1, SystemClock()))
+		defer tm.Queue.Stop()
+		tm.Queue.Wait()
+		checkMatchAttempts(t, tm, id, MatchResultError)
+	})
+}
+
+func TestRerunMatch(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		id := queueFlakyMatch(t, tm, &flakyArena{Arena: tm.Arena, err: arena.ErrMatchTimeout, failures: 1})
+		defer tm.Queue.Stop()
+		checkMatchAttempts(t, tm, id, MatchResultTimeout)
+		t.CheckError(tm.RerunMatch(id))
+		tm.Queue.Wait()
+		checkMatchAttempts(t, tm, id, MatchResultTimeout, MatchResultWinA)
+	})
+}
+
+func TestRetryDelay(test *testing.T) {
+	t := (*testutil.T)(test)
+	policy := RetryPolicy{5, time.Second, 3 * time.Second}
+	for failures, expected := range []time.Duration{time.Second, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if delay := policy.Delay(failures); delay != expected {
+			t.Errorf("Expected %v after %v failures not %v\n", expected, failures, delay)
+		}
+	}
+}
+
+func TestRunMatchCancelled(t *testing.T) {
+	TournamentTest(t, func(t *testutil.T, tm *Tournament) {
+		tm.Arena = arena.DummyArena{time.Now(), arena.MatchResult{}, context.Canceled}
+		p1 := Submission{"p1", "c1"}
+		p2 := Submission{"p2", "c2"}
+		t.CheckError(tm.CreateMap("MapFoo", "SourceFoo", CategoryTest))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if id, _, err := tm.RunMatch(ctx, CategoryTest, "MapFoo", p1, p2, SystemClock()); err == nil {
+			t.ErrorNow("expected error")
+		} else if result, err := tm.GetMatchResult(id); err != nil {
+			t.ErrorNow(err)
+		} else if result != MatchResultInProgress {
+			t.ErrorNowf("Expected InProgress not %v\n", result)
+		}
+	})
+}
@@ -26,6 +26,7 @@ const (
 	ContentTypePlain = "text/plain"
 	ContentTypeJson  = "application/json"
 	ContentTypeXml   = "application/xml"
+	ContentTypePng   = "image/png"
 )
 
 func SendPostJson(url string, jsonBody interface{}, jsonResponse interface{}) error {
@@ -226,6 +227,14 @@ func WriteXml(w http.ResponseWriter, bs []byte) {
 	}
 }
 
+func WritePng(w http.ResponseWriter, bs []byte) {
+	w.Header().Add(HeaderContentType, ContentTypePng)
+	w.Header().Add(HeaderAccessControlAllowOrigin, "*")
+	if _, err := w.Write(bs); err != nil {
+		log.Println("failed to send response: ", err)
+	}
+}
+
 var JsonCodec = websocket.Codec{wsJsonSend, wsJsonReceive}
 
 func wsJsonSend(v interface{}) (data []byte, payloadType byte, err error) {